@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =======================================================================================
+// Access Log - With SHORTY_ACCESS_LOG set, every request is written as one line in the
+// Apache Common Log Format, or the Combined format with referrer and user agent, for log
+// analyzers such as GoAccess and AWStats. The client address is the one
+// SHORTY_TRUSTED_PROXIES resolves. Without it, requests are only logged at debug level.
+// =======================================================================================
+
+const (
+	AccessLogCommon   = "common"   // host ident user [time] "request" status size
+	AccessLogCombined = "combined" // common plus "referer" "user-agent"
+)
+
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+type accessLogger struct {
+	mu             sync.Mutex
+	w              io.Writer
+	combined       bool
+	trustedProxies []netip.Prefix
+}
+
+func newAccessLogger(w io.Writer, format string, trustedProxies []netip.Prefix) *accessLogger {
+	return &accessLogger{w: w, combined: format == AccessLogCombined, trustedProxies: trustedProxies}
+}
+
+// Log writes the line for r, which started at start and was answered with status and a
+// body of size bytes.
+func (l *accessLogger) Log(r *http.Request, start time.Time, status, size int) {
+	line := formatAccessLine(r, clientIP(r, l.trustedProxies), start, status, size, l.combined)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := io.WriteString(l.w, line); err != nil {
+		slog.Error("Error writing access log", "error", err)
+	}
+}
+
+// formatAccessLine returns the Common or Combined Log Format line for r, ending in a
+// newline. Strings from the request are quoted and escaped so they can't break the line.
+func formatAccessLine(r *http.Request, host string, start time.Time, status, size int, combined bool) string {
+	sizeField := "-"
+	if size > 0 {
+		sizeField = strconv.Itoa(size)
+	}
+	var b strings.Builder
+	b.WriteString(host + " - - [" + start.Format(clfTime) + "] ")
+	b.WriteString(clfQuote(r.Method+" "+r.RequestURI+" "+r.Proto) + " ")
+	b.WriteString(strconv.Itoa(status) + " " + sizeField)
+	if combined {
+		b.WriteString(" " + clfQuote(r.Referer()) + " " + clfQuote(r.UserAgent()))
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// clfQuote quotes s the way Apache does, escaping quotes, backslashes and control
+// characters, with "-" standing in for an empty value.
+func clfQuote(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			b.WriteString(`\x` + strconv.FormatUint(uint64(c)>>4, 16) + strconv.FormatUint(uint64(c)&0xf, 16))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
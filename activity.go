@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// =======================================================================================
+// Recent Activity - A bounded ring of the latest creations for an ops feed, so listing
+// them never scans the whole store. Nothing extra is persisted: on load the ring is
+// rebuilt from the records' creation times.
+// =======================================================================================
+
+const (
+	activitySize         = 1000
+	defaultActivityLimit = 50
+)
+
+type activityEntry struct {
+	key       string
+	createdAt time.Time
+}
+
+// activityRing holds the last activitySize creations. Guarded by URLStore.mu.
+type activityRing struct {
+	entries []activityEntry
+	next    int // Where the next entry goes once the ring is full
+}
+
+func (a *activityRing) add(key string, createdAt time.Time) {
+	if len(a.entries) < activitySize {
+		a.entries = append(a.entries, activityEntry{key, createdAt})
+		return
+	}
+	a.entries[a.next] = activityEntry{key, createdAt}
+	a.next = (a.next + 1) % activitySize
+}
+
+// newest returns the entries from the most recent back.
+func (a *activityRing) newest() []activityEntry {
+	out := make([]activityEntry, 0, len(a.entries))
+	for i := range len(a.entries) {
+		out = append(out, a.entries[(a.next-1-i+2*len(a.entries))%len(a.entries)])
+	}
+	return out
+}
+
+// rebuildActivityLocked refills the ring with the newest links in s.urls. Must be called
+// with s.mu held for writing.
+func (s *URLStore) rebuildActivityLocked() {
+	entries := make([]activityEntry, 0, len(s.urls))
+	for key, rec := range s.urls {
+		if rec.AliasOf == "" {
+			entries = append(entries, activityEntry{key, rec.CreatedAt})
+		}
+	}
+	slices.SortFunc(entries, func(a, b activityEntry) int { return a.createdAt.Compare(b.createdAt) })
+
+	s.activity = activityRing{}
+	for _, entry := range entries[max(len(entries)-activitySize, 0):] {
+		s.activity.add(entry.key, entry.createdAt)
+	}
+}
+
+// Activity returns up to limit of the most recently created links, newest first. Links
+// deleted or replaced since their creation are left out.
+func (s *URLStore) Activity(limit int) []linkView {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links := make([]linkView, 0, min(limit, len(s.activity.entries)))
+	for _, entry := range s.activity.newest() {
+		if len(links) == limit {
+			break
+		}
+		rec, found := s.urls[entry.key]
+		if !found || !rec.CreatedAt.Equal(entry.createdAt) {
+			continue
+		}
+		links = append(links, linkView{ShortKey: entry.key, Record: rec})
+	}
+	return links
+}
+
+// handleActivity serves GET /activity?limit=50.
+func (h *urlHandler) handleActivity(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	limit, err := queryInt(r.URL.Query().Get("limit"), defaultActivityLimit)
+	if err != nil || limit < 1 || limit > activitySize {
+		writeError(w, r, "Limit must be between 1 and "+strconv.Itoa(activitySize), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Links []linkView `json:"links"`
+	}{
+		Links: h.store.Activity(limit),
+	})
+}
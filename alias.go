@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// =======================================================================================
+// Aliases - Extra keys that resolve to an existing link and share its click counter, so a
+// campaign can hand out several memorable keys for one destination.
+// =======================================================================================
+
+var (
+	ErrKeyExists      = errors.New("short key is already in use")
+	ErrTooManyAliases = errors.New("link has the maximum number of aliases")
+)
+
+// What happens to a link's aliases when the link itself is deleted.
+const (
+	AliasDeleteCascade = "cascade" // Remove the aliases too
+	AliasDeleteOrphan  = "orphan"  // Keep them; they stop resolving but their keys stay taken
+)
+
+// Alias stores alias as an additional key for the link under target and returns the key
+// it points to. An alias of an alias points straight at the underlying link, so chains
+// never form. With Config.MaxAliases set, a link that already has that many aliases gets
+// no more. A non-empty owner may only alias its own links; the alias belongs to the
+// link's owner.
+func (s *URLStore) Alias(target, alias, owner string, admin bool) (string, error) {
+	if err := s.validateChosenKey(alias, admin); err != nil {
+		return "", err
+	}
+	if err := s.checkWritable(); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	canonical, rec, found := s.resolveLocked(target)
+	if !found {
+		return "", ErrLinkNotFound
+	}
+	if owner != "" && rec.Owner != owner {
+		return "", ErrNotOwner
+	}
+	if _, taken := s.urls[alias]; taken {
+		return "", ErrKeyExists
+	}
+	if s.cfg.MaxAliases > 0 && len(s.aliases[canonical]) >= s.cfg.MaxAliases {
+		return "", ErrTooManyAliases
+	}
+	if err := s.makeRoom(alias); err != nil {
+		return "", err
+	}
+	aliasRec := Record{URL: rec.URL, CreatedAt: time.Now(), Owner: rec.Owner, AliasOf: canonical}
+	s.putLocked(alias, aliasRec)
+	s.emit(EventCreated, alias, aliasRec)
+
+	s.saveAsync()
+	return canonical, nil
+}
+
+func (s *URLStore) indexAlias(shortKey string, rec Record) {
+	if rec.AliasOf == "" {
+		return
+	}
+	keys := s.aliases[rec.AliasOf]
+	if keys == nil {
+		keys = make(map[string]struct{})
+		s.aliases[rec.AliasOf] = keys
+	}
+	keys[shortKey] = struct{}{}
+}
+
+// syncAliasURLsLocked updates the URL copies of shortKey's aliases to longURL, the URL
+// of the link they point to. Must be called with s.mu held for writing.
+func (s *URLStore) syncAliasURLsLocked(shortKey, longURL string) {
+	for _, alias := range slices.Collect(maps.Keys(s.aliases[shortKey])) {
+		if rec := s.urls[alias]; rec.URL != longURL {
+			rec.URL = longURL
+			s.putLocked(alias, rec)
+		}
+	}
+}
+
+func (s *URLStore) unindexAlias(shortKey string, rec Record) {
+	if rec.AliasOf == "" {
+		return
+	}
+	delete(s.aliases[rec.AliasOf], shortKey)
+	if len(s.aliases[rec.AliasOf]) == 0 {
+		delete(s.aliases, rec.AliasOf)
+	}
+}
+
+// handleAlias serves POST /{shortKey}/alias with a body of {"alias": "spring-sale"}.
+func (h *urlHandler) handleAlias(w http.ResponseWriter, r *http.Request, shortKey string) {
+	if !h.requireJSONBody(w, r) {
+		return
+	}
+	var requestData struct {
+		Alias string `json:"alias"`
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, "Failed to read request body", http.StatusInternalServerError)
+		return
+	}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		writeError(w, r, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if requestData.Alias == "" {
+		writeError(w, r, "Alias field is required", http.StatusBadRequest)
+		return
+	}
+
+	admin, owner := h.isAdmin(r), h.owner(r)
+	if h.cfg.CustomKeysRequireAuth && !admin && owner == "" {
+		storeError(w, r, ErrKeyNeedsAuth, "Failed to create alias")
+		return
+	}
+	canonical, err := h.store.Alias(shortKey, requestData.Alias, owner, admin)
+	if err != nil {
+		storeError(w, r, err, "Failed to create alias")
+		return
+	}
+
+	responseData := struct {
+		ShortKey string `json:"shortKey"`
+		AliasOf  string `json:"aliasOf"`
+	}{
+		ShortKey: requestData.Alias,
+		AliasOf:  canonical,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(responseData)
+}
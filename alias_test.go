@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAliasChecksOwner(t *testing.T) {
+	s := newTestStore(t, testConfig(t))
+	key, _, err := s.Add(context.Background(), AddRequest{URL: "https://example.com/a", Owner: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Alias(key, "theirs", "bob", false); !errors.Is(err, ErrNotOwner) {
+		t.Errorf("aliasing another owner's link: got %v, want ErrNotOwner", err)
+	}
+	if _, found := s.Lookup("theirs"); found {
+		t.Error("alias refused to another owner was stored")
+	}
+
+	for _, owner := range []string{"alice", ""} {
+		alias := "by-" + owner
+		if _, err := s.Alias(key, alias, owner, false); err != nil {
+			t.Fatalf("owner %q: %v", owner, err)
+		}
+		s.mu.RLock()
+		rec := s.urls[alias]
+		s.mu.RUnlock()
+		if rec.Owner != "alice" {
+			t.Errorf("alias made by owner %q belongs to %q, want alice", owner, rec.Owner)
+		}
+	}
+}
+
+func TestAliasURLFollowsTarget(t *testing.T) {
+	s := newTestStore(t, testConfig(t))
+	key := addTestLink(t, s, "https://example.com/old")
+	if _, err := s.Alias(key, "spring", "", false); err != nil {
+		t.Fatal(err)
+	}
+	aliasURL := func(alias string) string {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.urls[alias].URL
+	}
+
+	if err := s.Import(map[string]Record{key: {URL: "https://example.com/new"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := aliasURL("spring"); got != "https://example.com/new" {
+		t.Errorf("alias of an edited link copies %q, want the new URL", got)
+	}
+
+	stale := Record{URL: "https://example.com/stale", AliasOf: key}
+	if err := s.Import(map[string]Record{"summer": stale}); err != nil {
+		t.Fatal(err)
+	}
+	if got := aliasURL("summer"); got != "https://example.com/new" {
+		t.Errorf("imported alias copies %q, want its target's URL", got)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// cancelAfter is a context that reports itself canceled from the nth call of Err on, so
+// a write can be cut short between any two of its steps.
+type cancelAfter struct {
+	context.Context
+	n, calls int
+}
+
+func (c *cancelAfter) Err() error {
+	c.calls++
+	if c.calls >= c.n {
+		return context.Canceled
+	}
+	return nil
+}
+
+// assertOnlyFile fails the test unless path is the only file in its directory and holds
+// want.
+func assertOnlyFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != filepath.Base(path) {
+			t.Errorf("%s left behind", entry.Name())
+		}
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("file holds %q, want %q", got, want)
+	}
+}
+
+func TestWriteFileAtomicCanceled(t *testing.T) {
+	// writeFileAtomic checks ctx before creating the temporary file, after writing it
+	// and before the rename.
+	for n := 1; n <= 3; n++ {
+		path := filepath.Join(t.TempDir(), "urls.json")
+		if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ctx := &cancelAfter{Context: context.Background(), n: n}
+		if err := writeFileAtomic(ctx, path, []byte("new"), 0644); !errors.Is(err, context.Canceled) {
+			t.Errorf("canceled at check %d: got error %v, want %v", n, err, context.Canceled)
+		}
+		assertOnlyFile(t, path, []byte("old"))
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(context.Background(), path, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assertOnlyFile(t, path, []byte("new"))
+}
+
+func TestCanceledSaveKeepsPreviousFile(t *testing.T) {
+	s := newTestStore(t, testConfig(t))
+	if err := s.save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(s.filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.urls["late"] = Record{URL: "https://example.com/late"}
+	ctx := &cancelAfter{Context: context.Background(), n: 2} // Once the temporary file exists
+	if err := s.save(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	assertOnlyFile(t, s.filename, before)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// =======================================================================================
+// Admin Authentication - Endpoints that expose or replace the whole dataset require the
+// SHORTY_ADMIN_TOKEN as a bearer token. They are disabled when no token is configured.
+// =======================================================================================
+
+// requireAdmin reports whether r carries the admin token, replying with an error if not.
+func (h *urlHandler) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if h.cfg.AdminToken == "" {
+		writeError(w, r, "Admin API is disabled", http.StatusForbidden)
+		return false
+	}
+
+	if !h.isAdmin(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="go-shorty"`)
+		writeError(w, r, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// isAdmin reports whether r carries the admin token, for endpoints that are open to
+// everyone but grant admins extra privileges.
+func (h *urlHandler) isAdmin(r *http.Request) bool {
+	if h.cfg.AdminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.AdminToken)) == 1
+}
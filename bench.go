@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// =======================================================================================
+// Load Test - `go-shorty bench` drives a mix of creates and redirects at a fixed rate and
+// reports throughput and latency percentiles, for capacity planning. Without -target it
+// starts a server in-process, configured from the same SHORTY_* variables and backed by
+// a temporary data file; with -target it loads a running instance over the network. The
+// rate is held open-loop: requests are issued on schedule whether or not earlier ones
+// have finished, and those no worker was free to send are reported as dropped, so a
+// saturated server shows up as drops and latency instead of a quietly lower rate.
+// =======================================================================================
+
+// benchOptions are the flags of the bench command.
+type benchOptions struct {
+	target   string
+	token    string
+	rate     int
+	duration time.Duration
+	creates  float64
+	workers  int
+	seed     int
+}
+
+func parseBenchOptions(args []string) (benchOptions, error) {
+	var opts benchOptions
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.StringVar(&opts.target, "target", "", "base URL of a running server; empty starts one in-process")
+	fs.StringVar(&opts.token, "token", "", "API key sent as a bearer token with creates")
+	fs.IntVar(&opts.rate, "rate", 100, "requests per second")
+	fs.DurationVar(&opts.duration, "duration", 10*time.Second, "how long to send requests")
+	fs.Float64Var(&opts.creates, "creates", 0.1, "fraction of requests that create links, from 0 to 1")
+	fs.IntVar(&opts.workers, "workers", 16, "requests in flight at most")
+	fs.IntVar(&opts.seed, "seed", 100, "links created before the run for redirects to visit")
+	if err := fs.Parse(args); err != nil {
+		return benchOptions{}, err
+	}
+
+	switch {
+	case opts.rate < 1:
+		return benchOptions{}, errors.New("-rate must be at least 1")
+	case opts.duration <= 0:
+		return benchOptions{}, errors.New("-duration must be positive")
+	case opts.creates < 0 || opts.creates > 1:
+		return benchOptions{}, errors.New("-creates must be between 0 and 1")
+	case opts.workers < 1:
+		return benchOptions{}, errors.New("-workers must be at least 1")
+	case opts.seed < 1 && opts.creates < 1:
+		return benchOptions{}, errors.New("-seed must be at least 1 unless every request is a create")
+	}
+	opts.target = strings.TrimSuffix(opts.target, "/")
+	return opts, nil
+}
+
+// runBench runs the bench command with args and writes its report to out.
+func runBench(args []string, out io.Writer) error {
+	opts, err := parseBenchOptions(args)
+	if err != nil {
+		return err
+	}
+	if opts.target == "" {
+		target, stop, err := startBenchServer()
+		if err != nil {
+			return err
+		}
+		defer stop()
+		opts.target = target
+	}
+
+	b := newBenchClient(opts)
+	if err := b.seedLinks(opts.seed); err != nil {
+		return fmt.Errorf("seeding links: %w", err)
+	}
+	report := b.run(opts)
+	report.write(out)
+	return nil
+}
+
+// startBenchServer serves a fresh store on a loopback port, returning its base URL and a
+// function that shuts it down and removes its data.
+func startBenchServer() (string, func(), error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := os.MkdirTemp("", "shorty-bench-")
+	if err != nil {
+		return "", nil, err
+	}
+	filename := filepath.Join(dir, "urls.json")
+	if cfg.Storage == StorageBolt {
+		filename = filepath.Join(dir, "urls.db")
+	}
+	store, err := NewURLStore(filename, cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		store.Close()
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	server := &http.Server{Handler: withMiddleware(&urlHandler{store: store, cfg: cfg}, cfg, nil)}
+	go server.Serve(listener)
+	stop := func() {
+		server.Close()
+		store.Close()
+		os.RemoveAll(dir)
+	}
+	return "http://" + listener.Addr().String() + cfg.PathPrefix, stop, nil
+}
+
+// benchClient sends the requests of a run and collects their timings.
+type benchClient struct {
+	target string
+	token  string
+	client *http.Client
+
+	mu   sync.Mutex
+	keys []string // Links redirects pick from; creates add theirs
+
+	created atomic.Uint64 // Numbers the URLs of creates, so none are deduplicated
+}
+
+func newBenchClient(opts benchOptions) *benchClient {
+	return &benchClient{
+		target: opts.target,
+		token:  opts.token,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{MaxIdleConnsPerHost: opts.workers},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse // The redirect itself is what's measured
+			},
+		},
+	}
+}
+
+func (b *benchClient) seedLinks(n int) error {
+	for range n {
+		if err := b.create(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// create makes a link to a new URL and remembers its key.
+func (b *benchClient) create() error {
+	n := b.created.Add(1)
+	body, _ := json.Marshal(AddRequest{URL: "https://bench.example.com/page/" + strconv.FormatUint(n, 10)})
+	req, err := http.NewRequest(http.MethodPost, b.target+"/shorty", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("create answered %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	var link createdLink
+	if err := json.NewDecoder(resp.Body).Decode(&link); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.keys = append(b.keys, link.ShortKey)
+	b.mu.Unlock()
+	return nil
+}
+
+// redirect visits a random known link without following it.
+func (b *benchClient) redirect() error {
+	b.mu.Lock()
+	key := b.keys[rand.IntN(len(b.keys))]
+	b.mu.Unlock()
+	resp, err := b.client.Get(b.target + "/" + key)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 300 || resp.StatusCode > 399 {
+		return fmt.Errorf("redirect answered %s", resp.Status)
+	}
+	return nil
+}
+
+type benchOp int
+
+const (
+	benchCreate benchOp = iota
+	benchRedirect
+)
+
+// run sends requests for opts.duration at opts.rate and returns what it measured.
+func (b *benchClient) run(opts benchOptions) benchReport {
+	jobs := make(chan benchOp, opts.workers) // A short queue absorbs scheduling jitter
+	results := make([]benchTimings, opts.workers)
+	var wg sync.WaitGroup
+	for i := range opts.workers {
+		wg.Add(1)
+		go func(t *benchTimings) {
+			defer wg.Done()
+			for op := range jobs {
+				start := time.Now()
+				var err error
+				if op == benchCreate {
+					err = b.create()
+				} else {
+					err = b.redirect()
+				}
+				t.record(op, time.Since(start), err)
+			}
+		}(&results[i])
+	}
+
+	var dropped int
+	interval := time.Second / time.Duration(opts.rate)
+	start := time.Now()
+	for i := 0; ; i++ {
+		due := start.Add(time.Duration(i) * interval)
+		if due.Sub(start) >= opts.duration {
+			break
+		}
+		time.Sleep(time.Until(due))
+		op := benchRedirect
+		if rand.Float64() < opts.creates {
+			op = benchCreate
+		}
+		select {
+		case jobs <- op:
+		default:
+			dropped++ // Every worker is still busy
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	report := benchReport{target: b.target, elapsed: time.Since(start), dropped: dropped}
+	for _, t := range results {
+		report.creates.merge(t.creates)
+		report.redirects.merge(t.redirects)
+	}
+	return report
+}
+
+// benchTimings collects the latencies of one worker; each worker has its own, so no
+// locking is needed until they are merged.
+type benchTimings struct {
+	creates, redirects benchSeries
+}
+
+func (t *benchTimings) record(op benchOp, latency time.Duration, err error) {
+	series := &t.redirects
+	if op == benchCreate {
+		series = &t.creates
+	}
+	if err != nil {
+		series.errors++
+		if series.firstError == nil {
+			series.firstError = err
+		}
+		return
+	}
+	series.latencies = append(series.latencies, latency)
+}
+
+// benchSeries holds the outcomes of one kind of request.
+type benchSeries struct {
+	latencies  []time.Duration
+	errors     int
+	firstError error
+}
+
+func (s *benchSeries) merge(other benchSeries) {
+	s.latencies = append(s.latencies, other.latencies...)
+	s.errors += other.errors
+	if s.firstError == nil {
+		s.firstError = other.firstError
+	}
+}
+
+// percentile returns the latency p (0 to 100) percent of requests finished within.
+// latencies must be sorted.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(latencies))*p/100+0.5) - 1
+	return latencies[min(max(i, 0), len(latencies)-1)]
+}
+
+type benchReport struct {
+	target             string
+	elapsed            time.Duration
+	dropped            int
+	creates, redirects benchSeries
+}
+
+func (r benchReport) write(out io.Writer) {
+	fmt.Fprintf(out, "Target:   %s\n", r.target)
+	fmt.Fprintf(out, "Duration: %s\n", r.elapsed.Round(time.Millisecond))
+	fmt.Fprintf(out, "Dropped:  %d (no worker free when due)\n\n", r.dropped)
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\tok\terrors\treq/s\tp50\tp90\tp99\tmax\t")
+	for _, row := range []struct {
+		name   string
+		series benchSeries
+	}{{"create", r.creates}, {"redirect", r.redirects}} {
+		latencies := slices.Clone(row.series.latencies)
+		slices.Sort(latencies)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t\n",
+			row.name, len(latencies), row.series.errors,
+			float64(len(latencies))/r.elapsed.Seconds(),
+			roundLatency(percentile(latencies, 50)),
+			roundLatency(percentile(latencies, 90)),
+			roundLatency(percentile(latencies, 99)),
+			roundLatency(percentile(latencies, 100)),
+		)
+	}
+	tw.Flush()
+
+	for _, row := range []struct {
+		name string
+		err  error
+	}{{"create", r.creates.firstError}, {"redirect", r.redirects.firstError}} {
+		if row.err != nil {
+			fmt.Fprintf(out, "\nFirst %s error: %v\n", row.name, row.err)
+		}
+	}
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	if d > time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
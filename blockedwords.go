@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// =======================================================================================
+// Blocked Words - SHORTY_BLOCKED_KEY_WORDS lists words no short key may spell, such as
+// offensive ones. Custom keys and aliases matching one are rejected, and generated keys
+// that happen to match are thrown away and generated again. With
+// SHORTY_BLOCKED_KEY_MATCH=exact (default) a key matches when it is one of the words;
+// with substring, when it contains one. Matching ignores case. The list is empty by
+// default.
+// =======================================================================================
+
+const (
+	KeyMatchExact     = "exact"
+	KeyMatchSubstring = "substring"
+)
+
+var ErrKeyBlocked = errors.New("custom key contains a blocked word")
+
+// keyBlocked reports whether key matches one of cfg.BlockedKeyWords, which loadConfig
+// has lowercased.
+func keyBlocked(key string, cfg Config) bool {
+	if len(cfg.BlockedKeyWords) == 0 {
+		return false
+	}
+	key = strings.ToLower(key)
+	for _, word := range cfg.BlockedKeyWords {
+		if key == word || cfg.BlockedKeyMatch == KeyMatchSubstring && strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// =======================================================================================
+// Bolt Storage - With SHORTY_STORAGE=bolt the store is kept in an embedded bbolt database
+// (urls.db) instead of a JSON file. Each link is one entry in the links bucket, keyed by
+// short key with the JSON-encoded Record as its value, so a save writes only the links
+// changed since the previous one, in a single crash-safe transaction, rather than
+// rewriting the whole data set. The in-memory map and its indexes work as with the JSON
+// file; only persistence differs. SHORTY_STORAGE_PREFIX namespaces the stored keys, so the
+// bucket can be shared with other data: only keys with the prefix are read, written or
+// deleted.
+// =======================================================================================
+
+const (
+	StorageJSON = "json"
+	StorageBolt = "bolt"
+)
+
+var linksBucket = []byte("links")
+
+func openBolt(filename string, readOnly bool) (*bolt.DB, error) {
+	// The timeout turns a second process opening the same file into an error, not a hang.
+	return bolt.Open(filename, 0644, &bolt.Options{Timeout: time.Second, ReadOnly: readOnly})
+}
+
+// markDirtyLocked notes that shortKey changed and must be written by the next save. It is
+// a no-op for the JSON file, which is always written whole. Must be called with s.mu held
+// for writing.
+func (s *URLStore) markDirtyLocked(shortKey string) {
+	if s.db != nil {
+		s.dirty[shortKey] = struct{}{}
+	}
+}
+
+// markLoadedLocked records that the store now matches loaded, just read from disk, apart
+// from the expired links replaceLocked skipped, which the next save deletes. Must be
+// called with s.mu held for writing, right after replaceLocked.
+func (s *URLStore) markLoadedLocked(loaded map[string]Record) {
+	if s.db == nil {
+		return
+	}
+	s.dirty = make(map[string]struct{})
+	s.rewriteAll = false
+	for key := range loaded {
+		if _, kept := s.urls[key]; !kept {
+			s.dirty[key] = struct{}{}
+		}
+	}
+}
+
+// saveBolt writes the links changed since the last save. A failed write leaves them
+// marked, so the next save retries them. Must be called with saveMu held.
+func (s *URLStore) saveBolt(ctx context.Context) error {
+	var (
+		snapshotAt time.Time
+		dirty      map[string]struct{}
+		rewrite    bool
+		values     map[string][]byte // A nil value deletes the key
+		err        error
+	)
+	func() {
+		s.mu.Lock()
+		defer s.mu.Unlock() // Also on a panic, which saveRecovering survives
+		snapshotAt = time.Now()
+		s.clicksDirty.Store(false)
+		dirty, rewrite = s.dirty, s.rewriteAll
+		s.dirty, s.rewriteAll = make(map[string]struct{}), false
+		if rewrite {
+			for key := range s.urls {
+				dirty[key] = struct{}{}
+			}
+		}
+		values = make(map[string][]byte, len(dirty))
+		for key := range dirty {
+			if rec, found := s.urls[key]; found {
+				if values[key], err = s.encodeRecord(rec); err != nil {
+					break
+				}
+			} else {
+				values[key] = nil
+			}
+		}
+	}()
+
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = s.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(linksBucket)
+			if err != nil {
+				return err
+			}
+			if rewrite {
+				if err := s.deleteStoredKeys(bucket); err != nil {
+					return err
+				}
+			}
+			for key, value := range values {
+				if value == nil {
+					err = bucket.Delete(s.storedKey(key))
+				} else {
+					err = bucket.Put(s.storedKey(key), value)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		s.mu.Lock()
+		for key := range dirty {
+			s.dirty[key] = struct{}{}
+		}
+		s.rewriteAll = s.rewriteAll || rewrite
+		s.mu.Unlock()
+		return err
+	}
+	s.noteSaved(snapshotAt, time.Since(snapshotAt))
+	return nil
+}
+
+// storedKey returns the database key for shortKey.
+func (s *URLStore) storedKey(shortKey string) []byte {
+	return []byte(s.cfg.StoragePrefix + shortKey)
+}
+
+// forEachStored calls fn for every entry in bucket under the storage prefix, with the
+// prefix removed from the key.
+func (s *URLStore) forEachStored(bucket *bolt.Bucket, fn func(shortKey string, value []byte) error) error {
+	prefix := []byte(s.cfg.StoragePrefix)
+	c := bucket.Cursor()
+	for key, value := c.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = c.Next() {
+		if err := fn(string(key[len(prefix):]), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteStoredKeys removes every entry under the storage prefix, leaving other keys in
+// the bucket alone.
+func (s *URLStore) deleteStoredKeys(bucket *bolt.Bucket) error {
+	var keys []string
+	s.forEachStored(bucket, func(shortKey string, _ []byte) error {
+		keys = append(keys, shortKey)
+		return nil
+	})
+	// Deleting while the cursor walks the bucket can skip entries, so collect keys first.
+	for _, key := range keys {
+		if err := bucket.Delete(s.storedKey(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeRecord serializes rec as stored in the database, encrypted when a key is set.
+func (s *URLStore) encodeRecord(rec Record) ([]byte, error) {
+	if s.cfg.ClickPersistence == ClickPersistNone {
+		rec.Clicks = 0
+		rec.Variants = variantsWithoutClicks(rec.Variants)
+	}
+	data, err := json.Marshal(rec)
+	if err != nil || len(s.cfg.EncryptionKey) == 0 {
+		return data, err
+	}
+	return encryptData(s.cfg.EncryptionKey, data)
+}
+
+// readBolt reads every link from the database.
+func (s *URLStore) readBolt() (map[string]Record, error) {
+	urls := make(map[string]Record)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(linksBucket)
+		if bucket == nil {
+			return nil // A new database
+		}
+		return s.forEachStored(bucket, func(shortKey string, value []byte) error {
+			data, err := decryptData(s.cfg.EncryptionKey, value)
+			if err != nil {
+				return err
+			}
+			var rec Record
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return err
+			}
+			urls[shortKey] = rec
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// Close releases the database of a bolt-backed store, and of a bolt secondary, once a
+// save in progress is done. Later saves fail. It is a no-op for the JSON file.
+func (s *URLStore) Close() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	var err error
+	if s.secondary != nil && s.secondary.db != nil {
+		err = s.secondary.db.Close()
+	}
+	if s.db != nil {
+		err = errors.Join(s.db.Close(), err)
+	}
+	return err
+}
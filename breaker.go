@@ -0,0 +1,121 @@
+package main
+
+import (
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =======================================================================================
+// Circuit Breaker - Fetches of destination pages are guarded per host. After
+// breakerThreshold failures in a row (errors, timeouts, non-2xx answers), fetches to the
+// host are skipped for breakerCooldown, so a broken or slow host can't pile up fetches
+// that are bound to fail. Once the cooldown is over a single fetch is let through as a
+// trial: success closes the breaker, failure opens it again for another cooldown. Each
+// transition is logged.
+// =======================================================================================
+
+const (
+	breakerThreshold = 5
+	breakerCooldown  = time.Minute
+	maxBreakerHosts  = 1024 // Past this many tracked hosts, stale ones are forgotten
+)
+
+// breakerOpenError is returned for fetches skipped while a host's breaker is open.
+type breakerOpenError struct {
+	retryAfter time.Duration
+}
+
+func (e breakerOpenError) Error() string {
+	return "fetches to this host are paused after repeated failures"
+}
+
+// hostBreaker tracks recent fetch failures per host. It is safe for concurrent use.
+type hostBreaker struct {
+	mu    sync.Mutex
+	hosts map[string]*breakerState
+}
+
+type breakerState struct {
+	failures    int       // Consecutive failures
+	openUntil   time.Time // Fetches are skipped until then, once failures reach the threshold
+	trial       bool      // A trial fetch after the cooldown is under way
+	lastFailure time.Time
+}
+
+func newHostBreaker() *hostBreaker {
+	return &hostBreaker{hosts: make(map[string]*breakerState)}
+}
+
+// breakerHost returns the host longURL's breaker is kept under.
+func breakerHost(longURL string) string {
+	u, err := url.Parse(longURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// allow reports whether a fetch to host may go ahead at now. When it may not, wait is
+// how long until it is worth asking again. A fetch that is allowed must be followed by
+// record.
+func (b *hostBreaker) allow(host string, now time.Time) (wait time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.hosts[host]
+	switch {
+	case state == nil || state.failures < breakerThreshold:
+		return 0, true
+	case now.Before(state.openUntil):
+		return state.openUntil.Sub(now), false
+	case state.trial:
+		return time.Second, false // Another request is already trying the host
+	}
+	state.trial = true
+	slog.Info("Trying fetches to host again", "host", host)
+	return 0, true
+}
+
+// record notes the outcome of a fetch to host that allow let through. failed is up to
+// the fetcher: an answer that is merely of no use, say not a page, isn't a failure.
+func (b *hostBreaker) record(host string, failed bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.hosts[host]
+	if !failed {
+		if state != nil && state.failures >= breakerThreshold {
+			slog.Info("Fetches to host resumed", "host", host)
+		}
+		delete(b.hosts, host)
+		return
+	}
+
+	if state == nil {
+		if len(b.hosts) >= maxBreakerHosts {
+			b.sweepLocked(now)
+		}
+		state = &breakerState{}
+		b.hosts[host] = state
+	}
+	state.failures++
+	state.lastFailure = now
+	state.trial = false
+	if state.failures >= breakerThreshold {
+		state.openUntil = now.Add(breakerCooldown)
+		slog.Warn("Pausing fetches to host after repeated failures", "host", host, "failures", state.failures, "cooldown", breakerCooldown)
+	}
+}
+
+// sweepLocked forgets hosts whose breakers are closed and haven't failed for a cooldown.
+// Must be called with b.mu held.
+func (b *hostBreaker) sweepLocked(now time.Time) {
+	for host, state := range b.hosts {
+		if state.failures < breakerThreshold && now.Sub(state.lastFailure) >= breakerCooldown {
+			delete(b.hosts, host)
+		}
+	}
+}
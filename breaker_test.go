@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// tripBreaker records breakerThreshold failed fetches to host at now.
+func tripBreaker(t *testing.T, b *hostBreaker, host string, now time.Time) {
+	t.Helper()
+	for i := range breakerThreshold {
+		if _, ok := b.allow(host, now); !ok {
+			t.Fatalf("fetch %d skipped before the breaker tripped", i+1)
+		}
+		b.record(host, true, now)
+	}
+}
+
+func TestHostBreakerSkipsFetchesWhileOpen(t *testing.T) {
+	b := newHostBreaker()
+	now := time.Now()
+	tripBreaker(t, b, "slow.example", now)
+
+	for _, elapsed := range []time.Duration{0, time.Second, breakerCooldown - time.Millisecond} {
+		wait, ok := b.allow("slow.example", now.Add(elapsed))
+		if ok {
+			t.Fatalf("fetch allowed %v after the breaker tripped", elapsed)
+		}
+		if want := breakerCooldown - elapsed; wait != want {
+			t.Errorf("%v after tripping: got wait %v, want %v", elapsed, wait, want)
+		}
+	}
+	if _, ok := b.allow("other.example", now); !ok {
+		t.Error("the breaker of one host skipped a fetch to another")
+	}
+}
+
+func TestHostBreakerTrialAfterCooldown(t *testing.T) {
+	b := newHostBreaker()
+	now := time.Now()
+	tripBreaker(t, b, "slow.example", now)
+
+	later := now.Add(breakerCooldown)
+	if _, ok := b.allow("slow.example", later); !ok {
+		t.Fatal("no trial fetch once the cooldown was over")
+	}
+	if _, ok := b.allow("slow.example", later); ok {
+		t.Fatal("a second fetch was let through during the trial")
+	}
+
+	// A failed trial opens the breaker for another cooldown.
+	b.record("slow.example", true, later)
+	if wait, ok := b.allow("slow.example", later); ok || wait != breakerCooldown {
+		t.Fatalf("after a failed trial: got wait %v, allowed %v; want the breaker open for %v", wait, ok, breakerCooldown)
+	}
+
+	// A successful one closes it, and failures are counted from zero again.
+	later = later.Add(breakerCooldown)
+	if _, ok := b.allow("slow.example", later); !ok {
+		t.Fatal("no trial fetch after the second cooldown")
+	}
+	b.record("slow.example", false, later)
+	for i := range breakerThreshold - 1 {
+		if _, ok := b.allow("slow.example", later); !ok {
+			t.Fatalf("fetch %d skipped after the breaker closed", i+1)
+		}
+		b.record("slow.example", true, later)
+	}
+	if _, ok := b.allow("slow.example", later); !ok {
+		t.Error("breaker tripped before reaching the threshold again")
+	}
+}
+
+func TestHostBreakerSuccessResetsFailures(t *testing.T) {
+	b := newHostBreaker()
+	now := time.Now()
+	for range 3 {
+		for range breakerThreshold - 1 {
+			b.record("flaky.example", true, now)
+		}
+		b.record("flaky.example", false, now)
+	}
+	if _, ok := b.allow("flaky.example", now); !ok {
+		t.Error("failures separated by successes tripped the breaker")
+	}
+	if n := len(b.hosts); n != 0 {
+		t.Errorf("a healthy host is still tracked: %d hosts", n)
+	}
+}
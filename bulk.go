@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// =======================================================================================
+// Bulk Creation - Adds many links under a single lock acquisition and a single save.
+// =======================================================================================
+
+// maxBulkItems bounds one bulk request so it cannot hold the write lock for too long.
+const maxBulkItems = 1000
+
+type AddRequest struct {
+	URL       string   `json:"url"`
+	CustomKey *string  `json:"customKey,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	// Description is a free-text note on the link.
+	Description string `json:"description,omitempty"`
+	// Collection is the collection the link joins, if any; see collection.go.
+	Collection string            `json:"collection,omitempty"`
+	Permanent  bool              `json:"permanent,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	// Devices are per-device destinations, with URL as the fallback; see device.go.
+	Devices map[string]string `json:"devices,omitempty"`
+	// Countries are per-country destinations, ahead of Devices; see geo.go.
+	Countries map[string]string `json:"countries,omitempty"`
+	// Variants split visitors by weight in place of URL; see variant.go.
+	Variants []Variant `json:"variants,omitempty"`
+	// Fallbacks are backup destinations for when URL is down; see failover.go.
+	Fallbacks []string `json:"fallbacks,omitempty"`
+	// Prefix makes the link answer paths below its key too; see prefix.go.
+	Prefix bool `json:"prefix,omitempty"`
+	// Params makes URL a template filled from the path below the key; see template.go.
+	Params map[string]string `json:"params,omitempty"`
+	// NoTracking turns off click counting and click events for the link.
+	NoTracking bool `json:"noTracking,omitempty"`
+	// MaxClicks limits how many redirects the link serves; see maxclicks.go.
+	MaxClicks uint64 `json:"maxClicks,omitempty"`
+	// ExpiresIn is a Go duration after which the link expires, "0s" for never. Empty
+	// applies Config.DefaultTTL.
+	ExpiresIn string `json:"expiresIn,omitempty"`
+	// ActiveAt delays the link resolving until then; see schedule.go.
+	ActiveAt time.Time `json:"activeAt,omitzero"`
+	// RedirectMode is RedirectHTTP, RedirectHTML or empty for the configured default.
+	RedirectMode string `json:"redirectMode,omitempty"`
+	// RedirectStatus is 301, 302, 307, 308 or zero for the status Permanent implies.
+	RedirectStatus int `json:"redirectStatus,omitempty"`
+
+	// Admin is set by the handler for requests carrying the admin token.
+	Admin bool `json:"-"`
+	// Owner is set by the handler from the request's API key.
+	Owner string `json:"-"`
+	// CreatorIP is set by the handler according to Config.CreatorIP.
+	CreatorIP string `json:"-"`
+	// CreateOnly fails with ErrKeyExists instead of replacing a link already stored
+	// under CustomKey. It is set from an "If-None-Match: *" header.
+	CreateOnly bool `json:"-"`
+}
+
+type AddResult struct {
+	ShortKey string
+	Err      error
+}
+
+// AddMany stores every valid item and reports a result per item, in order. A failing
+// item doesn't stop the others; the store is saved once if anything was added. Items go
+// through the same checks as Add, and under Config.SyncWrites a failed save fails every
+// item that was added, undoing them all under SaveFailureRollback.
+func (s *URLStore) AddMany(ctx context.Context, items []AddRequest) []AddResult {
+	results := make([]AddResult, len(items))
+	writable := s.checkWritable()
+	for i, item := range items {
+		if results[i].Err = s.validateAdd(item); results[i].Err == nil {
+			results[i].Err = writable
+		}
+		if results[i].Err == nil {
+			results[i].Err = s.checkDestination(ctx, item.sampleURL())
+		}
+	}
+
+	rollback := s.cfg.SaveFailure == SaveFailureRollback
+	s.mu.Lock()
+	if rollback {
+		s.startJournalLocked()
+	}
+	added := false
+	for i, item := range items {
+		if results[i].Err != nil {
+			continue
+		}
+		results[i].ShortKey, _, results[i].Err = s.insertLocked(item)
+		added = added || results[i].Err == nil
+	}
+	var journal map[string]*journalEntry
+	if rollback {
+		journal = s.stopJournalLocked()
+	}
+	if added && !s.cfg.SyncWrites {
+		s.saveAsync()
+	}
+	s.mu.Unlock()
+
+	if !added || !s.cfg.SyncWrites {
+		return results
+	}
+	if err := s.saveSync(ctx); err != nil {
+		if rollback && !errors.Is(err, ErrSaveCanceled) && len(journal) > 0 {
+			s.rollback(journal) // A canceled save carries on and may still succeed
+		}
+		for i := range results {
+			if results[i].Err == nil {
+				results[i] = AddResult{Err: err}
+			}
+		}
+	}
+	return results
+}
+
+func (h *urlHandler) handleBulk(w http.ResponseWriter, r *http.Request) {
+	if !h.requireJSONBody(w, r) {
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		writeError(w, r, "Request body is required", http.StatusBadRequest)
+		return
+	}
+
+	var items []AddRequest
+	if err := json.Unmarshal(body, &items); err != nil {
+		writeError(w, r, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 {
+		writeError(w, r, "At least one item is required", http.StatusBadRequest)
+		return
+	}
+	if len(items) > maxBulkItems {
+		writeError(w, r, fmt.Sprintf("At most %d items are allowed per request", maxBulkItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+	admin, owner, creatorIP := h.isAdmin(r), h.owner(r), h.creatorIP(r)
+	for i, item := range items {
+		if item.URL == "" {
+			writeError(w, r, "URL field is required for every item", http.StatusBadRequest)
+			return
+		}
+		items[i].Admin = admin
+		items[i].Owner = owner
+		items[i].CreatorIP = creatorIP
+	}
+
+	type itemResponse struct {
+		ShortKey string `json:"shortKey,omitempty"`
+		Status   int    `json:"status"`
+		Error    string `json:"error,omitempty"`
+	}
+	responseData := make([]itemResponse, len(items))
+	for i, result := range h.store.AddMany(r.Context(), items) {
+		if result.Err == nil {
+			responseData[i] = itemResponse{ShortKey: result.ShortKey, Status: http.StatusCreated}
+			continue
+		}
+		status := storeErrorStatus(result.Err)
+		msg := result.Err.Error()
+		if status == http.StatusInternalServerError {
+			msg = "Failed to create short key"
+		}
+		responseData[i] = itemResponse{Status: status, Error: msg}
+		var dup *DuplicateURLError
+		if errors.As(result.Err, &dup) {
+			responseData[i].ShortKey = dup.ShortKey
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(responseData)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAddManySavesOnceAndReportsEachItem(t *testing.T) {
+	s := newTestStore(t, testConfig(t))
+	saves := make(chan error, 10)
+	s.onSave = func(err error) { saves <- err }
+
+	promo, reserved := "promo", "export"
+	results := s.AddMany(context.Background(), []AddRequest{
+		{URL: "https://example.com/a"},
+		{URL: "not a url"},
+		{URL: "https://example.com/b", CustomKey: &promo},
+		{URL: "https://example.com/c", CustomKey: &reserved},
+		{URL: "https://example.com/d"},
+	})
+
+	if len(results) != 5 {
+		t.Fatalf("got %d results, want 5", len(results))
+	}
+	for _, i := range []int{0, 2, 4} {
+		if results[i].Err != nil || results[i].ShortKey == "" {
+			t.Errorf("item %d: got key %q, error %v; want it stored", i, results[i].ShortKey, results[i].Err)
+		}
+	}
+	if results[2].ShortKey != promo {
+		t.Errorf("item 2: got key %q, want %q", results[2].ShortKey, promo)
+	}
+	if !errors.Is(results[1].Err, ErrInvalidURL) {
+		t.Errorf("item 1: got error %v, want %v", results[1].Err, ErrInvalidURL)
+	}
+	if !errors.Is(results[3].Err, ErrKeyReserved) {
+		t.Errorf("item 3: got error %v, want %v", results[3].Err, ErrKeyReserved)
+	}
+
+	waitForSave(t, saves)
+	time.Sleep(100 * time.Millisecond)
+	if n := len(saves); n != 0 {
+		t.Fatalf("the batch was saved %d more times, want a single save", n)
+	}
+
+	reopened := openTestStore(t, s.filename, s.cfg)
+	for _, i := range []int{0, 2, 4} {
+		if _, found := reopened.Lookup(results[i].ShortKey); !found {
+			t.Errorf("item %d: key %q missing after a restart", i, results[i].ShortKey)
+		}
+	}
+	if n := len(reopened.urls); n != 3 {
+		t.Errorf("got %d links after a restart, want 3", n)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// =======================================================================================
+// Redirect Chains - A destination that is itself a short link on this server makes every
+// visit take two hops through us. Depending on SHORTY_SELF_LINKS such a destination is
+// stored as is (optionally up to SHORTY_MAX_CHAIN_DEPTH hops), replaced by the final
+// destination, or refused. The server's own hosts are listed in SHORTY_SELF_HOSTS, since
+// behind a proxy it can't tell them on its own.
+// =======================================================================================
+
+const (
+	SelfLinkAllow   = "allow"
+	SelfLinkFlatten = "flatten"
+	SelfLinkReject  = "reject"
+)
+
+var (
+	ErrSelfLink     = errors.New("url points at a short link on this server")
+	ErrChainTooDeep = errors.New("url starts a chain of short links that is too long")
+)
+
+// maxFlattenHops bounds how far flattening follows links stored before it was enabled,
+// so a cycle among them cannot loop forever.
+const maxFlattenHops = 10
+
+// localKey returns the short key longURL points at when it is a redirect on this server.
+func (s *URLStore) localKey(longURL string) (string, bool) {
+	if len(s.cfg.SelfHosts) == 0 {
+		return "", false
+	}
+	u, err := url.Parse(longURL)
+	if err != nil || !hostMatches(strings.ToLower(u.Hostname()), s.cfg.SelfHosts) {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(u.Path, s.cfg.PathPrefix+"/")
+	if !ok || rest == "" || strings.Contains(rest, "/") {
+		return "", false // Not a redirect path, e.g. the root or /{key}/info
+	}
+	return strings.TrimSpace(rest), true
+}
+
+// applySelfLinkPolicyLocked returns the URL to store for longURL under the configured
+// policy. Links to keys that don't exist are left alone, as they don't redirect anywhere
+// yet. Must be called with s.mu held.
+func (s *URLStore) applySelfLinkPolicyLocked(longURL string) (string, error) {
+	if s.cfg.SelfLinks == SelfLinkAllow {
+		return longURL, s.checkChainDepthLocked(longURL)
+	}
+
+	for range maxFlattenHops {
+		shortKey, ok := s.localKey(longURL)
+		if !ok {
+			return longURL, nil
+		}
+		_, rec, found := s.resolveLocked(shortKey)
+		if !found {
+			return longURL, nil
+		}
+		if s.cfg.SelfLinks == SelfLinkReject {
+			return "", ErrSelfLink
+		}
+		longURL = rec.URL
+	}
+	return "", ErrSelfLink
+}
+
+// checkChainDepthLocked follows the chain of local short links starting at longURL and
+// fails with ErrChainTooDeep when it takes more than MaxChainDepth hops, counting the new
+// link itself. Zero disables the check. Must be called with s.mu held.
+func (s *URLStore) checkChainDepthLocked(longURL string) error {
+	if s.cfg.MaxChainDepth == 0 {
+		return nil
+	}
+	for hops := 1; ; hops++ {
+		shortKey, ok := s.localKey(longURL)
+		if !ok {
+			return nil
+		}
+		_, rec, found := s.resolveLocked(shortKey)
+		if !found {
+			return nil
+		}
+		if hops >= s.cfg.MaxChainDepth {
+			return ErrChainTooDeep // Also ends a cycle, which never reaches a real destination
+		}
+		longURL = rec.URL
+	}
+}
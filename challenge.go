@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =======================================================================================
+// Creation Challenges - With SHORTY_CHALLENGE set, anonymous creates must carry a proof in
+// the X-Challenge-Response header, or they fail with 403. Requests with the admin token
+// or an API key skip it. Two verifiers are built in:
+//
+//	pow       a proof of work: "<unix seconds>:<nonce>" whose SHA-256 starts with
+//	          SHORTY_CHALLENGE_DIFFICULTY zero bits, at most five minutes old and
+//	          accepted once
+//	hcaptcha  an hCaptcha response token, checked against hCaptcha's siteverify API
+//	          with SHORTY_CHALLENGE_SECRET
+//
+// Other providers plug in by implementing ChallengeVerifier. When the provider can't be
+// reached the create fails with 502 rather than being let through.
+// =======================================================================================
+
+const (
+	ChallengeProofOfWork = "pow"
+	ChallengeHCaptcha    = "hcaptcha"
+
+	challengeHeader            = "X-Challenge-Response"
+	defaultChallengeDifficulty = 20
+	maxChallengeDifficulty     = 32
+	proofOfWorkMaxAge          = 5 * time.Minute
+	hcaptchaVerifyURL          = "https://api.hcaptcha.com/siteverify"
+	challengeVerifyTimeout     = 5 * time.Second
+)
+
+var ErrChallengeFailed = errors.New("challenge response is missing or invalid")
+
+// ChallengeVerifier checks the proof an anonymous create carries. remoteIP is the
+// client's address, for providers that take it into account.
+type ChallengeVerifier interface {
+	Verify(ctx context.Context, response, remoteIP string) error
+}
+
+// newChallengeVerifier returns the verifier cfg.Challenge names, or nil when it is off.
+func newChallengeVerifier(cfg Config) ChallengeVerifier {
+	switch cfg.Challenge {
+	case ChallengeProofOfWork:
+		return newProofOfWorkVerifier(cfg.ChallengeDifficulty)
+	case ChallengeHCaptcha:
+		return &hcaptchaVerifier{
+			secret:   cfg.ChallengeSecret,
+			endpoint: hcaptchaVerifyURL,
+			client:   &http.Client{Timeout: challengeVerifyTimeout},
+		}
+	}
+	return nil
+}
+
+// requireChallenge reports whether r may create a link, replying with 403 if it is
+// anonymous and its challenge response doesn't verify.
+func (h *urlHandler) requireChallenge(w http.ResponseWriter, r *http.Request, req AddRequest) bool {
+	if h.challenge == nil || req.Admin || req.Owner != "" {
+		return true
+	}
+	response := strings.TrimSpace(r.Header.Get(challengeHeader))
+	if response == "" {
+		writeError(w, r, "A challenge response is required in "+challengeHeader, http.StatusForbidden)
+		return false
+	}
+	err := h.challenge.Verify(r.Context(), response, clientIP(r, h.cfg.TrustedProxies))
+	if errors.Is(err, ErrChallengeFailed) {
+		writeError(w, r, "Challenge response is invalid", http.StatusForbidden)
+		return false
+	}
+	if err != nil {
+		slog.Error("Failed to verify challenge", "error", err)
+		writeError(w, r, "Failed to verify challenge", http.StatusBadGateway)
+		return false
+	}
+	return true
+}
+
+// proofOfWorkVerifier accepts "<unix seconds>:<nonce>" responses whose SHA-256 starts
+// with difficulty zero bits. Each response is accepted once while it is fresh, so a
+// solved proof can't be replayed for more links.
+type proofOfWorkVerifier struct {
+	difficulty int
+
+	mu   sync.Mutex
+	used map[string]time.Time // Accepted responses and when they stop being fresh
+}
+
+func newProofOfWorkVerifier(difficulty int) *proofOfWorkVerifier {
+	return &proofOfWorkVerifier{difficulty: difficulty, used: make(map[string]time.Time)}
+}
+
+func (v *proofOfWorkVerifier) Verify(_ context.Context, response, _ string) error {
+	issued, _, ok := strings.Cut(response, ":")
+	seconds, err := strconv.ParseInt(issued, 10, 64)
+	if !ok || err != nil {
+		return ErrChallengeFailed
+	}
+	now := time.Now()
+	expires := time.Unix(seconds, 0).Add(proofOfWorkMaxAge)
+	if now.After(expires) || time.Unix(seconds, 0).After(now.Add(time.Minute)) {
+		return ErrChallengeFailed
+	}
+	if leadingZeroBits(sha256.Sum256([]byte(response))) < v.difficulty {
+		return ErrChallengeFailed
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for used, until := range v.used {
+		if now.After(until) {
+			delete(v.used, used)
+		}
+	}
+	if _, replayed := v.used[response]; replayed {
+		return ErrChallengeFailed
+	}
+	v.used[response] = expires
+	return nil
+}
+
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		n += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return n
+}
+
+// hcaptchaVerifier checks hCaptcha response tokens with hCaptcha's siteverify API.
+type hcaptchaVerifier struct {
+	secret   string
+	endpoint string
+	client   *http.Client
+}
+
+func (v *hcaptchaVerifier) Verify(ctx context.Context, response, remoteIP string) error {
+	form := url.Values{"secret": {v.secret}, "response": {response}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("verifying challenge: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("verifying challenge: %w", err)
+	}
+	if !result.Success {
+		return ErrChallengeFailed
+	}
+	return nil
+}
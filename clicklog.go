@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// =======================================================================================
+// Click Event Log - Emits one JSON line per redirect for analytics pipelines. This is
+// separate from the aggregate click counter kept on each Record. Events wait in a queue
+// of SHORTY_CLICK_LOG_QUEUE_SIZE for the writer. When it is full, SHORTY_CLICK_QUEUE_FULL
+// either drops new events and counts them, the default, so redirects never wait on the
+// log, or blocks redirects until there is room, so no event is lost. The same policy
+// applies to the webhook queue; /healthz reports the drops.
+// =======================================================================================
+
+// How the client IP appears in click events.
+const (
+	ClickIPFull = "full"
+	ClickIPHash = "hash"
+	ClickIPOmit = "omit"
+)
+
+const defaultClickQueueSize = 1024
+
+// What happens to a click event whose queue is full.
+const (
+	QueueFullDrop  = "drop"
+	QueueFullBlock = "block"
+)
+
+// dropLogEvery is how many dropped events go by between warnings, so a flood of them
+// doesn't flood the log too.
+const dropLogEvery = 1000
+
+type ClickEvent struct {
+	Time      time.Time `json:"time"`
+	Key       string    `json:"key"`
+	Host      string    `json:"host"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	ClientIP  string    `json:"clientIP,omitempty"`
+	// RequestID is the visit's X-Request-ID, if it had one; see requestid.go.
+	RequestID string `json:"requestID,omitempty"`
+}
+
+// ipHashSalt is random per process, so hashed IPs only correlate within one run.
+var ipHashSalt = func() []byte {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		slog.Warn("Could not generate click event salt", "error", err)
+	}
+	return salt
+}()
+
+// newClickEvent describes the redirect r to shortKey, applying the ipMode privacy setting
+// to the client address, which is worked out with trustedProxies.
+func newClickEvent(r *http.Request, shortKey, longURL, ipMode string, trustedProxies []netip.Prefix) ClickEvent {
+	ev := ClickEvent{
+		Time:      time.Now().UTC(),
+		Key:       shortKey,
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		RequestID: requestID(r),
+	}
+	switch ipMode {
+	case ClickIPFull:
+		ev.ClientIP = clientIP(r, trustedProxies)
+	case ClickIPHash:
+		ev.ClientIP = hashIP(clientIP(r, trustedProxies), ipHashSalt)
+	}
+	if u, err := url.Parse(longURL); err == nil {
+		ev.Host = u.Hostname()
+	}
+	return ev
+}
+
+type clickLogger struct {
+	events  chan ClickEvent
+	block   bool // Wait for room in a full queue instead of dropping
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// newClickLogger writes events to w through a queue of queueSize, blocking or dropping
+// when it is full as block says.
+func newClickLogger(w io.Writer, queueSize int, block bool) *clickLogger {
+	l := &clickLogger{
+		events: make(chan ClickEvent, queueSize),
+		block:  block,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(l.done)
+		enc := json.NewEncoder(w)
+		for ev := range l.events {
+			if err := enc.Encode(ev); err != nil {
+				slog.Error("Error writing click event", "error", err)
+			}
+		}
+	}()
+	return l
+}
+
+// Log queues ev to be written. When the queue is full it waits or drops ev, according to
+// the logger's policy.
+func (l *clickLogger) Log(ev ClickEvent) {
+	if l.block {
+		l.events <- ev
+		return
+	}
+	select {
+	case l.events <- ev:
+	default:
+		if n := l.dropped.Add(1); n%dropLogEvery == 1 {
+			slog.Warn("Click event queue full, dropping event", "key", ev.Key, "dropped", n)
+		}
+	}
+}
+
+// Dropped returns how many events were dropped because the queue was full.
+func (l *clickLogger) Dropped() uint64 {
+	if l == nil {
+		return 0
+	}
+	return l.dropped.Load()
+}
+
+// Close stops accepting events and waits for the queued ones to be written.
+func (l *clickLogger) Close() {
+	close(l.events)
+	<-l.done
+}
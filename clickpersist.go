@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// =======================================================================================
+// Click Persistence - How click counts reach the data file. The tradeoff is durability
+// against write load:
+//
+//   - ClickPersistNone keeps counts in memory only. Redirects never touch the disk and
+//     the file never changes because of a click, but every restart resets the counts.
+//   - ClickPersistEventual (default) marks the store dirty on a click and flushes it on
+//     a timer, alongside any save triggered by a create. At most one flush interval of
+//     clicks is lost in a crash, and a burst of clicks costs a single write.
+//   - ClickPersistStrict saves the whole file before the redirect is answered. No click
+//     is lost, but every redirect pays for a full rewrite of the data file, so it only
+//     suits small stores with modest traffic.
+// =======================================================================================
+
+const (
+	ClickPersistNone     = "none"
+	ClickPersistEventual = "eventual"
+	ClickPersistStrict   = "strict"
+)
+
+// defaultClickFlushInterval is how often ClickPersistEventual writes pending counts.
+const defaultClickFlushInterval = 30 * time.Second
+
+// persistClick makes a click recorded by IncrementClicks durable according to the
+// configured strategy. Must be called without s.mu held.
+func (s *URLStore) persistClick() {
+	switch s.cfg.ClickPersistence {
+	case ClickPersistEventual:
+		s.clicksDirty.Store(true)
+	case ClickPersistStrict:
+		err := s.save(context.Background())
+		if err != nil {
+			slog.Error("Error saving to file", "file", s.filename, "error", err)
+		}
+		s.recordSave(err)
+	}
+}
+
+// startClickFlusher periodically saves counts recorded under ClickPersistEventual. It
+// runs for the life of the process; other strategies and read-only replicas don't need it.
+func (s *URLStore) startClickFlusher(interval time.Duration) {
+	if s.cfg.ClickPersistence != ClickPersistEventual || s.cfg.ReadOnly {
+		return
+	}
+	go func() {
+		for range time.Tick(interval) {
+			if s.clicksDirty.Swap(false) {
+				s.saveAsync()
+			}
+		}
+	}()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestClickPersistenceAcrossRestart(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     uint64 // Clicks after a restart
+	}{
+		{ClickPersistNone, 0},
+		{ClickPersistEventual, 3},
+		{ClickPersistStrict, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			t.Setenv("SHORTY_CLICK_PERSISTENCE", tt.strategy)
+			t.Setenv("SHORTY_CLICK_FLUSH_INTERVAL", "20ms")
+			s := newTestStore(t, testConfig(t))
+			saves := make(chan error, 10)
+			s.onSave = func(err error) { saves <- err }
+			s.startClickFlusher(s.cfg.ClickFlushInterval) // As main does
+
+			key := addTestLink(t, s, "https://example.com/a")
+			waitForSave(t, saves)
+			for range 3 {
+				s.IncrementClicks(key, noVariant)
+			}
+
+			switch tt.strategy {
+			case ClickPersistNone:
+				// Other changes still save the file, without the counts.
+				addTestLink(t, s, "https://example.com/b")
+				waitForSave(t, saves)
+			case ClickPersistEventual:
+				// The flusher's. One that ran between the clicks is followed by another.
+				waitForSave(t, saves)
+				for s.clicksDirty.Load() {
+					waitForSave(t, saves)
+				}
+			case ClickPersistStrict:
+				// Saved before IncrementClicks returned.
+			}
+
+			rec, found := openTestStore(t, s.filename, s.cfg).Lookup(key)
+			if !found {
+				t.Fatalf("key %q missing after a restart", key)
+			}
+			if rec.Clicks != tt.want {
+				t.Errorf("got %d clicks after a restart, want %d", rec.Clicks, tt.want)
+			}
+		})
+	}
+}
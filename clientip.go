@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// =======================================================================================
+// Client IPs - Works out which client sent a request. X-Forwarded-For is only believed
+// when the immediate peer is one of the configured trusted proxies, so clients that talk
+// to the server directly can't claim another address by setting the header themselves.
+// =======================================================================================
+
+// parseTrustedProxies reads CIDR ranges and bare IPs such as "10.0.0.0/8" or "127.0.0.1".
+func parseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("SHORTY_TRUSTED_PROXIES entry %q must be an IP or CIDR range", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func isTrustedProxy(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client behind r. When the peer is a trusted proxy,
+// X-Forwarded-For is walked from the right, skipping further trusted proxies, and the
+// first other address is the client. Entries further left were written by the client and
+// are ignored.
+func clientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !isTrustedProxy(peer, trustedProxies) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break // A malformed entry ends the part of the chain that can be believed
+		}
+		if !isTrustedProxy(hop, trustedProxies) {
+			return hop.Unmap().String()
+		}
+		peer = hop
+	}
+	return peer.Unmap().String()
+}
+
+// hashIP returns a short, salted digest of ip for logs and records that shouldn't hold
+// the address itself.
+func hashIP(ip string, salt []byte) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(ip))
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// creatorIP returns how the client that sent r is recorded on the links it creates,
+// according to Config.CreatorIP.
+func (h *urlHandler) creatorIP(r *http.Request) string {
+	switch h.cfg.CreatorIP {
+	case ClickIPFull:
+		return clientIP(r, h.cfg.TrustedProxies)
+	case ClickIPHash:
+		return hashIP(clientIP(r, h.cfg.TrustedProxies), h.cfg.IPHashSalt)
+	default:
+		return ""
+	}
+}
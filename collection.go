@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// =======================================================================================
+// Collections - A named group a link may belong to, such as a campaign, set with
+// "collection" at create. Unlike tags a link is in at most one collection, which can be
+// listed with its total clicks, renamed or deleted as a whole.
+// =======================================================================================
+
+const maxCollectionLength = 64
+
+var (
+	ErrInvalidCollection  = errors.New("invalid collection")
+	ErrCollectionNotFound = errors.New("collection not found")
+)
+
+// validateCollection checks a collection name; empty means no collection.
+func validateCollection(name string) error {
+	if len(name) > maxCollectionLength {
+		return fmt.Errorf("%w: names must be at most %d characters", ErrInvalidCollection, maxCollectionLength)
+	}
+	for _, c := range name {
+		if !isKeyChar(c) {
+			return fmt.Errorf("%w: %q may only contain letters, digits, '-' and '_'", ErrInvalidCollection, name)
+		}
+	}
+	return nil
+}
+
+// indexCollection and unindexCollection maintain s.byCollection. Must be called with s.mu
+// held for writing.
+func (s *URLStore) indexCollection(shortKey string, rec Record) {
+	if rec.Collection == "" {
+		return
+	}
+	keys := s.byCollection[rec.Collection]
+	if keys == nil {
+		keys = make(map[string]struct{})
+		s.byCollection[rec.Collection] = keys
+	}
+	keys[shortKey] = struct{}{}
+}
+
+func (s *URLStore) unindexCollection(shortKey string, rec Record) {
+	if rec.Collection == "" {
+		return
+	}
+	delete(s.byCollection[rec.Collection], shortKey)
+	if len(s.byCollection[rec.Collection]) == 0 {
+		delete(s.byCollection, rec.Collection)
+	}
+}
+
+// Collection returns the links in the named collection ordered by key, with their total
+// clicks.
+func (s *URLStore) Collection(name string) ([]linkView, uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.byCollection[name]) == 0 {
+		return nil, 0, ErrCollectionNotFound
+	}
+	keys := make([]string, 0, len(s.byCollection[name]))
+	for key := range s.byCollection[name] {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	links := make([]linkView, len(keys))
+	var clicks uint64
+	for i, key := range keys {
+		rec := s.urls[key]
+		links[i] = linkView{ShortKey: key, Record: rec}
+		clicks = addClicks(clicks, rec.Clicks)
+	}
+	return links, clicks, nil
+}
+
+// RenameCollection moves every link in the named collection to newName, merging into it
+// when it already exists, and returns how many links moved.
+func (s *URLStore) RenameCollection(name, newName string) (int, error) {
+	if newName == "" {
+		return 0, fmt.Errorf("%w: a new name is required", ErrInvalidCollection)
+	}
+	if err := validateCollection(newName); err != nil {
+		return 0, err
+	}
+	return s.updateCollection(name, func(key string, rec Record) {
+		rec.Collection = newName
+		s.putLocked(key, rec)
+	})
+}
+
+// DeleteCollection empties the named collection and returns how many links it held. The
+// links themselves are kept outside any collection, or deleted with deleteLinks, into the
+// recycle bin when it is enabled.
+func (s *URLStore) DeleteCollection(name string, deleteLinks bool) (int, error) {
+	return s.updateCollection(name, func(key string, rec Record) {
+		if deleteLinks {
+			s.removeLinkLocked(key)
+			return
+		}
+		rec.Collection = ""
+		s.putLocked(key, rec)
+	})
+}
+
+// updateCollection calls fn with s.mu held for every link in the named collection, then
+// saves.
+func (s *URLStore) updateCollection(name string, fn func(key string, rec Record)) (int, error) {
+	if err := s.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.byCollection[name]))
+	for key := range s.byCollection[name] {
+		keys = append(keys, key) // fn changes the index, so collect keys first
+	}
+	if len(keys) == 0 {
+		return 0, ErrCollectionNotFound
+	}
+	for _, key := range keys {
+		if rec, found := s.urls[key]; found { // Deleting a link also deletes its aliases
+			fn(key, rec)
+		}
+	}
+
+	s.saveAsync()
+	return len(keys), nil
+}
+
+// handleCollection serves GET, PATCH and DELETE on /collections/{name} for admins.
+func (h *urlHandler) handleCollection(w http.ResponseWriter, r *http.Request, name string) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		links, clicks, err := h.store.Collection(name)
+		if err != nil {
+			storeError(w, r, err, "Failed to list collection")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Name   string     `json:"name"`
+			Clicks uint64     `json:"clicks"`
+			Links  []linkView `json:"links"`
+		}{name, clicks, links})
+
+	case http.MethodPatch:
+		if !h.requireJSONBody(w, r) {
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, "Error reading request body", http.StatusInternalServerError)
+			return
+		}
+		var requestData struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(body, &requestData); err != nil {
+			writeError(w, r, "Invalid JSON format", http.StatusBadRequest)
+			return
+		}
+		moved, err := h.store.RenameCollection(name, requestData.Name)
+		if err != nil {
+			storeError(w, r, err, "Failed to rename collection")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Name  string `json:"name"`
+			Links int    `json:"links"`
+		}{requestData.Name, moved})
+
+	case http.MethodDelete:
+		deleteLinks, err := strconv.ParseBool(r.URL.Query().Get("deleteLinks"))
+		if err != nil && r.URL.Query().Has("deleteLinks") {
+			writeError(w, r, "DeleteLinks must be true or false", http.StatusBadRequest)
+			return
+		}
+		if _, err := h.store.DeleteCollection(name, deleteLinks); err != nil {
+			storeError(w, r, err, "Failed to delete collection")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
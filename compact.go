@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// =======================================================================================
+// Compaction - Rewrites the data file with only live links. Expired links are already
+// skipped when the file is loaded, but they stay on disk until the next save, so a store
+// that rarely changes keeps carrying them. Compaction also drops aliases left pointing at
+// a deleted link, unless SHORTY_ALIAS_ON_DELETE=orphan asks to keep them. It runs at
+// startup with SHORTY_COMPACT_ON_START, or on demand with POST /shorty/purge.
+// =======================================================================================
+
+// Compact removes dead entries and saves the store, returning how many were removed.
+func (s *URLStore) Compact() (int, error) {
+	if err := s.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	var dead []string
+	for key, rec := range s.urls {
+		if rec.removable(now, s.cfg.RecycleBinRetention) {
+			dead = append(dead, key)
+			continue
+		}
+		if rec.inBin() {
+			continue // Kept for restoring until its retention ends
+		}
+		if rec.AliasOf != "" && s.cfg.AliasOnDelete != AliasDeleteOrphan {
+			if _, found := s.urls[rec.AliasOf]; !found {
+				dead = append(dead, key)
+			}
+		}
+	}
+	for _, key := range dead {
+		if rec := s.urls[key]; rec.inBin() {
+			// Its deletion was announced when it was binned.
+		} else if rec.expired(now) {
+			s.emit(EventExpired, key, rec)
+		} else {
+			s.emit(EventDeleted, key, rec)
+		}
+		s.deleteLocked(key)
+	}
+	s.mu.Unlock()
+
+	err := s.save(context.Background())
+	s.recordSave(err)
+	if err != nil {
+		return 0, err
+	}
+	slog.Info("Compacted data file", "file", s.filename, "removed", len(dead))
+	return len(dead), nil
+}
+
+// handlePurge serves POST /shorty/purge, compacting the store right away.
+func (h *urlHandler) handlePurge(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	purged, err := h.store.Compact()
+	if err != nil {
+		storeError(w, r, err, "Failed to purge links")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Purged int `json:"purged"`
+	}{purged})
+}
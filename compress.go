@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// =======================================================================================
+// Compression - A data file named with a .gz extension is written gzip-compressed, which
+// keeps large link sets small on disk. Compression happens before encryption, since
+// encrypted data doesn't compress. Loading recognizes gzip data by its magic bytes, so
+// plain and compressed files are read alike whatever they are called.
+// =======================================================================================
+
+const compressedExt = ".gz"
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func isCompressedFile(filename string) bool {
+	return strings.HasSuffix(filename, compressedExt)
+}
+
+func compressData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressData inflates data written by compressData. Data without the gzip magic bytes
+// is returned unchanged.
+func decompressData(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
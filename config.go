@@ -0,0 +1,1006 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =======================================================================================
+// Configuration - Runtime settings are read from SHORTY_* environment variables so the
+// server can be tuned per deployment without rebuilding the binary.
+// =======================================================================================
+
+type Config struct {
+	// AdminToken is the bearer token for admin endpoints such as export and import.
+	// Those endpoints are disabled while it is empty.
+	AdminToken string
+
+	// APIKeys identify link owners by bearer token. OwnerQuota caps how many links each
+	// owner may store (zero means unlimited); OwnerQuotas overrides it per owner.
+	APIKeys     []APIKey
+	OwnerQuota  int
+	OwnerQuotas map[string]int
+	// CustomKeysRequireAuth limits customKey and aliases to requests carrying an API key
+	// or the admin token, so anonymous clients can't squat vanity keys. Anonymous creates
+	// with generated keys stay open.
+	CustomKeysRequireAuth bool
+
+	// CreatorIP records the address of the client that created each link for auditing:
+	// ClickIPFull, ClickIPHash or ClickIPOmit (default). Hashes are salted with
+	// IPHashSalt, which stays fixed across restarts so a suspect address can be checked
+	// against stored hashes later.
+	CreatorIP  string
+	IPHashSalt []byte
+	// TrustedProxies are the peers whose X-Forwarded-For header is believed when working
+	// out a client's address, for click events and creator IPs alike. Requests from any
+	// other peer use the connection's address. See clientip.go.
+	TrustedProxies []netip.Prefix
+
+	// EncryptionKey, when set, encrypts the data file at rest with AES-GCM. It is read
+	// from SHORTY_ENCRYPTION_KEY as base64 and must decode to 16, 24 or 32 bytes.
+	EncryptionKey []byte
+	// URLIndexSalt, read from SHORTY_URL_INDEX_SALT, keys the index of destinations used to
+	// find duplicate URLs by a salted hash instead of the plain URL. See duplicates.go.
+	URLIndexSalt []byte
+	// SigningKey enables stateless signed keys (POST /shorty?mode=signed), authenticated
+	// with HMAC-SHA256 under this key. It is read from SHORTY_SIGNING_KEY as base64 and
+	// must decode to at least 16 bytes. Changing it invalidates every signed key.
+	SigningKey []byte
+	// DeletionKey makes creates return a token that deletes the new link, an HMAC-SHA256
+	// under this key; see deletetoken.go. It is read from SHORTY_DELETION_KEY as base64
+	// and must decode to at least 16 bytes. Changing it invalidates every token.
+	DeletionKey []byte
+
+	// PathPrefix serves every route under a subpath such as "/go", for deployments
+	// behind a proxy that share the host with other content. Empty serves from the root.
+	PathPrefix string
+	// KeepSlashes routes paths exactly as sent. By default runs of slashes are collapsed,
+	// so "//abc123" and "/go//abc123" find the same link as "/abc123" and "/go/abc123".
+	KeepSlashes bool
+	// RawPaths routes on the path as sent, percent-encoding included. By default keys are
+	// matched after decoding, so "/abc%31%32%33" finds the link "abc123".
+	RawPaths bool
+	// BaseURL is the public URL short links are served under, such as "https://sho.rt/go",
+	// used for the Location header of creates. Empty uses a path relative to the host the
+	// client called, which suits servers reached on several vanity domains.
+	BaseURL string
+
+	// SyncWrites makes POST /shorty wait until the new link is saved, bounded by the
+	// request's context, instead of answering while the save runs in the background.
+	SyncWrites bool
+	// SaveFailure decides whether a create whose synchronous save fails is kept in memory
+	// or undone; see rollback.go.
+	SaveFailure string
+
+	// StrictContentType rejects JSON request bodies not labelled application/json with
+	// 415 instead of trying to parse them anyway.
+	StrictContentType bool
+
+	// StrictQuery rejects query parameters /shorty doesn't read; see shortyquery.go.
+	StrictQuery bool
+
+	// DebugState serves GET /debug/state to admins; see debugstate.go.
+	DebugState bool
+
+	// ReadOnly serves the loaded data without ever changing or saving it, for replicas.
+	ReadOnly bool
+
+	// AllowEmptySave lets a store that has held no links overwrite a non-empty data file;
+	// see emptysave.go.
+	AllowEmptySave bool
+
+	// StatsETagClicks includes clicks in the ETags of stats responses, so a new click
+	// counts as a change; see etag.go.
+	StatsETagClicks bool
+
+	// LoadBytesPerLink is the data file size per link assumed to size the link map when
+	// loading; zero lets the map grow as links are read. See stream.go.
+	LoadBytesPerLink int
+	// WatchFile reloads the data file when another process changes it.
+	WatchFile bool
+	// CompactOnStart rewrites the data file with only live links at startup.
+	CompactOnStart bool
+	// Storage selects how the store is persisted: StorageJSON (default), one file
+	// rewritten on every save, or StorageBolt, an embedded database written per link.
+	Storage string
+	// StoragePrefix is prepended to every key stored by StorageBolt, so the database can
+	// be shared with other data.
+	StoragePrefix string
+	// SecondaryStorage, StorageJSON or StorageBolt, copies every save to SecondaryFile
+	// as well; see secondary.go. Empty (default) writes only the primary.
+	SecondaryStorage string
+	SecondaryFile    string
+	// CompressData stores the data file gzip-compressed as urls.json.gz. An existing
+	// urls.json is loaded when there is no compressed file yet.
+	CompressData bool
+	// DailyFiles saves to a file per day, keeping this many, with the data file a symlink
+	// to the current one; see daily.go. Zero saves to the data file itself.
+	DailyFiles int
+	// PrettyData writes the data file as indented JSON, for stores kept in version
+	// control. It makes the file larger, so it is off by default.
+	PrettyData bool
+
+	// SaveFailureThreshold makes Add fail with 503 after this many consecutive failed
+	// saves, instead of accepting links that only live in memory. Zero disables it.
+	SaveFailureThreshold int
+	// SaveStaleAfter makes /healthz report a warning once a change has waited this long
+	// without being saved. Zero disables the warning.
+	SaveStaleAfter time.Duration
+
+	// StaticDir, when set, is a directory of files served under StaticPrefix; see
+	// static.go.
+	StaticDir    string
+	StaticPrefix string
+
+	// WelcomeTemplate is the path of an html/template file rendered for the root path.
+	// Its data is welcomeData. Empty keeps the built-in plain-text welcome.
+	WelcomeTemplate string
+	// WelcomeStatus and WelcomeContentType are the status and Content-Type of the welcome
+	// page. An empty content type is text/plain for the built-in text and text/html for
+	// WelcomeTemplate.
+	WelcomeStatus      int
+	WelcomeContentType string
+	// RootRedirect sends requests for the root path to this URL instead of showing a
+	// welcome page. It cannot be combined with WelcomeTemplate.
+	RootRedirect string
+	// RootResponse selects what the root path answers: RootWelcome, RootNotFound,
+	// RootNoContent or RootRedirectTo. It defaults to RootRedirectTo when RootRedirect is
+	// set and RootWelcome otherwise.
+	RootResponse string
+
+	// ExpiredRedirect sends requests for expired links to this URL, such as a
+	// "this link has expired" page, instead of answering 410 Gone.
+	ExpiredRedirect string
+
+	// LogLevel is the minimum level written to the log: debug, info, warn or error.
+	LogLevel slog.Level
+	// LogFile, when set, receives the log as JSON lines instead of stderr. It and an
+	// AccessLog file are rotated past LogMaxBytes, keeping LogMaxFiles old copies; see
+	// logfile.go.
+	LogFile     string
+	LogMaxBytes int
+	LogMaxFiles int
+
+	// AllowedHosts, when non-empty, restricts destinations to these hosts.
+	// An entry starting with a dot (".mycorp.com") matches that domain and all subdomains.
+	AllowedHosts []string
+	// BlockedHosts rejects destinations on these hosts, using the same matching rules.
+	BlockedHosts []string
+	// ShortenerHosts are other URL shorteners, rejected as destinations unless listed in
+	// AllowedHosts; see shorteners.go. Empty when SHORTY_BLOCK_SHORTENERS is off.
+	ShortenerHosts []string
+
+	// CheckDestination probes the destination of POST /shorty before storing it:
+	// CheckOff (default), CheckWarn logs a failed probe and CheckReject refuses the link.
+	// Each probe gives up after CheckTimeout.
+	CheckDestination string
+	CheckTimeout     time.Duration
+
+	// SelfHosts are the hostnames this server is reached on, matched like AllowedHosts.
+	// SelfLinks decides what happens to destinations that are short links on one of them:
+	// SelfLinkAllow (default) stores them as is, SelfLinkFlatten stores the final
+	// destination instead and SelfLinkReject refuses them.
+	SelfHosts []string
+	SelfLinks string
+	// MaxChainDepth limits how many local hops a new link under SelfLinkAllow may start,
+	// itself included, before reaching a real destination. Zero means no limit.
+	MaxChainDepth int
+
+	// KeyStrategy selects how keys are minted when no custom key is given:
+	// KeyStrategyRandom (default), KeyStrategyHash, which derives the key from the URL, or
+	// KeyStrategyCounter, which numbers links sequentially.
+	KeyStrategy string
+
+	// CreateMethods lists the methods that create a link on /shorty: POST (the default)
+	// and PUT with a JSON body, and GET with the fields as query parameters.
+	CreateMethods []string
+
+	// LenientCustomKey accepts a JSON number as the customKey of POST /shorty, using its
+	// decimal form as the key. Otherwise a number is rejected with a field-specific error.
+	LenientCustomKey bool
+
+	// DuplicateURLs decides what a create without a custom key does when the URL already
+	// has a link: DuplicateAllow (default) mints a new key, DuplicateDedupe returns the
+	// existing one and DuplicateReject fails with 409 naming it.
+	DuplicateURLs string
+	// TrackingParams are query parameters ignored when looking for duplicate URLs; see
+	// tracking.go. Empty when SHORTY_DEDUPE_IGNORE_TRACKING is off.
+	TrackingParams []string
+
+	// MinCustomKeyLength rejects shorter custom keys from non-admin requests, keeping
+	// short vanity keys from being squatted. ReserveSingleCharKeys additionally keeps
+	// one-character keys for admin requests regardless of the minimum.
+	MinCustomKeyLength    int
+	ReserveSingleCharKeys bool
+	// GeneratedKeyConflict decides what a custom key request does when the key holds a
+	// link whose key was generated: GeneratedKeyReject (default) fails with 409,
+	// GeneratedKeyRelocate moves that link to a new generated key first and
+	// GeneratedKeyReplace overwrites it.
+	GeneratedKeyConflict string
+	// CustomKeyConflict decides what a custom key request does when the key holds a link
+	// with a custom key: CustomKeyReplace (default) overwrites it and CustomKeyReject
+	// fails with 409.
+	CustomKeyConflict string
+	// ASCIIHosts stores internationalized destination hosts in their punycode form and
+	// matches host rules against it.
+	ASCIIHosts bool
+	// ReserveGeneratedKeys rejects custom keys, even from admins, that the configured
+	// KeyStrategy could generate, so the two namespaces never meet.
+	ReserveGeneratedKeys bool
+	// BlockedKeyWords are words, lowercased, that no key may match; BlockedKeyMatch is
+	// KeyMatchExact (default) or KeyMatchSubstring. See blockedwords.go.
+	BlockedKeyWords []string
+	BlockedKeyMatch string
+
+	// AliasOnDelete decides what happens to a link's aliases when it is deleted or
+	// evicted: AliasDeleteCascade (default) removes them, AliasDeleteOrphan keeps them.
+	AliasOnDelete string
+	// MaxAliases caps the aliases a link may have, counted from the store's alias index;
+	// zero means unlimited.
+	MaxAliases int
+
+	// MaxLinks caps the number of stored links; zero means unlimited.
+	MaxLinks int
+	// EvictionPolicy decides what happens when MaxLinks is reached: EvictReject refuses
+	// new links, EvictLRU drops the least recently used one to make room.
+	EvictionPolicy string
+
+	// RedirectMode is how links send visitors on unless they set their own: RedirectHTTP
+	// (default) answers with a 3xx status, RedirectHTML with a page that refreshes to the
+	// destination.
+	RedirectMode string
+	// ProxyLinks allows links with RedirectProxy, served by fetching the destination
+	// within ProxyTimeout and ProxyMaxBytes, for ProxyContentTypes only. See proxy.go.
+	ProxyLinks        bool
+	ProxyTimeout      time.Duration
+	ProxyMaxBytes     int
+	ProxyContentTypes []string
+	// LinkPreviews serves GET /{shortKey}/preview, fetching the destination's Open Graph
+	// metadata; see preview.go.
+	LinkPreviews bool
+	// PreviewConcurrency bounds how many previews are fetched at once.
+	PreviewConcurrency int
+	// Challenge makes anonymous creates prove themselves: ChallengeProofOfWork with
+	// ChallengeDifficulty leading zero bits, or ChallengeHCaptcha checked with
+	// ChallengeSecret; see challenge.go. Empty disables it.
+	Challenge           string
+	ChallengeDifficulty int
+	ChallengeSecret     string
+	// GeoIPDB is the MaxMind database that links with country targets look visitors up
+	// in; see geo.go. Empty disables country targets.
+	GeoIPDB string
+	// StickyVariants keeps a visitor on the variant of a split link they were first sent
+	// to, with a cookie; see variant.go.
+	StickyVariants bool
+	// FailoverInterval is how often the destinations of links with fallbacks are checked;
+	// zero sends visitors to the primary without checking. See failover.go.
+	FailoverInterval time.Duration
+	// DisplayURLs stores a short readable form of each new link's destination; see
+	// display.go.
+	DisplayURLs bool
+	// CollapseURLSlashes stores runs of slashes in destination paths as one; see slashes.go.
+	CollapseURLSlashes bool
+	// HTTPSDestinations rejects or upgrades http:// destinations; see https.go.
+	HTTPSDestinations string
+	// PreserveMethod makes links without their own RedirectStatus answer 307, or 308 when
+	// permanent, so clients repeat the request with its method and body.
+	PreserveMethod bool
+
+	// PermanentCacheMaxAge is how long browsers and CDNs may cache the 301 redirect of a
+	// permanent link. Zero sends no-cache, so every visit still reaches the server.
+	PermanentCacheMaxAge time.Duration
+
+	// DefaultTTL is how long links created without an expiresIn live; zero means they
+	// never expire.
+	DefaultTTL time.Duration
+
+	// RecycleBinRetention is how long deleted links are kept for POST /{key}/restore
+	// before they are purged; zero deletes links right away.
+	RecycleBinRetention time.Duration
+
+	// CountHeadClicks counts HEAD requests to a short link as clicks. Off by default
+	// because crawlers and link checkers probe links this way.
+	CountHeadClicks bool
+
+	// ClickPersistence selects how click counts are written: ClickPersistNone,
+	// ClickPersistEventual (default, flushed every ClickFlushInterval) or
+	// ClickPersistStrict (saved on every click). See clickpersist.go for the tradeoffs.
+	ClickPersistence   string
+	ClickFlushInterval time.Duration
+
+	// ClickLog enables the structured click event log: "stdout" or the path of a file
+	// to append JSON lines to. Empty disables it.
+	ClickLog string
+	// ClickLogIP controls how client IPs appear in click events, both in the log and in
+	// webhook payloads: ClickIPFull, ClickIPHash or ClickIPOmit.
+	ClickLogIP string
+	// AccessLog writes a line per request in AccessLogFormat, AccessLogCommon or
+	// AccessLogCombined, to "stdout" or the path of a file; see accesslog.go. Empty only
+	// logs requests at debug level.
+	AccessLog       string
+	AccessLogFormat string
+	// ClickWebhookURL, when set, receives a POST with the click event for every redirect.
+	ClickWebhookURL string
+	// ClickWebhookSecret, when set, signs every webhook delivery; see webhooksign.go.
+	ClickWebhookSecret []byte
+	// ClickLogQueueSize and ClickWebhookQueueSize bound the events waiting to be written
+	// and delivered. ClickQueueFull, QueueFullDrop (default) or QueueFullBlock, decides
+	// what happens to an event whose queue is full.
+	ClickLogQueueSize     int
+	ClickWebhookQueueSize int
+	ClickQueueFull        string
+
+	// MaxConcurrentLookups and MaxConcurrentCreates cap in-flight GET/HEAD requests and
+	// all other requests respectively; zero means unlimited.
+	MaxConcurrentLookups int
+	MaxConcurrentCreates int
+	// RateLimit caps requests per minute from each client, zero meaning unlimited.
+	// RateLimitBy tells clients apart by RateLimitByIP (default) or RateLimitByAPIKey, and
+	// RateLimitKeys overrides the limit per API key owner in the latter mode.
+	RateLimit     int
+	RateLimitBy   string
+	RateLimitKeys map[string]int
+	// RateLimitHeaders sends X-RateLimit-Limit and X-RateLimit-Remaining with requests
+	// RateLimit applies to, and RateLimitMessage is the body of a 429.
+	RateLimitHeaders bool
+	RateLimitMessage string
+	// KeyRateLimit caps redirects per minute through each short key; zero means unlimited.
+	KeyRateLimit int
+	// MissDelay, when set, delays each redirect to an unknown key by a random time up to
+	// it, so response timing doesn't tell enumerators which keys exist. See missdelay.go.
+	MissDelay time.Duration
+
+	// GzipLevel compresses responses for clients that accept gzip, from 1 (fastest) to 9
+	// (smallest); zero disables compression. Bodies smaller than GzipMinSize bytes are
+	// sent as is. GzipRouteMinSizes overrides the threshold per route class (see
+	// compressionRoutes), where a negative size never compresses that route.
+	GzipLevel         int
+	GzipMinSize       int
+	GzipRouteMinSizes map[string]int
+
+	// CORSOrigins lists the origins allowed to read each route class from a browser; see
+	// cors.go. Route classes without an entry, redirects among them, send no CORS headers.
+	CORSOrigins map[string][]string
+}
+
+const (
+	EvictReject = "reject"
+	EvictLRU    = "lru"
+)
+
+func loadConfig() (Config, error) {
+	cfg := Config{
+		CreatorIP:            envString("SHORTY_CREATOR_IP", ClickIPOmit),
+		IPHashSalt:           []byte(os.Getenv("SHORTY_IP_HASH_SALT")),
+		URLIndexSalt:         []byte(os.Getenv("SHORTY_URL_INDEX_SALT")),
+		CheckDestination:     envString("SHORTY_CHECK_DESTINATION", CheckOff),
+		SelfLinks:            envString("SHORTY_SELF_LINKS", SelfLinkAllow),
+		SelfHosts:            envList("SHORTY_SELF_HOSTS"),
+		DuplicateURLs:        envString("SHORTY_DUPLICATE_URLS", DuplicateAllow),
+		ExpiredRedirect:      envString("SHORTY_EXPIRED_REDIRECT", ""),
+		AliasOnDelete:        envString("SHORTY_ALIAS_ON_DELETE", AliasDeleteCascade),
+		RootRedirect:         envString("SHORTY_ROOT_REDIRECT", ""),
+		RootResponse:         envString("SHORTY_ROOT_RESPONSE", ""),
+		RedirectMode:         envString("SHORTY_REDIRECT_MODE", RedirectHTTP),
+		GeneratedKeyConflict: envString("SHORTY_GENERATED_KEY_CONFLICT", GeneratedKeyReject),
+		CustomKeyConflict:    envString("SHORTY_CUSTOM_KEY_CONFLICT", CustomKeyReplace),
+		SaveFailure:          envString("SHORTY_SAVE_FAILURE", SaveFailureRetain),
+		HTTPSDestinations:    envString("SHORTY_HTTPS_DESTINATIONS", HTTPSOff),
+		RateLimitBy:          envString("SHORTY_RATE_LIMIT_BY", RateLimitByIP),
+		RateLimitMessage:     envString("SHORTY_RATE_LIMIT_MESSAGE", defaultRateLimitMessage),
+		Storage:              envString("SHORTY_STORAGE", StorageJSON),
+		StoragePrefix:        os.Getenv("SHORTY_STORAGE_PREFIX"),
+		SecondaryStorage:     os.Getenv("SHORTY_SECONDARY_STORAGE"),
+		SecondaryFile:        os.Getenv("SHORTY_SECONDARY_FILE"),
+		ClickPersistence:     envString("SHORTY_CLICK_PERSISTENCE", ClickPersistEventual),
+		WelcomeTemplate:      os.Getenv("SHORTY_WELCOME_TEMPLATE"),
+		StaticDir:            os.Getenv("SHORTY_STATIC_DIR"),
+		StaticPrefix:         envString("SHORTY_STATIC_PREFIX", defaultStaticPrefix),
+		WelcomeContentType:   os.Getenv("SHORTY_WELCOME_CONTENT_TYPE"),
+		KeyStrategy:          envString("SHORTY_KEY_STRATEGY", KeyStrategyRandom),
+		BlockedKeyWords:      envList("SHORTY_BLOCKED_KEY_WORDS"),
+		BlockedKeyMatch:      envString("SHORTY_BLOCKED_KEY_MATCH", KeyMatchExact),
+		PathPrefix:           normalizePathPrefix(os.Getenv("SHORTY_PATH_PREFIX")),
+		BaseURL:              strings.TrimRight(envString("SHORTY_BASE_URL", ""), "/"),
+		AdminToken:           os.Getenv("SHORTY_ADMIN_TOKEN"),
+		AllowedHosts:         envList("SHORTY_ALLOWED_HOSTS"),
+		BlockedHosts:         envList("SHORTY_BLOCKED_HOSTS"),
+		EvictionPolicy:       envString("SHORTY_EVICTION_POLICY", EvictReject),
+		ClickLog:             envString("SHORTY_CLICK_LOG", ""),
+		ClickLogIP:           envString("SHORTY_CLICK_LOG_IP", ClickIPFull),
+		LogFile:              os.Getenv("SHORTY_LOG_FILE"),
+		AccessLog:            envString("SHORTY_ACCESS_LOG", ""),
+		AccessLogFormat:      envString("SHORTY_ACCESS_LOG_FORMAT", AccessLogCommon),
+		ClickWebhookURL:      envString("SHORTY_CLICK_WEBHOOK_URL", ""),
+		ClickWebhookSecret:   []byte(os.Getenv("SHORTY_CLICK_WEBHOOK_SECRET")),
+		ClickQueueFull:       envString("SHORTY_CLICK_QUEUE_FULL", QueueFullDrop),
+	}
+
+	var err error
+	if err = cfg.LogLevel.UnmarshalText([]byte(envString("SHORTY_LOG_LEVEL", "info"))); err != nil {
+		return Config{}, fmt.Errorf("SHORTY_LOG_LEVEL must be debug, info, warn or error: %w", err)
+	}
+	if key := os.Getenv("SHORTY_ENCRYPTION_KEY"); key != "" {
+		if cfg.EncryptionKey, err = base64.StdEncoding.DecodeString(key); err != nil {
+			return Config{}, fmt.Errorf("SHORTY_ENCRYPTION_KEY must be base64: %w", err)
+		}
+		if n := len(cfg.EncryptionKey); n != 16 && n != 24 && n != 32 {
+			return Config{}, errors.New("SHORTY_ENCRYPTION_KEY must decode to 16, 24 or 32 bytes")
+		}
+	}
+	if key := os.Getenv("SHORTY_SIGNING_KEY"); key != "" {
+		if cfg.SigningKey, err = base64.StdEncoding.DecodeString(key); err != nil {
+			return Config{}, fmt.Errorf("SHORTY_SIGNING_KEY must be base64: %w", err)
+		}
+		if len(cfg.SigningKey) < 16 {
+			return Config{}, errors.New("SHORTY_SIGNING_KEY must decode to at least 16 bytes")
+		}
+	}
+	if key := os.Getenv("SHORTY_DELETION_KEY"); key != "" {
+		if cfg.DeletionKey, err = base64.StdEncoding.DecodeString(key); err != nil {
+			return Config{}, fmt.Errorf("SHORTY_DELETION_KEY must be base64: %w", err)
+		}
+		if len(cfg.DeletionKey) < 16 {
+			return Config{}, errors.New("SHORTY_DELETION_KEY must decode to at least 16 bytes")
+		}
+	}
+	if cfg.APIKeys, err = parseAPIKeys(envList("SHORTY_API_KEYS")); err != nil {
+		return Config{}, err
+	}
+	if cfg.TrustedProxies, err = parseTrustedProxies(envList("SHORTY_TRUSTED_PROXIES")); err != nil {
+		return Config{}, err
+	}
+	if cfg.OwnerQuota, err = envInt("SHORTY_OWNER_QUOTA", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.OwnerQuotas, err = parseOwnerQuotas(envList("SHORTY_OWNER_QUOTAS")); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxLinks, err = envInt("SHORTY_MAX_LINKS", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxAliases, err = envInt("SHORTY_MAX_ALIASES", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxConcurrentLookups, err = envInt("SHORTY_MAX_CONCURRENT_LOOKUPS", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxConcurrentCreates, err = envInt("SHORTY_MAX_CONCURRENT_CREATES", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateLimit, err = envInt("SHORTY_RATE_LIMIT", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateLimitHeaders, err = envBool("SHORTY_RATE_LIMIT_HEADERS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateLimitKeys, err = parseRateLimits(envList("SHORTY_RATE_LIMIT_KEYS")); err != nil {
+		return Config{}, err
+	}
+	if cfg.KeyRateLimit, err = envInt("SHORTY_KEY_RATE_LIMIT", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.GzipLevel, err = envInt("SHORTY_GZIP_LEVEL", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.GzipMinSize, err = envInt("SHORTY_GZIP_MIN_SIZE", 1024); err != nil {
+		return Config{}, err
+	}
+	if cfg.GzipRouteMinSizes, err = parseCompressionThresholds(envList("SHORTY_GZIP_ROUTE_MIN_SIZES")); err != nil {
+		return Config{}, err
+	}
+	if cfg.CORSOrigins, err = parseCORSOrigins(envList("SHORTY_CORS_ROUTE_ORIGINS")); err != nil {
+		return Config{}, err
+	}
+	if cfg.SaveFailureThreshold, err = envInt("SHORTY_SAVE_FAILURE_THRESHOLD", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.MinCustomKeyLength, err = envInt("SHORTY_MIN_CUSTOM_KEY_LENGTH", 1); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReserveSingleCharKeys, err = envBool("SHORTY_RESERVE_SINGLE_CHAR_KEYS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.CreateMethods, err = parseCreateMethods(envList("SHORTY_CREATE_METHODS")); err != nil {
+		return Config{}, err
+	}
+	if cfg.LenientCustomKey, err = envBool("SHORTY_LENIENT_CUSTOM_KEY", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.CustomKeysRequireAuth, err = envBool("SHORTY_CUSTOM_KEYS_REQUIRE_AUTH", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.ASCIIHosts, err = envBool("SHORTY_ASCII_HOSTS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReserveGeneratedKeys, err = envBool("SHORTY_RESERVE_GENERATED_KEYS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.KeepSlashes, err = envBool("SHORTY_KEEP_SLASHES", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.RawPaths, err = envBool("SHORTY_RAW_PATHS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.StrictContentType, err = envBool("SHORTY_STRICT_CONTENT_TYPE", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.DebugState, err = envBool("SHORTY_DEBUG_STATE", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.StrictQuery, err = envBool("SHORTY_STRICT_QUERY", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.SyncWrites, err = envBool("SHORTY_SYNC_WRITES", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.CompressData, err = envBool("SHORTY_COMPRESS_DATA", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.PrettyData, err = envBool("SHORTY_PRETTY_DATA", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxChainDepth, err = envInt("SHORTY_MAX_CHAIN_DEPTH", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReadOnly, err = envBool("SHORTY_READ_ONLY", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.AllowEmptySave, err = envBool("SHORTY_ALLOW_EMPTY_SAVE", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.StatsETagClicks, err = envBool("SHORTY_STATS_ETAG_CLICKS", true); err != nil {
+		return Config{}, err
+	}
+	if cfg.WatchFile, err = envBool("SHORTY_WATCH_FILE", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.CompactOnStart, err = envBool("SHORTY_COMPACT_ON_START", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.CountHeadClicks, err = envBool("SHORTY_COUNT_HEAD_CLICKS", false); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.SaveStaleAfter, err = envDuration("SHORTY_SAVE_STALE_AFTER", defaultSaveStaleAfter); err != nil {
+		return Config{}, err
+	}
+	if cfg.CheckTimeout, err = envDuration("SHORTY_CHECK_TIMEOUT", defaultCheckTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.PreserveMethod, err = envBool("SHORTY_PRESERVE_METHOD", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.PermanentCacheMaxAge, err = envDuration("SHORTY_PERMANENT_CACHE_MAX_AGE", defaultPermanentCacheMaxAge); err != nil {
+		return Config{}, err
+	}
+	if cfg.DefaultTTL, err = envDuration("SHORTY_DEFAULT_TTL", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.RecycleBinRetention, err = envDuration("SHORTY_RECYCLE_BIN_RETENTION", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.ClickFlushInterval, err = envDuration("SHORTY_CLICK_FLUSH_INTERVAL", defaultClickFlushInterval); err != nil {
+		return Config{}, err
+	}
+	if cfg.MissDelay, err = envDuration("SHORTY_MISS_DELAY", 0); err != nil {
+		return Config{}, err
+	}
+	cfg.GeoIPDB = os.Getenv("SHORTY_GEOIP_DB")
+	if cfg.DailyFiles, err = envInt("SHORTY_DAILY_FILES", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.LinkPreviews, err = envBool("SHORTY_LINK_PREVIEWS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.PreviewConcurrency, err = envInt("SHORTY_PREVIEW_CONCURRENCY", defaultPreviewConcurrency); err != nil {
+		return Config{}, err
+	}
+	if cfg.ClickLogQueueSize, err = envInt("SHORTY_CLICK_LOG_QUEUE_SIZE", defaultClickQueueSize); err != nil {
+		return Config{}, err
+	}
+	if cfg.ClickWebhookQueueSize, err = envInt("SHORTY_CLICK_WEBHOOK_QUEUE_SIZE", defaultWebhookQueueSize); err != nil {
+		return Config{}, err
+	}
+	cfg.Challenge = envString("SHORTY_CHALLENGE", "")
+	cfg.ChallengeSecret = envString("SHORTY_CHALLENGE_SECRET", "")
+	if cfg.ChallengeDifficulty, err = envInt("SHORTY_CHALLENGE_DIFFICULTY", defaultChallengeDifficulty); err != nil {
+		return Config{}, err
+	}
+	if cfg.CollapseURLSlashes, err = envBool("SHORTY_COLLAPSE_URL_SLASHES", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.WelcomeStatus, err = envInt("SHORTY_WELCOME_STATUS", http.StatusOK); err != nil {
+		return Config{}, err
+	}
+	if cfg.StickyVariants, err = envBool("SHORTY_STICKY_VARIANTS", true); err != nil {
+		return Config{}, err
+	}
+	if cfg.DisplayURLs, err = envBool("SHORTY_DISPLAY_URLS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.FailoverInterval, err = envDuration("SHORTY_FAILOVER_INTERVAL", defaultFailoverInterval); err != nil {
+		return Config{}, err
+	}
+	if cfg.ProxyLinks, err = envBool("SHORTY_PROXY_LINKS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.ProxyTimeout, err = envDuration("SHORTY_PROXY_TIMEOUT", defaultProxyTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.ProxyMaxBytes, err = envInt("SHORTY_PROXY_MAX_BYTES", defaultProxyMaxBytes); err != nil {
+		return Config{}, err
+	}
+	if cfg.LoadBytesPerLink, err = envInt("SHORTY_LOAD_BYTES_PER_LINK", defaultLoadBytesPerLink); err != nil {
+		return Config{}, err
+	}
+	if cfg.LogMaxBytes, err = envInt("SHORTY_LOG_MAX_BYTES", defaultLogMaxBytes); err != nil {
+		return Config{}, err
+	}
+	if cfg.LogMaxFiles, err = envInt("SHORTY_LOG_MAX_FILES", defaultLogMaxFiles); err != nil {
+		return Config{}, err
+	}
+	if cfg.ProxyContentTypes = envList("SHORTY_PROXY_CONTENT_TYPES"); len(cfg.ProxyContentTypes) == 0 {
+		cfg.ProxyContentTypes = defaultProxyContentTypes
+	}
+
+	blockShorteners, err := envBool("SHORTY_BLOCK_SHORTENERS", true)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.ShortenerHosts = shortenerHosts(blockShorteners, envList("SHORTY_SHORTENER_HOSTS"))
+	ignoreTracking, err := envBool("SHORTY_DEDUPE_IGNORE_TRACKING", false)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.TrackingParams = trackingParams(ignoreTracking, envList("SHORTY_TRACKING_PARAMS"))
+
+	if len(cfg.AllowedHosts) > 0 && len(cfg.BlockedHosts) > 0 {
+		return Config{}, errors.New("SHORTY_ALLOWED_HOSTS and SHORTY_BLOCKED_HOSTS are mutually exclusive")
+	}
+	for _, key := range cfg.APIKeys {
+		if key.Token == cfg.AdminToken {
+			return Config{}, errors.New("SHORTY_API_KEYS tokens must differ from SHORTY_ADMIN_TOKEN")
+		}
+	}
+	if cfg.OwnerQuota < 0 {
+		return Config{}, errors.New("SHORTY_OWNER_QUOTA must not be negative")
+	}
+	if cfg.MaxLinks < 0 {
+		return Config{}, errors.New("SHORTY_MAX_LINKS must not be negative")
+	}
+	if cfg.MaxAliases < 0 {
+		return Config{}, errors.New("SHORTY_MAX_ALIASES must not be negative")
+	}
+	if cfg.MinCustomKeyLength < 1 || cfg.MinCustomKeyLength > maxKeyLength {
+		return Config{}, fmt.Errorf("SHORTY_MIN_CUSTOM_KEY_LENGTH must be between 1 and %d", maxKeyLength)
+	}
+	if cfg.SaveFailureThreshold < 0 {
+		return Config{}, errors.New("SHORTY_SAVE_FAILURE_THRESHOLD must not be negative")
+	}
+	if cfg.SaveStaleAfter < 0 {
+		return Config{}, errors.New("SHORTY_SAVE_STALE_AFTER must not be negative")
+	}
+	if cfg.GzipLevel < 0 || cfg.GzipLevel > 9 {
+		return Config{}, errors.New("SHORTY_GZIP_LEVEL must be between 0 and 9")
+	}
+	if cfg.GzipMinSize < 0 {
+		return Config{}, errors.New("SHORTY_GZIP_MIN_SIZE must not be negative")
+	}
+	if cfg.MaxConcurrentLookups < 0 || cfg.MaxConcurrentCreates < 0 {
+		return Config{}, errors.New("SHORTY_MAX_CONCURRENT_LOOKUPS and SHORTY_MAX_CONCURRENT_CREATES must not be negative")
+	}
+	if cfg.Storage != StorageJSON && cfg.Storage != StorageBolt {
+		return Config{}, fmt.Errorf("SHORTY_STORAGE must be %q or %q", StorageJSON, StorageBolt)
+	}
+	if cfg.ReadOnly && cfg.CompactOnStart {
+		return Config{}, errors.New("SHORTY_COMPACT_ON_START can't be used with SHORTY_READ_ONLY")
+	}
+	switch cfg.SecondaryStorage {
+	case "":
+		if cfg.SecondaryFile != "" {
+			return Config{}, errors.New("SHORTY_SECONDARY_FILE requires SHORTY_SECONDARY_STORAGE")
+		}
+	case StorageJSON, StorageBolt:
+		if cfg.ReadOnly {
+			return Config{}, errors.New("SHORTY_SECONDARY_STORAGE can't be used with SHORTY_READ_ONLY")
+		}
+		if cfg.SecondaryFile == "" {
+			cfg.SecondaryFile = "urls.json"
+			if cfg.SecondaryStorage == StorageBolt {
+				cfg.SecondaryFile = "urls.db"
+			}
+		}
+	default:
+		return Config{}, fmt.Errorf("SHORTY_SECONDARY_STORAGE must be %q or %q", StorageJSON, StorageBolt)
+	}
+	if cfg.Storage != StorageBolt && cfg.StoragePrefix != "" {
+		return Config{}, errors.New("SHORTY_STORAGE_PREFIX only applies to SHORTY_STORAGE=bolt")
+	}
+	if cfg.Storage == StorageBolt && cfg.WatchFile {
+		return Config{}, errors.New("SHORTY_WATCH_FILE only applies to SHORTY_STORAGE=json")
+	}
+	if cfg.Storage == StorageBolt && cfg.CompressData {
+		return Config{}, errors.New("SHORTY_COMPRESS_DATA only applies to SHORTY_STORAGE=json")
+	}
+	if cfg.DailyFiles < 0 {
+		return Config{}, errors.New("SHORTY_DAILY_FILES must not be negative")
+	}
+	if cfg.Storage == StorageBolt && cfg.DailyFiles > 0 {
+		return Config{}, errors.New("SHORTY_DAILY_FILES only applies to SHORTY_STORAGE=json")
+	}
+	if cfg.Storage == StorageBolt && cfg.PrettyData {
+		return Config{}, errors.New("SHORTY_PRETTY_DATA only applies to SHORTY_STORAGE=json")
+	}
+	if cfg.PreviewConcurrency < 1 {
+		return Config{}, errors.New("SHORTY_PREVIEW_CONCURRENCY must be at least 1")
+	}
+	switch cfg.Challenge {
+	case "":
+	case ChallengeProofOfWork:
+		if cfg.ChallengeDifficulty < 1 || cfg.ChallengeDifficulty > maxChallengeDifficulty {
+			return Config{}, fmt.Errorf("SHORTY_CHALLENGE_DIFFICULTY must be between 1 and %d", maxChallengeDifficulty)
+		}
+	case ChallengeHCaptcha:
+		if cfg.ChallengeSecret == "" {
+			return Config{}, errors.New("SHORTY_CHALLENGE=hcaptcha requires SHORTY_CHALLENGE_SECRET")
+		}
+	default:
+		return Config{}, fmt.Errorf("SHORTY_CHALLENGE must be %q or %q", ChallengeProofOfWork, ChallengeHCaptcha)
+	}
+	if cfg.ProxyTimeout <= 0 || cfg.ProxyMaxBytes <= 0 {
+		return Config{}, errors.New("SHORTY_PROXY_TIMEOUT and SHORTY_PROXY_MAX_BYTES must be positive")
+	}
+	if cfg.MissDelay < 0 || cfg.MissDelay > maxMissDelay {
+		return Config{}, fmt.Errorf("SHORTY_MISS_DELAY must be between 0 and %s", maxMissDelay)
+	}
+	if cfg.RateLimit < 0 || cfg.KeyRateLimit < 0 {
+		return Config{}, errors.New("SHORTY_RATE_LIMIT and SHORTY_KEY_RATE_LIMIT must not be negative")
+	}
+	if cfg.RateLimitBy != RateLimitByIP && cfg.RateLimitBy != RateLimitByAPIKey {
+		return Config{}, fmt.Errorf("SHORTY_RATE_LIMIT_BY must be %q or %q", RateLimitByIP, RateLimitByAPIKey)
+	}
+	if len(cfg.RateLimitKeys) > 0 && cfg.RateLimitBy != RateLimitByAPIKey {
+		return Config{}, fmt.Errorf("SHORTY_RATE_LIMIT_KEYS requires SHORTY_RATE_LIMIT_BY=%s", RateLimitByAPIKey)
+	}
+	if cfg.EvictionPolicy != EvictReject && cfg.EvictionPolicy != EvictLRU {
+		return Config{}, fmt.Errorf("SHORTY_EVICTION_POLICY must be %q or %q", EvictReject, EvictLRU)
+	}
+	if cfg.ClickPersistence != ClickPersistNone && cfg.ClickPersistence != ClickPersistEventual && cfg.ClickPersistence != ClickPersistStrict {
+		return Config{}, fmt.Errorf("SHORTY_CLICK_PERSISTENCE must be %q, %q or %q", ClickPersistNone, ClickPersistEventual, ClickPersistStrict)
+	}
+	if cfg.CheckDestination != CheckOff && cfg.CheckDestination != CheckWarn && cfg.CheckDestination != CheckReject {
+		return Config{}, fmt.Errorf("SHORTY_CHECK_DESTINATION must be %q, %q or %q", CheckOff, CheckWarn, CheckReject)
+	}
+	if cfg.CheckTimeout <= 0 {
+		return Config{}, errors.New("SHORTY_CHECK_TIMEOUT must be positive")
+	}
+	if cfg.FailoverInterval < 0 {
+		return Config{}, errors.New("SHORTY_FAILOVER_INTERVAL must not be negative")
+	}
+	if cfg.DefaultTTL < 0 {
+		return Config{}, errors.New("SHORTY_DEFAULT_TTL must not be negative")
+	}
+	if cfg.RecycleBinRetention < 0 {
+		return Config{}, errors.New("SHORTY_RECYCLE_BIN_RETENTION must not be negative")
+	}
+	if cfg.PermanentCacheMaxAge < 0 {
+		return Config{}, errors.New("SHORTY_PERMANENT_CACHE_MAX_AGE must not be negative")
+	}
+	if cfg.ClickFlushInterval <= 0 {
+		return Config{}, errors.New("SHORTY_CLICK_FLUSH_INTERVAL must be positive")
+	}
+	if cfg.RootRedirect != "" && validateDestination(cfg.RootRedirect, Config{}) != nil {
+		return Config{}, errors.New("SHORTY_ROOT_REDIRECT must be an absolute http or https URL")
+	}
+	if cfg.ExpiredRedirect != "" && validateDestination(cfg.ExpiredRedirect, Config{}) != nil {
+		return Config{}, errors.New("SHORTY_EXPIRED_REDIRECT must be an absolute http or https URL")
+	}
+	if cfg.WelcomeStatus < 200 || cfg.WelcomeStatus > 599 || cfg.WelcomeStatus >= 300 && cfg.WelcomeStatus < 400 ||
+		cfg.WelcomeStatus == http.StatusNoContent || cfg.WelcomeStatus == http.StatusResetContent {
+		return Config{}, errors.New("SHORTY_WELCOME_STATUS must be a 2xx, 4xx or 5xx status with a body; use SHORTY_ROOT_REDIRECT for redirects")
+	}
+	if cfg.WelcomeContentType != "" {
+		if _, _, err := mime.ParseMediaType(cfg.WelcomeContentType); err != nil {
+			return Config{}, fmt.Errorf("SHORTY_WELCOME_CONTENT_TYPE must be a media type such as text/html: %w", err)
+		}
+	}
+	if !strings.HasPrefix(cfg.StaticPrefix, "/") || !strings.HasSuffix(cfg.StaticPrefix, "/") || cfg.StaticPrefix == "/" {
+		return Config{}, errors.New(`SHORTY_STATIC_PREFIX must start and end with "/", like "/ui/"`)
+	}
+	if reservedKeys[staticKey(cfg)] {
+		return Config{}, fmt.Errorf("SHORTY_STATIC_PREFIX cannot start with the reserved path %q", staticKey(cfg))
+	}
+	if cfg.RootRedirect != "" && cfg.WelcomeTemplate != "" {
+		return Config{}, errors.New("SHORTY_ROOT_REDIRECT and SHORTY_WELCOME_TEMPLATE are mutually exclusive")
+	}
+	if cfg.RootResponse == "" {
+		cfg.RootResponse = RootWelcome
+		if cfg.RootRedirect != "" {
+			cfg.RootResponse = RootRedirectTo
+		}
+	}
+	switch cfg.RootResponse {
+	case RootWelcome, RootNotFound, RootNoContent:
+		if cfg.RootRedirect != "" {
+			return Config{}, fmt.Errorf("SHORTY_ROOT_REDIRECT requires SHORTY_ROOT_RESPONSE=%s", RootRedirectTo)
+		}
+		if cfg.WelcomeTemplate != "" && cfg.RootResponse != RootWelcome {
+			return Config{}, fmt.Errorf("SHORTY_WELCOME_TEMPLATE requires SHORTY_ROOT_RESPONSE=%s", RootWelcome)
+		}
+	case RootRedirectTo:
+		if cfg.RootRedirect == "" {
+			return Config{}, fmt.Errorf("SHORTY_ROOT_RESPONSE=%s requires SHORTY_ROOT_REDIRECT", RootRedirectTo)
+		}
+	default:
+		return Config{}, fmt.Errorf("SHORTY_ROOT_RESPONSE must be %q, %q, %q or %q", RootWelcome, RootNotFound, RootNoContent, RootRedirectTo)
+	}
+	if cfg.DuplicateURLs != DuplicateAllow && cfg.DuplicateURLs != DuplicateDedupe && cfg.DuplicateURLs != DuplicateReject {
+		return Config{}, fmt.Errorf("SHORTY_DUPLICATE_URLS must be %q, %q or %q", DuplicateAllow, DuplicateDedupe, DuplicateReject)
+	}
+	if cfg.SelfLinks != SelfLinkAllow && cfg.SelfLinks != SelfLinkFlatten && cfg.SelfLinks != SelfLinkReject {
+		return Config{}, fmt.Errorf("SHORTY_SELF_LINKS must be %q, %q or %q", SelfLinkAllow, SelfLinkFlatten, SelfLinkReject)
+	}
+	if cfg.MaxChainDepth < 0 {
+		return Config{}, errors.New("SHORTY_MAX_CHAIN_DEPTH must not be negative")
+	}
+	if (cfg.SelfLinks != SelfLinkAllow || cfg.MaxChainDepth > 0) && len(cfg.SelfHosts) == 0 {
+		return Config{}, errors.New("SHORTY_SELF_LINKS and SHORTY_MAX_CHAIN_DEPTH require SHORTY_SELF_HOSTS")
+	}
+	if cfg.RedirectMode != RedirectHTTP && cfg.RedirectMode != RedirectHTML {
+		return Config{}, fmt.Errorf("SHORTY_REDIRECT_MODE must be %q or %q", RedirectHTTP, RedirectHTML)
+	}
+	if cfg.GeneratedKeyConflict != GeneratedKeyReject && cfg.GeneratedKeyConflict != GeneratedKeyRelocate && cfg.GeneratedKeyConflict != GeneratedKeyReplace {
+		return Config{}, fmt.Errorf("SHORTY_GENERATED_KEY_CONFLICT must be %q, %q or %q", GeneratedKeyReject, GeneratedKeyRelocate, GeneratedKeyReplace)
+	}
+	if cfg.CustomKeyConflict != CustomKeyReplace && cfg.CustomKeyConflict != CustomKeyReject {
+		return Config{}, fmt.Errorf("SHORTY_CUSTOM_KEY_CONFLICT must be %q or %q", CustomKeyReplace, CustomKeyReject)
+	}
+	if cfg.HTTPSDestinations != HTTPSOff && cfg.HTTPSDestinations != HTTPSReject && cfg.HTTPSDestinations != HTTPSUpgrade {
+		return Config{}, fmt.Errorf("SHORTY_HTTPS_DESTINATIONS must be %q, %q or %q", HTTPSOff, HTTPSReject, HTTPSUpgrade)
+	}
+	if cfg.SaveFailure != SaveFailureRetain && cfg.SaveFailure != SaveFailureRollback {
+		return Config{}, fmt.Errorf("SHORTY_SAVE_FAILURE must be %q or %q", SaveFailureRetain, SaveFailureRollback)
+	}
+	if cfg.SaveFailure == SaveFailureRollback && !cfg.SyncWrites {
+		return Config{}, fmt.Errorf("SHORTY_SAVE_FAILURE=%s requires SHORTY_SYNC_WRITES", SaveFailureRollback)
+	}
+	if cfg.AliasOnDelete != AliasDeleteCascade && cfg.AliasOnDelete != AliasDeleteOrphan {
+		return Config{}, fmt.Errorf("SHORTY_ALIAS_ON_DELETE must be %q or %q", AliasDeleteCascade, AliasDeleteOrphan)
+	}
+	if cfg.BaseURL != "" && validateDestination(cfg.BaseURL, Config{}) != nil {
+		return Config{}, errors.New("SHORTY_BASE_URL must be an absolute http or https URL")
+	}
+	if cfg.ClickWebhookURL != "" && validateDestination(cfg.ClickWebhookURL, Config{}) != nil {
+		return Config{}, errors.New("SHORTY_CLICK_WEBHOOK_URL must be an absolute http or https URL")
+	}
+	if cfg.BlockedKeyMatch != KeyMatchExact && cfg.BlockedKeyMatch != KeyMatchSubstring {
+		return Config{}, fmt.Errorf("SHORTY_BLOCKED_KEY_MATCH must be %q or %q", KeyMatchExact, KeyMatchSubstring)
+	}
+	for i, word := range cfg.BlockedKeyWords {
+		cfg.BlockedKeyWords[i] = strings.ToLower(word)
+	}
+	if cfg.KeyStrategy != KeyStrategyRandom && cfg.KeyStrategy != KeyStrategyHash && cfg.KeyStrategy != KeyStrategyCounter {
+		return Config{}, fmt.Errorf("SHORTY_KEY_STRATEGY must be %q, %q or %q", KeyStrategyRandom, KeyStrategyHash, KeyStrategyCounter)
+	}
+	if cfg.LoadBytesPerLink < 0 {
+		return Config{}, errors.New("SHORTY_LOAD_BYTES_PER_LINK must not be negative")
+	}
+	if cfg.LogMaxBytes < 1 {
+		return Config{}, errors.New("SHORTY_LOG_MAX_BYTES must be at least 1")
+	}
+	if cfg.LogMaxFiles < 0 {
+		return Config{}, errors.New("SHORTY_LOG_MAX_FILES must not be negative")
+	}
+	if cfg.AccessLogFormat != AccessLogCommon && cfg.AccessLogFormat != AccessLogCombined {
+		return Config{}, fmt.Errorf("SHORTY_ACCESS_LOG_FORMAT must be %q or %q", AccessLogCommon, AccessLogCombined)
+	}
+	if cfg.ClickLogQueueSize < 1 || cfg.ClickWebhookQueueSize < 1 {
+		return Config{}, errors.New("SHORTY_CLICK_LOG_QUEUE_SIZE and SHORTY_CLICK_WEBHOOK_QUEUE_SIZE must be at least 1")
+	}
+	if cfg.ClickQueueFull != QueueFullDrop && cfg.ClickQueueFull != QueueFullBlock {
+		return Config{}, fmt.Errorf("SHORTY_CLICK_QUEUE_FULL must be %q or %q", QueueFullDrop, QueueFullBlock)
+	}
+	if cfg.ClickLogIP != ClickIPFull && cfg.ClickLogIP != ClickIPHash && cfg.ClickLogIP != ClickIPOmit {
+		return Config{}, fmt.Errorf("SHORTY_CLICK_LOG_IP must be %q, %q or %q", ClickIPFull, ClickIPHash, ClickIPOmit)
+	}
+	if cfg.CreatorIP != ClickIPFull && cfg.CreatorIP != ClickIPHash && cfg.CreatorIP != ClickIPOmit {
+		return Config{}, fmt.Errorf("SHORTY_CREATOR_IP must be %q, %q or %q", ClickIPFull, ClickIPHash, ClickIPOmit)
+	}
+	if cfg.CreatorIP == ClickIPHash && len(cfg.IPHashSalt) == 0 {
+		return Config{}, errors.New("SHORTY_CREATOR_IP=hash requires SHORTY_IP_HASH_SALT")
+	}
+
+	return cfg, nil
+}
+
+// parseCreateMethods reads the method names of SHORTY_CREATE_METHODS, defaulting to POST.
+func parseCreateMethods(entries []string) ([]string, error) {
+	if len(entries) == 0 {
+		return []string{http.MethodPost}, nil
+	}
+	methods := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		method := strings.ToUpper(entry)
+		if method != http.MethodPost && method != http.MethodPut && method != http.MethodGet {
+			return nil, fmt.Errorf("SHORTY_CREATE_METHODS entry %q must be POST, PUT or GET", entry)
+		}
+		if !slices.Contains(methods, method) {
+			methods = append(methods, method)
+		}
+	}
+	return methods, nil
+}
+
+// normalizePathPrefix turns "go", "/go" and "/go/" into "/go", and "/" into "".
+func normalizePathPrefix(prefix string) string {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+func envString(name, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envInt(name string, fallback int) (int, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %w", name, err)
+	}
+	return n, nil
+}
+
+func envBool(name string, fallback bool) (bool, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean: %w", name, err)
+	}
+	return b, nil
+}
+
+func envDuration(name string, fallback time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration such as 30s: %w", name, err)
+	}
+	return d, nil
+}
+
+// envList splits a comma-separated environment variable, dropping empty entries.
+func envList(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// =======================================================================================
+// CORS - SHORTY_CORS_ROUTE_ORIGINS lets pages on other origins, such as a dashboard, read
+// the API from the browser. Each route class (see compressionRoute) gets its own list of
+// allowed origins, so stats can be opened to a dashboard without opening the export.
+// Redirects are never offered CORS: they answer every visitor the same way, and a script
+// has no business reading where a link leads.
+// =======================================================================================
+
+// Route classes that may be offered CORS. Redirects, class "other", can't.
+var corsRoutes = []string{"export", "list", "stats", "info"}
+
+// parseCORSOrigins reads "route=origin" entries, where origin is "*" or a scheme and
+// host such as https://dash.example.com. A route may be listed more than once.
+func parseCORSOrigins(entries []string) (map[string][]string, error) {
+	origins := make(map[string][]string)
+	for _, entry := range entries {
+		route, origin, _ := strings.Cut(entry, "=")
+		if !slices.Contains(corsRoutes, route) || !validOrigin(origin) {
+			return nil, fmt.Errorf("SHORTY_CORS_ROUTE_ORIGINS entry %q must be route=origin with a route among %s and an origin such as https://example.com or *", entry, strings.Join(corsRoutes, ", "))
+		}
+		origins[route] = append(origins[route], strings.TrimSuffix(origin, "/"))
+	}
+	return origins, nil
+}
+
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	u, err := url.Parse(strings.TrimSuffix(origin, "/"))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.Path == "" && u.RawQuery == "" && u.User == nil
+}
+
+// allowCORS adds CORS headers to responses of the route classes in origins for requests
+// from an allowed origin, and answers their preflight requests itself.
+func allowCORS(next http.Handler, origins map[string][]string, pathPrefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, ok := origins[compressionRoute(strings.TrimPrefix(r.URL.Path, pathPrefix))]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || (!slices.Contains(allowed, origin) && !slices.Contains(allowed, "*")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if slices.Contains(allowed, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, ETag")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, If-None-Match")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
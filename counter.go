@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// =======================================================================================
+// Counter Keys - Sequential IDs in base62, giving the shortest possible keys. The counter
+// must never hand out an ID twice, even across crashes, so IDs are claimed from a
+// CounterStore in blocks: the high-water mark is persisted before any ID in the block is
+// used. A crash skips at most the rest of one block and never reuses an ID.
+// =======================================================================================
+
+// counterBlockSize is how many IDs are reserved per write to the CounterStore.
+const counterBlockSize = 100
+
+// CounterStore durably hands out ranges of IDs.
+type CounterStore interface {
+	// Reserve claims the next n IDs and returns the first. The claim must be durable
+	// before Reserve returns.
+	Reserve(n uint64) (uint64, error)
+}
+
+// fileCounterStore keeps the high-water mark as a decimal number in a small file,
+// replaced atomically on each reservation.
+type fileCounterStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newFileCounterStore(path string) *fileCounterStore {
+	return &fileCounterStore{path: path}
+}
+
+func (c *fileCounterStore) Reserve(n uint64) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	next := uint64(1) // Zero would encode to an empty key
+	data, err := os.ReadFile(c.path)
+	switch {
+	case err == nil:
+		if next, err = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err != nil {
+			return 0, fmt.Errorf("corrupt counter file %s: %w", c.path, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return 0, err
+	}
+
+	if err := writeFileAtomic(context.Background(), c.path, []byte(strconv.FormatUint(next+n, 10)+"\n"), 0644); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// counterKeyGenerator encodes successive IDs from its CounterStore in base62.
+type counterKeyGenerator struct {
+	store CounterStore
+
+	mu          sync.Mutex
+	next, limit uint64 // IDs in [next, limit) are reserved but unused
+}
+
+// Generate ignores attempt: an ID is only ever proposed once, so a collision with a
+// custom key is resolved by the next ID.
+func (g *counterKeyGenerator) Generate(string, int) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.next == g.limit {
+		start, err := g.store.Reserve(counterBlockSize)
+		if err != nil {
+			return "", fmt.Errorf("reserving key IDs: %w", err)
+		}
+		g.next, g.limit = start, start+counterBlockSize
+	}
+	id := g.next
+	g.next++
+	return base62(binary.BigEndian.AppendUint64(nil, id)), nil
+}
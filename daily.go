@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// =======================================================================================
+// Daily Data Files - With SHORTY_DAILY_FILES=N, saves go to a file named after the day,
+// such as urls-2024-05-01.json, and the data file itself becomes a symlink to the current
+// one. Each day's last save is kept as that day's snapshot, and files beyond the newest N
+// are deleted as days roll over. Days are counted in UTC.
+// =======================================================================================
+
+const dailyFileDate = "2006-01-02"
+
+// dailyFileName returns the file the data file's contents are saved to on day, e.g.
+// "data/urls-2024-05-01.json.gz" for "data/urls.json.gz".
+func dailyFileName(filename string, day time.Time) string {
+	dir, base := filepath.Split(filename)
+	stem, ext, _ := strings.Cut(base, ".")
+	if ext != "" {
+		ext = "." + ext
+	}
+	return dir + stem + "-" + day.UTC().Format(dailyFileDate) + ext
+}
+
+// dailyFilePattern matches the daily files of filename, oldest sorting first.
+func dailyFilePattern(filename string) *regexp.Regexp {
+	stem, ext, _ := strings.Cut(filepath.Base(filename), ".")
+	if ext != "" {
+		ext = "." + ext
+	}
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(stem) + `-\d{4}-\d{2}-\d{2}` + regexp.QuoteMeta(ext) + `$`)
+}
+
+// dailyFiles lists the daily files of filename, oldest first.
+func dailyFiles(filename string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	pattern := dailyFilePattern(filename)
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && pattern.MatchString(entry.Name()) {
+			files = append(files, filepath.Join(filepath.Dir(filename), entry.Name()))
+		}
+	}
+	slices.Sort(files) // The dates sort like the days they name
+	return files, nil
+}
+
+// writeDailyFile saves data as the daily file for now and points the data file at it,
+// pruning old daily files when the day has changed. Must be called with s.saveMu held.
+func (s *URLStore) writeDailyFile(ctx context.Context, data []byte, now time.Time) error {
+	daily := dailyFileName(s.filename, now)
+	if err := writeFileAtomic(ctx, daily, data, 0644); err != nil {
+		return err
+	}
+	if current, err := os.Readlink(s.filename); err == nil && current == filepath.Base(daily) {
+		return nil
+	}
+
+	// Swap the link through a rename, so readers always find a data file.
+	tmp := s.filename + ".link"
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(daily), tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.filename); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	s.pruneDailyFiles()
+	return nil
+}
+
+// pruneDailyFiles deletes daily files beyond the newest Config.DailyFiles.
+func (s *URLStore) pruneDailyFiles() {
+	files, err := dailyFiles(s.filename)
+	if err != nil {
+		slog.Warn("Listing daily data files failed", "file", s.filename, "error", err)
+		return
+	}
+	for len(files) > s.cfg.DailyFiles {
+		if err := os.Remove(files[0]); err != nil {
+			slog.Warn("Deleting old daily data file failed", "file", files[0], "error", err)
+		} else {
+			slog.Info("Deleted old daily data file", "file", files[0])
+		}
+		files = files[1:]
+	}
+}
+
+// latestDailyFile returns the newest daily file of filename, for when the link to it has
+// been lost.
+func latestDailyFile(filename string) (string, bool) {
+	files, err := dailyFiles(filename)
+	if err != nil || len(files) == 0 {
+		return "", false
+	}
+	return files[len(files)-1], true
+}
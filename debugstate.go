@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"runtime"
+	"time"
+)
+
+// =======================================================================================
+// Debug State - With SHORTY_DEBUG_STATE, GET /debug/state gives admins a snapshot of the
+// server's internals for troubleshooting a production instance without a debugger: the
+// number of stored keys, save health, the size of the rate limiters' tables, dropped
+// click events, goroutine and memory figures, and the effective configuration. Secrets
+// in the configuration are never shown, only whether they are set. Off by default; when
+// off the path answers 404.
+// =======================================================================================
+
+const redactedValue = "[redacted]"
+
+// secretConfigFields names the Config fields whose values /debug/state must not show.
+var secretConfigFields = map[string]bool{
+	"AdminToken":         true,
+	"APIKeys":            true,
+	"IPHashSalt":         true,
+	"EncryptionKey":      true,
+	"URLIndexSalt":       true,
+	"SigningKey":         true,
+	"DeletionKey":        true,
+	"ChallengeSecret":    true,
+	"ClickWebhookURL":    true, // May carry a token in its path or query
+	"ClickWebhookSecret": true,
+}
+
+// configSummary returns cfg by field name, with secrets replaced by redactedValue when
+// they are set and by nil when they are not.
+func configSummary(cfg Config) map[string]any {
+	v := reflect.ValueOf(cfg)
+	summary := make(map[string]any, v.NumField())
+	for i := range v.NumField() {
+		name, field := v.Type().Field(i).Name, v.Field(i)
+		switch {
+		case secretConfigFields[name] && (field.IsZero() || isEmptyCollection(field)):
+			summary[name] = nil
+		case secretConfigFields[name]:
+			summary[name] = redactedValue
+		case field.Type() == reflect.TypeFor[time.Duration]():
+			summary[name] = field.Interface().(time.Duration).String()
+		default:
+			summary[name] = field.Interface()
+		}
+	}
+	return summary
+}
+
+func isEmptyCollection(v reflect.Value) bool {
+	return (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0
+}
+
+// size returns the number of clients the limiter is tracking.
+func (l *rateLimiter) size() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// handleDebugState serves GET /debug/state.
+func (h *urlHandler) handleDebugState(w http.ResponseWriter, r *http.Request) {
+	if !h.cfg.DebugState {
+		notFound(w, r)
+		return
+	}
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	health := h.store.saveHealth()
+	links, clicks := h.store.Totals()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	var lastSaveDuration string
+	if !health.lastSaved.IsZero() {
+		lastSaveDuration = health.lastDuration.String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(struct {
+		Keys             int            `json:"keys"`
+		Links            int64          `json:"links"`
+		Clicks           int64          `json:"clicks"`
+		LastSave         time.Time      `json:"lastSave,omitzero"`
+		LastSaveDuration string         `json:"lastSaveDuration,omitempty"`
+		SaveFailures     int            `json:"saveFailures"`
+		LastSaveError    string         `json:"lastSaveError,omitempty"`
+		UnsavedSince     time.Time      `json:"unsavedSince,omitzero"`
+		Maintenance      bool           `json:"maintenance"`
+		RateLimitClients int            `json:"rateLimitClients"`
+		KeyRateLimitKeys int            `json:"keyRateLimitKeys"`
+		ClicksDropped    uint64         `json:"clickEventsDropped"`
+		WebhooksDropped  uint64         `json:"webhookEventsDropped"`
+		Goroutines       int            `json:"goroutines"`
+		HeapBytes        uint64         `json:"heapBytes"`
+		GoVersion        string         `json:"goVersion"`
+		Config           map[string]any `json:"config"`
+	}{
+		Keys:             h.store.Len(),
+		Links:            links,
+		Clicks:           clicks,
+		LastSave:         health.lastSaved,
+		LastSaveDuration: lastSaveDuration,
+		SaveFailures:     health.consecutiveFailures,
+		LastSaveError:    health.lastError,
+		UnsavedSince:     health.pendingSince,
+		Maintenance:      h.store.InMaintenance(),
+		RateLimitClients: h.limiter.size(),
+		KeyRateLimitKeys: h.keyLimiter.size(),
+		ClicksDropped:    h.clicks.Dropped(),
+		WebhooksDropped:  h.hook.Dropped(),
+		Goroutines:       runtime.NumGoroutine(),
+		HeapBytes:        mem.HeapAlloc,
+		GoVersion:        runtime.Version(),
+		Config:           configSummary(h.cfg),
+	})
+}
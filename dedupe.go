@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// =======================================================================================
+// Retroactive Dedupe - POST /shorty/dedupe cleans up links created before
+// SHORTY_DUPLICATE_URLS was set to dedupe: every group of live links to the same URL
+// collapses into its oldest link, which takes over their clicks. The others become
+// aliases of it, so their keys keep working, or are deleted with mode=delete. Only links
+// that behave the same are merged: same owner, expiry and redirect settings, and none
+// with device, country, variant or fallback targets, a prefix or a start time, since
+// those aren't plain copies of each other.
+// =======================================================================================
+
+const (
+	DedupeAlias  = "alias"  // Turn the duplicates into aliases of the kept link
+	DedupeDelete = "delete" // Delete the duplicates
+)
+
+// DedupeGroup reports one set of merged links.
+type DedupeGroup struct {
+	ShortKey   string   `json:"shortKey"` // The link that was kept
+	URL        string   `json:"url"`
+	Duplicates []string `json:"duplicates"`
+	Clicks     uint64   `json:"clicks"` // The kept link's clicks after the merge
+}
+
+// mergeable reports whether rec is a plain link that can be merged with its duplicates.
+func (rec Record) mergeable() bool {
+	return rec.AliasOf == "" && len(rec.Devices) == 0 && len(rec.Countries) == 0 && len(rec.Variants) == 0 &&
+		len(rec.Fallbacks) == 0 && !rec.Prefix && len(rec.Params) == 0 && rec.ActiveAt.IsZero() && rec.MaxClicks == 0
+}
+
+// sameBehavior reports whether visitors of a and b are treated alike, other than where
+// they are sent.
+func sameBehavior(a, b Record) bool {
+	return a.Owner == b.Owner && a.ExpiresAt.Equal(b.ExpiresAt) && a.Permanent == b.Permanent && a.NoTracking == b.NoTracking &&
+		a.RedirectMode == b.RedirectMode && a.RedirectStatus == b.RedirectStatus && maps.Equal(a.Headers, b.Headers)
+}
+
+// Dedupe merges every group of mergeable live links to the same URL into its oldest link,
+// adding their clicks to it and turning them into aliases of it or deleting them, per
+// mode. The duplicates' own aliases are moved to the kept link. With dryRun it only
+// reports what it would merge.
+func (s *URLStore) Dedupe(mode string, dryRun bool) ([]DedupeGroup, error) {
+	if !dryRun {
+		if err := s.checkWritable(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var candidates [][]string // Collected first, since merging changes s.byURL
+	for _, keySet := range s.byURL {
+		if len(keySet) > 1 {
+			candidates = append(candidates, slices.Collect(maps.Keys(keySet)))
+		}
+	}
+
+	groups := make([]DedupeGroup, 0)
+	for _, keys := range candidates {
+		keys = slices.DeleteFunc(keys, func(key string) bool {
+			return s.urls[key].expired(now) || !s.urls[key].mergeable()
+		})
+		slices.SortFunc(keys, func(a, b string) int {
+			if c := s.urls[a].CreatedAt.Compare(s.urls[b].CreatedAt); c != 0 {
+				return c
+			}
+			return strings.Compare(a, b)
+		})
+
+		// Each key joins the first kept link it behaves like, or is kept itself.
+		var kept []string
+		duplicates := make(map[string][]string)
+		for _, key := range keys {
+			i := slices.IndexFunc(kept, func(k string) bool { return sameBehavior(s.urls[k], s.urls[key]) })
+			if i < 0 {
+				kept = append(kept, key)
+			} else {
+				duplicates[kept[i]] = append(duplicates[kept[i]], key)
+			}
+		}
+		for _, canonical := range kept {
+			if len(duplicates[canonical]) > 0 {
+				groups = append(groups, s.mergeLocked(canonical, duplicates[canonical], mode, dryRun))
+			}
+		}
+	}
+
+	slices.SortFunc(groups, func(a, b DedupeGroup) int { return strings.Compare(a.ShortKey, b.ShortKey) })
+	if len(groups) > 0 && !dryRun {
+		s.saveAsync()
+	}
+	return groups, nil
+}
+
+// mergeLocked folds duplicates into canonical; see Dedupe. Must be called with s.mu held
+// for writing.
+func (s *URLStore) mergeLocked(canonical string, duplicates []string, mode string, dryRun bool) DedupeGroup {
+	merged := s.urls[canonical]
+	for _, key := range duplicates {
+		dup := s.urls[key]
+		merged.Clicks = addClicks(merged.Clicks, dup.Clicks)
+		merged.Hourly = merged.Hourly.merge(dup.Hourly, time.Hour, hourlyBuckets)
+		merged.Daily = merged.Daily.merge(dup.Daily, 24*time.Hour, dailyBuckets)
+		if dryRun {
+			continue
+		}
+
+		for _, alias := range slices.Collect(maps.Keys(s.aliases[key])) {
+			rec := s.urls[alias]
+			rec.AliasOf = canonical
+			s.putLocked(alias, rec)
+		}
+		if mode == DedupeDelete {
+			s.deleteLocked(key)
+			s.emit(EventDeleted, key, dup)
+		} else {
+			s.putLocked(key, Record{URL: dup.URL, CreatedAt: dup.CreatedAt, Owner: dup.Owner, AliasOf: canonical, ExpiresAt: dup.ExpiresAt})
+		}
+	}
+	if !dryRun {
+		s.putLocked(canonical, merged)
+	}
+	return DedupeGroup{ShortKey: canonical, URL: merged.URL, Duplicates: duplicates, Clicks: merged.Clicks}
+}
+
+// handleDedupe serves POST /shorty/dedupe?mode=alias|delete&dryRun=true.
+func (h *urlHandler) handleDedupe(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = DedupeAlias
+	}
+	if mode != DedupeAlias && mode != DedupeDelete {
+		writeError(w, r, "Mode must be alias or delete", http.StatusBadRequest)
+		return
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	groups, err := h.store.Dedupe(mode, dryRun)
+	if err != nil {
+		storeError(w, r, err, "Failed to dedupe links")
+		return
+	}
+	merged := 0
+	for _, group := range groups {
+		merged += len(group.Duplicates)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Merged int           `json:"merged"`
+		DryRun bool          `json:"dryRun,omitempty"`
+		Groups []DedupeGroup `json:"groups"`
+	}{merged, dryRun, groups})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// =======================================================================================
+// Deletion - Removing links, either on request or when the link cap evicts one. Aliases
+// of a removed link are handled according to Config.AliasOnDelete.
+// =======================================================================================
+
+// Delete removes the link stored under shortKey. Deleting an alias removes only the alias.
+// A non-empty owner may only delete their own links; admins pass an empty owner.
+func (s *URLStore) Delete(shortKey, owner string) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, found := s.urls[shortKey]
+	if !found {
+		return ErrLinkNotFound
+	}
+	if owner != "" && rec.Owner != owner {
+		return ErrNotOwner
+	}
+	s.removeLinkLocked(shortKey)
+
+	s.saveAsync()
+	return nil
+}
+
+// deleteLinkLocked removes shortKey and, under AliasDeleteCascade, every alias of it.
+// Must be called with s.mu held for writing.
+func (s *URLStore) deleteLinkLocked(shortKey string) {
+	if s.cfg.AliasOnDelete != AliasDeleteOrphan {
+		for alias := range s.aliases[shortKey] {
+			s.emit(EventDeleted, alias, s.urls[alias])
+			s.deleteLocked(alias)
+		}
+	}
+	s.emit(EventDeleted, shortKey, s.urls[shortKey])
+	s.deleteLocked(shortKey)
+}
+
+// handleDelete lets admins delete any link, API key owners delete their own, and anyone
+// holding a link's deletion token delete that link.
+func (h *urlHandler) handleDelete(w http.ResponseWriter, r *http.Request, shortKey string) {
+	owner := h.owner(r)
+	var err error
+	switch token := requestDeleteToken(r); {
+	case owner != "" || h.isAdmin(r):
+		err = h.store.Delete(shortKey, owner)
+	case len(h.cfg.DeletionKey) > 0 && token != "":
+		err = h.store.DeleteWithToken(shortKey, token)
+	case len(h.cfg.DeletionKey) > 0:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="go-shorty"`)
+		writeError(w, r, "A deletion token or API key is required", http.StatusUnauthorized)
+		return
+	default:
+		h.requireAdmin(w, r)
+		return
+	}
+	if err != nil {
+		storeError(w, r, err, "Failed to delete link")
+		return
+	}
+	slog.Info("Link deleted", "key", shortKey)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// =======================================================================================
+// Deletion Tokens - With SHORTY_DELETION_KEY set, creating a link returns a deleteToken
+// that lets whoever holds it delete that link with DELETE /{shortKey}, so anonymous
+// creators can take their links down without an account. The token is an HMAC of the
+// key and the link's creation time, so nothing is stored per link, and a key that is
+// deleted and later reused for another link needs a new token.
+// =======================================================================================
+
+const deleteTokenHeader = "X-Delete-Token"
+
+var ErrBadDeleteToken = errors.New("deletion token is not valid for this link")
+
+// deleteToken returns the token that deletes rec, stored under shortKey.
+func deleteToken(secret []byte, shortKey string, rec Record) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("delete\x00" + shortKey + "\x00" + strconv.FormatInt(rec.CreatedAt.UnixNano(), 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DeleteWithToken removes the link stored under shortKey if token is its deletion token.
+func (s *URLStore) DeleteWithToken(shortKey, token string) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, found := s.urls[shortKey]
+	if !found {
+		return ErrLinkNotFound
+	}
+	expected := deleteToken(s.cfg.DeletionKey, shortKey, rec)
+	if !hmac.Equal([]byte(token), []byte(expected)) {
+		return ErrBadDeleteToken
+	}
+	s.removeLinkLocked(shortKey)
+
+	s.saveAsync()
+	return nil
+}
+
+// requestDeleteToken returns the token sent in the X-Delete-Token header or the token
+// query parameter.
+func requestDeleteToken(r *http.Request) string {
+	if token := r.Header.Get(deleteTokenHeader); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
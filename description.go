@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// =======================================================================================
+// Descriptions - A free-text note on a link for the people managing it, set with
+// "description" at create and changed later with PATCH /{shortKey}. It is returned in
+// /{shortKey}/info and the click statistics, and never rendered as HTML: JSON responses
+// escape <, > and &, so a note can't inject markup into a page that shows it.
+// =======================================================================================
+
+const maxDescriptionLength = 500 // Characters, not bytes
+
+var ErrInvalidDescription = errors.New("invalid description")
+
+// validateDescription checks the length and rejects control characters other than line
+// breaks and tabs.
+func validateDescription(description string) error {
+	if !utf8.ValidString(description) {
+		return fmt.Errorf("%w: must be valid UTF-8", ErrInvalidDescription)
+	}
+	if utf8.RuneCountInString(description) > maxDescriptionLength {
+		return fmt.Errorf("%w: at most %d characters are allowed", ErrInvalidDescription, maxDescriptionLength)
+	}
+	for _, c := range description {
+		if unicode.IsControl(c) && c != '\n' && c != '\t' {
+			return fmt.Errorf("%w: control characters are not allowed", ErrInvalidDescription)
+		}
+	}
+	return nil
+}
+
+// SetDescription replaces the description of shortKey and returns the updated record. A
+// non-empty owner may only change their own links.
+func (s *URLStore) SetDescription(shortKey, owner, description string) (Record, error) {
+	if err := validateDescription(description); err != nil {
+		return Record{}, err
+	}
+	if err := s.checkWritable(); err != nil {
+		return Record{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, found := s.urls[shortKey]
+	if !found || rec.expired(time.Now()) {
+		return Record{}, ErrLinkNotFound
+	}
+	if owner != "" && rec.Owner != owner {
+		return Record{}, ErrNotOwner
+	}
+	rec.Description = description
+	s.putLocked(shortKey, rec)
+
+	s.saveAsync()
+	return rec, nil
+}
+
+// handleUpdate serves PATCH /{shortKey} with {"description": "..."} for admins and the
+// link's owner.
+func (h *urlHandler) handleUpdate(w http.ResponseWriter, r *http.Request, shortKey string) {
+	owner := h.owner(r)
+	if owner == "" && !h.requireAdmin(w, r) {
+		return
+	}
+	if !h.requireJSONBody(w, r) {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+	var requestData struct {
+		Description *string `json:"description"`
+	}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		writeError(w, r, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if requestData.Description == nil {
+		writeError(w, r, "Description field is required", http.StatusBadRequest)
+		return
+	}
+
+	rec, err := h.store.SetDescription(shortKey, owner, *requestData.Description)
+	if err != nil {
+		storeError(w, r, err, "Failed to update link")
+		return
+	}
+
+	if !h.isAdmin(r) {
+		rec.CreatorIP = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(linkView{ShortKey: shortKey, Record: rec})
+}
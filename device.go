@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// =======================================================================================
+// Device Targets - A link may send phones and desktops to different destinations, set
+// with "devices": {"mobile": "...", "desktop": "..."} at create. The visitor's device is
+// told apart by its User-Agent alone, and the link's url is the fallback for a device
+// without a target of its own. Redirects of such links carry "Vary: User-Agent" so a
+// cache doesn't hand one device's destination to the other.
+// =======================================================================================
+
+const (
+	DeviceMobile  = "mobile"
+	DeviceDesktop = "desktop"
+)
+
+var ErrInvalidDevices = errors.New("invalid devices")
+
+// mobileUserAgentTokens mark a phone or tablet browser. "Mobi" is the token browsers
+// recommend looking for; the others catch tablets and older devices that omit it.
+var mobileUserAgentTokens = []string{"Mobi", "Android", "iPhone", "iPad", "iPod", "Opera Mini", "IEMobile"}
+
+// deviceOf classifies the requesting client as DeviceMobile or DeviceDesktop.
+func deviceOf(r *http.Request) string {
+	userAgent := r.UserAgent()
+	for _, token := range mobileUserAgentTokens {
+		if strings.Contains(userAgent, token) {
+			return DeviceMobile
+		}
+	}
+	return DeviceDesktop
+}
+
+// validateDevices checks that only known devices are named and that each target would be
+// accepted as a link's url.
+func validateDevices(devices map[string]string, cfg Config) error {
+	for device, target := range devices {
+		if device != DeviceMobile && device != DeviceDesktop {
+			return fmt.Errorf("%w: %q is not a device; use %q or %q", ErrInvalidDevices, device, DeviceMobile, DeviceDesktop)
+		}
+		if err := validateDestination(target, cfg); err != nil {
+			return fmt.Errorf("%w: %s target: %w", ErrInvalidDevices, device, err)
+		}
+	}
+	return nil
+}
+
+// hasTargets reports whether req sends some visitors somewhere other than its url.
+func (req AddRequest) hasTargets() bool {
+	return len(req.Devices) > 0 || len(req.Countries) > 0
+}
+
+// splitsVisitors reports whether req's link sends visitors to more than one destination,
+// so it must not reuse another link with the same url.
+func (req AddRequest) splitsVisitors() bool {
+	return req.hasTargets() || len(req.Variants) > 0 || len(req.Fallbacks) > 0
+}
+
+// needsOwnKey reports whether req's link behaves differently from a plain link with the
+// same url, so it must never be deduplicated against one.
+func (req AddRequest) needsOwnKey() bool {
+	return req.splitsVisitors() || req.Prefix || len(req.Params) > 0 || !req.ActiveAt.IsZero() || req.NoTracking || req.MaxClicks > 0 || req.ExpiresIn != ""
+}
+
+// applyTargetPoliciesLocked rewrites each device or country target the way a link's url
+// is rewritten before it is stored. Must be called with s.mu held.
+func (s *URLStore) applyTargetPoliciesLocked(targets map[string]string) (map[string]string, error) {
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	applied := make(map[string]string, len(targets))
+	for name, target := range targets {
+		var err error
+		target = s.applySlashPolicy(s.applyHTTPSPolicy(target))
+		if target, err = s.applyASCIIHosts(target); err != nil {
+			return nil, err
+		}
+		if target, err = s.applySelfLinkPolicyLocked(target); err != nil {
+			return nil, err
+		}
+		applied[name] = target
+	}
+	return applied, nil
+}
+
+// deviceTarget returns rec with URL set to the destination for the requesting device.
+func deviceTarget(r *http.Request, rec Record) Record {
+	if target, found := rec.Devices[deviceOf(r)]; found {
+		rec.URL = target
+	}
+	return rec
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// =======================================================================================
+// Display URLs - With SHORTY_DISPLAY_URLS, each link also stores a short, readable form of
+// its destination for UIs to show in place of the full URL: the host and the start of the
+// path, without scheme, query or fragment, such as "example.com/docs/getting-start…".
+// It is computed once at create time and returned with the link in listings and info;
+// redirects always use the full URL.
+// =======================================================================================
+
+const maxDisplayPath = 30 // Runes of the path kept before it is cut with an ellipsis
+
+// displayURL returns the short display form of longURL, or "" when it can't be parsed.
+func displayURL(longURL string) string {
+	u, err := url.Parse(longURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	path := strings.TrimSuffix(u.Path, "/")
+	if runes := []rune(path); len(runes) > maxDisplayPath {
+		path = string(runes[:maxDisplayPath]) + "…"
+	}
+	return host + path
+}
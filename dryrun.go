@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// =======================================================================================
+// Dry Runs - POST /shorty?dryRun=true runs every check a create would and reports the
+// outcome without storing anything, so clients can see whether a custom key is free
+// before claiming it.
+// =======================================================================================
+
+// What a create would do with the key it reports.
+const (
+	PreviewCreate   = "create"   // Store a new link
+	PreviewReplace  = "replace"  // Replace the link already stored under the custom key
+	PreviewExisting = "existing" // Return the link already stored for the URL
+	PreviewRelocate = "relocate" // Move the link under the custom key to a new generated key
+)
+
+type AddPreview struct {
+	// ShortKey is empty for generated keys that can't be known in advance, as with the
+	// random and counter strategies.
+	ShortKey string `json:"shortKey,omitempty"`
+	Action   string `json:"action"`
+}
+
+// Preview reports what Add would do with req, or the error it would fail with. It
+// neither changes the store nor saves it. Unlike Add it doesn't evict under
+// EvictLRU, so a full store with that policy reports success.
+func (s *URLStore) Preview(ctx context.Context, req AddRequest) (AddPreview, error) {
+	if err := s.validateAdd(req); err != nil {
+		return AddPreview{}, err
+	}
+	if err := s.checkWritable(); err != nil {
+		return AddPreview{}, err
+	}
+	if err := s.checkDestination(ctx, req.URL); err != nil {
+		return AddPreview{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var err error
+	req.URL = s.applySlashPolicy(s.applyHTTPSPolicy(req.URL))
+	if req.URL, err = s.applyASCIIHosts(req.URL); err != nil {
+		return AddPreview{}, err
+	}
+	if req.URL, err = s.applySelfLinkPolicyLocked(req.URL); err != nil {
+		return AddPreview{}, err
+	}
+	if _, err = s.applyTargetPoliciesLocked(req.Devices); err != nil {
+		return AddPreview{}, err
+	}
+	if _, err = s.applyTargetPoliciesLocked(req.Countries); err != nil {
+		return AddPreview{}, err
+	}
+	if _, err = s.applyVariantPoliciesLocked(req.Variants); err != nil {
+		return AddPreview{}, err
+	}
+	if _, err = s.applyFallbackPoliciesLocked(req.Fallbacks); err != nil {
+		return AddPreview{}, err
+	}
+
+	preview := AddPreview{Action: PreviewCreate}
+	switch existing, found := s.existingKeyLocked(req.URL); {
+	case req.CustomKey != nil:
+		preview.ShortKey = *req.CustomKey
+		if rec, taken := s.urls[preview.ShortKey]; taken && rec.inBin() {
+			return AddPreview{}, ErrKeyExists
+		} else if taken && !rec.expired(time.Now()) {
+			if req.CreateOnly {
+				return AddPreview{}, ErrKeyExists
+			}
+			switch {
+			case !rec.Generated && s.cfg.CustomKeyConflict == CustomKeyReject:
+				return AddPreview{}, ErrKeyExists
+			case !rec.Generated || s.cfg.GeneratedKeyConflict == GeneratedKeyReplace:
+				preview.Action = PreviewReplace
+			case s.cfg.GeneratedKeyConflict == GeneratedKeyRelocate:
+				preview.Action = PreviewRelocate
+			default:
+				return AddPreview{}, ErrGeneratedKeyTaken
+			}
+		}
+	case req.needsOwnKey():
+		// Links with targets, variants, fallbacks, a prefix or a start time always get a
+		// key of their own; see insertLocked.
+	case found && s.cfg.DuplicateURLs == DuplicateReject:
+		return AddPreview{}, &DuplicateURLError{ShortKey: existing}
+	case found && s.cfg.DuplicateURLs == DuplicateDedupe:
+		return AddPreview{ShortKey: existing, Action: PreviewExisting}, nil
+	case s.cfg.KeyStrategy == KeyStrategyHash:
+		// Hash keys are derived from the URL alone, so proposing one has no side effects.
+		shortKey, exists, err := s.newKeyLocked(req.URL)
+		if err != nil {
+			return AddPreview{}, err
+		}
+		if exists {
+			return AddPreview{ShortKey: shortKey, Action: PreviewExisting}, nil
+		}
+		preview.ShortKey = shortKey
+	}
+
+	if err := s.checkOwnerLocked(req.Owner, preview.ShortKey); err != nil {
+		return AddPreview{}, err
+	}
+	_, exists := s.urls[preview.ShortKey]
+	full := s.cfg.MaxLinks > 0 && len(s.urls) >= s.cfg.MaxLinks && (!exists || preview.Action == PreviewRelocate)
+	if full && s.cfg.EvictionPolicy != EvictLRU {
+		return AddPreview{}, ErrStoreFull
+	}
+	return preview, nil
+}
+
+// handleDryRun answers a create sent with ?dryRun=true, replying as the create would
+// but with 200 OK and the preview on success.
+func (h *urlHandler) handleDryRun(w http.ResponseWriter, r *http.Request, req AddRequest) {
+	preview, err := h.store.Preview(r.Context(), req)
+	var dup *DuplicateURLError
+	if errors.As(err, &dup) {
+		duplicateConflict(w, dup)
+		return
+	}
+	if err != nil {
+		storeError(w, r, err, "Failed to check short key")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(preview)
+}
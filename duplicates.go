@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// =======================================================================================
+// Duplicate URLs - What happens when a link is created for a URL that already has one.
+// By default every create mints a new key. Deployments that want one key per destination
+// can reuse the existing key instead, or refuse the create and point the client at it.
+// Custom keys are exempt: asking for a specific key is always honoured. With
+// SHORTY_URL_INDEX_SALT the index used to find duplicates is keyed by a salted HMAC of
+// each URL rather than the URL itself, so it doesn't hold destinations in plain text.
+// =======================================================================================
+
+const (
+	DuplicateAllow  = "allow"
+	DuplicateDedupe = "dedupe" // Return the existing key
+	DuplicateReject = "reject" // Fail with 409 and the existing key
+)
+
+var ErrDuplicateURL = errors.New("url is already shortened")
+
+// DuplicateURLError is returned under DuplicateReject and carries the existing key.
+type DuplicateURLError struct {
+	ShortKey string
+}
+
+func (e *DuplicateURLError) Error() string { return ErrDuplicateURL.Error() + " as " + e.ShortKey }
+
+func (e *DuplicateURLError) Is(target error) bool { return target == ErrDuplicateURL }
+
+// existingKeyLocked returns a live key, other than an alias, already holding longURL.
+// Must be called with s.mu held.
+func (s *URLStore) existingKeyLocked(longURL string) (string, bool) {
+	now := time.Now()
+	for key := range s.byURL[s.urlIndexKey(longURL)] {
+		if !s.urls[key].expired(now) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func (s *URLStore) indexURL(shortKey string, rec Record) {
+	if rec.AliasOf != "" {
+		return
+	}
+	indexKey := s.urlIndexKey(rec.URL)
+	keys := s.byURL[indexKey]
+	if keys == nil {
+		keys = make(map[string]struct{})
+		s.byURL[indexKey] = keys
+	}
+	keys[shortKey] = struct{}{}
+}
+
+func (s *URLStore) unindexURL(shortKey string, rec Record) {
+	if rec.AliasOf != "" {
+		return
+	}
+	indexKey := s.urlIndexKey(rec.URL)
+	delete(s.byURL[indexKey], shortKey)
+	if len(s.byURL[indexKey]) == 0 {
+		delete(s.byURL, indexKey)
+	}
+}
+
+// urlIndexKey returns the byURL key for longURL: the URL itself, or its HMAC-SHA256
+// under Config.URLIndexSalt, after removing Config.TrackingParams.
+func (s *URLStore) urlIndexKey(longURL string) string {
+	if len(s.cfg.TrackingParams) > 0 {
+		longURL = stripTrackingParams(longURL, s.cfg.TrackingParams)
+	}
+	if len(s.cfg.URLIndexSalt) == 0 {
+		return longURL
+	}
+	mac := hmac.New(sha256.New, s.cfg.URLIndexSalt)
+	mac.Write([]byte(longURL))
+	return string(mac.Sum(nil))
+}
+
+// duplicateConflict replies 409 with the key already holding the URL.
+func duplicateConflict(w http.ResponseWriter, dup *DuplicateURLError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(struct {
+		Error    string `json:"error"`
+		ShortKey string `json:"shortKey"`
+	}{
+		Error:    ErrDuplicateURL.Error(),
+		ShortKey: dup.ShortKey,
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+)
+
+// =======================================================================================
+// Empty Save Guard - A store that comes up empty next to a data file full of links was
+// most likely started against the wrong file or lost its data on the way in, and its
+// first save would wipe the file. So while the store has held no links since it was
+// loaded, a save that would replace a larger data file is refused and logged, leaving the
+// file as it is. Stores that loaded links, even only expired ones, or lost theirs to
+// deletion save as usual.
+// SHORTY_ALLOW_EMPTY_SAVE turns the check off. Bolt databases are written per link and
+// aren't affected.
+// =======================================================================================
+
+var ErrEmptySave = errors.New("refusing to overwrite a non-empty data file with an empty store")
+
+// checkEmptySave refuses a save of an empty store's size bytes when the data file on disk
+// is larger, so it holds links this store never had.
+func (s *URLStore) checkEmptySave(size int) error {
+	if s.cfg.AllowEmptySave {
+		return nil
+	}
+	info, err := os.Stat(s.filename)
+	if err != nil || info.Size() <= int64(size) {
+		return nil // Missing, or no more than an empty store's data
+	}
+	slog.Error("Refusing to overwrite the data file with an empty store; set SHORTY_ALLOW_EMPTY_SAVE=true if it should be emptied",
+		"file", s.filename, "size", info.Size())
+	return ErrEmptySave
+}
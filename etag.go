@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// =======================================================================================
+// Stats ETags - The stats endpoints send an ETag derived from the link's changeable
+// fields, and answer a matching If-None-Match with 304 Not Modified, so dashboards polling
+// a link only download it again once it has changed. With SHORTY_STATS_ETAG_CLICKS=false
+// clicks are left out of the tag: a link then counts as changed only when it is edited,
+// and pollers see new counts once it is, trading fresh numbers for fewer downloads. Those
+// tags are weak, since the bodies they stand for can differ.
+// =======================================================================================
+
+// statsETag returns the ETag of a stats response about rec. parts tell apart the
+// representations of one link, such as its format or interval.
+func statsETag(rec Record, includeClicks bool, parts ...string) string {
+	tagged := struct {
+		URL         string       `json:"url"`
+		DisplayURL  string       `json:"displayURL"`
+		Description string       `json:"description"`
+		CreatedAt   time.Time    `json:"createdAt"`
+		ExpiresAt   time.Time    `json:"expiresAt"`
+		Variants    []Variant    `json:"variants"`
+		Clicks      uint64       `json:"clicks"`
+		Hourly      clickBuckets `json:"hourly"`
+		Daily       clickBuckets `json:"daily"`
+		Parts       []string     `json:"parts"`
+	}{rec.URL, rec.DisplayURL, rec.Description, rec.CreatedAt, rec.ExpiresAt, rec.Variants, rec.Clicks, rec.Hourly, rec.Daily, parts}
+	if !includeClicks {
+		tagged.Variants = variantsWithoutClicks(rec.Variants)
+		tagged.Clicks, tagged.Hourly, tagged.Daily = 0, clickBuckets{}, clickBuckets{}
+	}
+	data, _ := json.Marshal(tagged)
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if !includeClicks {
+		etag = "W/" + etag
+	}
+	return etag
+}
+
+// notModified sets the ETag header and reports whether the request's If-None-Match
+// matches it, in which case it has answered 304 Not Modified.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	for candidate := range strings.SplitSeq(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		// If-None-Match compares weakly, so W/ never matters.
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
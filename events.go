@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// =======================================================================================
+// Store Events - In-process integrations can Subscribe to the store and receive an event
+// for every link created, deleted, clicked or purged after expiring. Events are sent
+// without blocking: a subscriber whose buffer is full misses them, so a slow consumer
+// never holds up a create or a redirect.
+// =======================================================================================
+
+type StoreEventType string
+
+const (
+	EventCreated StoreEventType = "created"
+	EventDeleted StoreEventType = "deleted" // Deleted, evicted or rolled back
+	EventClicked StoreEventType = "clicked" // Record is the link that received the click
+	EventExpired StoreEventType = "expired" // Removed by compaction after expiring
+)
+
+type StoreEvent struct {
+	Type   StoreEventType
+	Key    string
+	Record Record
+	At     time.Time
+}
+
+// eventHub fans events out to subscribers. Its lock is separate from the store's, so
+// events can be sent with s.mu held.
+type eventHub struct {
+	mu      sync.Mutex
+	subs    map[chan StoreEvent]struct{}
+	dropped uint64
+}
+
+// Subscribe returns a channel receiving the store's events, holding up to buffer of them
+// until they are read, and a function that ends the subscription and closes the channel.
+func (s *URLStore) Subscribe(buffer int) (<-chan StoreEvent, func()) {
+	hub := &s.events
+	ch := make(chan StoreEvent, buffer)
+	hub.mu.Lock()
+	if hub.subs == nil {
+		hub.subs = make(map[chan StoreEvent]struct{})
+	}
+	hub.subs[ch] = struct{}{}
+	hub.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			hub.mu.Lock()
+			delete(hub.subs, ch)
+			hub.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// emit sends an event to every subscriber with room for it.
+func (s *URLStore) emit(typ StoreEventType, shortKey string, rec Record) {
+	hub := &s.events
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if len(hub.subs) == 0 {
+		return
+	}
+
+	ev := StoreEvent{Type: typ, Key: shortKey, Record: rec, At: time.Now()}
+	for ch := range hub.subs {
+		select {
+		case ch <- ev:
+		default:
+			hub.dropped++
+			slog.Debug("Store event subscriber is full, dropping event", "type", typ, "key", shortKey, "dropped", hub.dropped)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// =======================================================================================
+// Bulk Expiry - Sets or clears the expiry of many links in one locked operation with a
+// single save, for cleaning up after a campaign. New links can also be given an expiry
+// when they are created, with "expiresIn" or SHORTY_DEFAULT_TTL.
+// =======================================================================================
+
+var ErrInvalidExpiresIn = errors.New("expiresIn must be a non-negative duration such as 72h")
+
+// ttl returns how long req's link lives: its ExpiresIn, or defaultTTL when it has none.
+// Zero means it never expires.
+func (req AddRequest) ttl(defaultTTL time.Duration) (time.Duration, error) {
+	if req.ExpiresIn == "" {
+		return defaultTTL, nil
+	}
+	ttl, err := time.ParseDuration(req.ExpiresIn)
+	if err != nil || ttl < 0 {
+		return 0, ErrInvalidExpiresIn
+	}
+	return ttl, nil
+}
+
+// Expire sets the expiry of every key to ttl from now, or clears it when ttl is zero. It
+// returns the expiry that was set, zero when cleared, and one error per key, nil where the
+// key was updated.
+func (s *URLStore) Expire(keys []string, ttl time.Duration) (time.Time, []error) {
+	errs := make([]error, len(keys))
+	if err := s.checkWritable(); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return time.Time{}, errs
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+	}
+
+	updated := false
+	for i, key := range keys {
+		rec, found := s.urls[key]
+		if !found || rec.expired(now) {
+			errs[i] = ErrLinkNotFound
+			continue
+		}
+		rec.ExpiresAt = expiresAt
+		s.urls[key] = rec // Indexes don't cover expiry, so putLocked isn't needed
+		s.markDirtyLocked(key)
+		updated = true
+	}
+
+	if updated {
+		s.saveAsync()
+	}
+	return expiresAt, errs
+}
+
+// handleExpire serves POST /shorty/expire with a body of
+// {"keys": ["a", "b"], "expiresIn": "72h"}. An expiresIn of "0s" clears the expiry.
+func (h *urlHandler) handleExpire(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) || !h.requireJSONBody(w, r) {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var requestData struct {
+		Keys      []string `json:"keys"`
+		ExpiresIn string   `json:"expiresIn"`
+	}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		writeError(w, r, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if len(requestData.Keys) == 0 {
+		writeError(w, r, "At least one key is required", http.StatusBadRequest)
+		return
+	}
+	if len(requestData.Keys) > maxBulkItems {
+		writeError(w, r, fmt.Sprintf("At most %d keys are allowed per request", maxBulkItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+	ttl, err := time.ParseDuration(requestData.ExpiresIn)
+	if err != nil || ttl < 0 {
+		writeError(w, r, "ExpiresIn must be a non-negative duration such as 72h", http.StatusBadRequest)
+		return
+	}
+
+	type itemResponse struct {
+		ShortKey  string    `json:"shortKey"`
+		Status    int       `json:"status"`
+		ExpiresAt time.Time `json:"expiresAt,omitzero"`
+		Error     string    `json:"error,omitempty"`
+	}
+	responseData := make([]itemResponse, len(requestData.Keys))
+	expiresAt, errs := h.store.Expire(requestData.Keys, ttl)
+	for i, err := range errs {
+		key := requestData.Keys[i]
+		if err != nil {
+			status := storeErrorStatus(err)
+			msg := err.Error()
+			if status == http.StatusInternalServerError {
+				msg = "Failed to update expiry"
+			}
+			responseData[i] = itemResponse{ShortKey: key, Status: status, Error: msg}
+			continue
+		}
+		responseData[i] = itemResponse{ShortKey: key, Status: http.StatusOK, ExpiresAt: expiresAt}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(responseData)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// =======================================================================================
+// Export & Import - Full-fidelity backups of the store. The export carries every Record
+// field (clicks included) so a restore loses nothing; imports also accept the older plain
+// key -> URL map. Replace swaps in a whole dataset at once for blue/green data updates.
+// =======================================================================================
+
+var ErrDanglingAlias = errors.New("alias target is missing from the dataset")
+
+// Export returns a copy of every record in the store.
+func (s *URLStore) Export() map[string]Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make(map[string]Record, len(s.urls))
+	for key, rec := range s.urls {
+		records[key] = rec
+	}
+	return records
+}
+
+// ExportMatching returns a copy of the records filter matches. Aliases are judged by the
+// link they point to, so they come along with it and never without it.
+func (s *URLStore) ExportMatching(filter linkFilter) map[string]Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make(map[string]Record)
+	for key, rec := range s.urls {
+		target := rec
+		if rec.AliasOf != "" {
+			target = s.urls[rec.AliasOf]
+		}
+		if filter.matches(target) {
+			records[key] = rec
+		}
+	}
+	return records
+}
+
+// Import merges records into the store, replacing any existing links with the same keys.
+// Every record is validated first so a bad entry leaves the store untouched, and aliases
+// must point at a link in records or in the store, never at another alias.
+func (s *URLStore) Import(records map[string]Record) error {
+	if err := s.validateRecords(records); err != nil {
+		return err
+	}
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range records {
+		if s.urls[key].inBin() {
+			return fmt.Errorf("%w: %s is in the recycle bin", ErrKeyExists, key)
+		}
+	}
+	if err := s.checkMergedAliasesLocked(records); err != nil {
+		return err
+	}
+	if s.cfg.MaxLinks > 0 && s.cfg.EvictionPolicy == EvictReject {
+		added := 0
+		for key := range records {
+			if _, exists := s.urls[key]; !exists {
+				added++
+			}
+		}
+		if len(s.urls)+added > s.cfg.MaxLinks {
+			return ErrStoreFull
+		}
+	}
+
+	for key, rec := range records {
+		if err := s.makeRoom(key); err != nil {
+			return err
+		}
+		s.putLocked(key, rec)
+	}
+
+	s.saveAsync()
+	return nil
+}
+
+// checkMergedAliasesLocked fails with ErrDanglingAlias if merging records into the store
+// would leave an alias pointing at a missing key or at another alias, including an alias
+// already stored whose link records turns into an alias. Must be called with s.mu held.
+func (s *URLStore) checkMergedAliasesLocked(records map[string]Record) error {
+	merged := func(key string) (Record, bool) {
+		if rec, found := records[key]; found {
+			return rec, true
+		}
+		rec, found := s.urls[key]
+		return rec, found
+	}
+	for key, rec := range records {
+		if rec.AliasOf == "" {
+			continue
+		}
+		if target, found := merged(rec.AliasOf); !found || target.AliasOf != "" {
+			return fmt.Errorf("key %q: %w", key, ErrDanglingAlias)
+		}
+		for alias := range s.aliases[key] {
+			if _, replaced := records[alias]; !replaced {
+				return fmt.Errorf("key %q: %w", alias, ErrDanglingAlias)
+			}
+		}
+	}
+	return nil
+}
+
+// Replace makes records the store's entire contents in one step, so readers see either
+// the old or the new dataset and never a mix, then saves. Nothing changes unless every
+// record is valid and aliases point at links within records. Expired records are
+// dropped. If the save fails the new dataset stays in memory and is retried with the
+// next save.
+func (s *URLStore) Replace(ctx context.Context, records map[string]Record) error {
+	if err := s.validateRecords(records); err != nil {
+		return err
+	}
+	for key, rec := range records {
+		if target, found := records[rec.AliasOf]; rec.AliasOf != "" && (!found || target.AliasOf != "") {
+			return fmt.Errorf("key %q: %w", key, ErrDanglingAlias)
+		}
+	}
+	if s.cfg.MaxLinks > 0 && len(records) > s.cfg.MaxLinks {
+		return ErrStoreFull
+	}
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.replaceLocked(records)
+	s.mu.Unlock()
+	return s.saveSync(ctx)
+}
+
+// validateRecords applies the checks every stored record must pass.
+func (s *URLStore) validateRecords(records map[string]Record) error {
+	for key, rec := range records {
+		if err := validateKey(key, s.cfg); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		if err := validateDestination(rec.URL, s.cfg); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		if err := validateTags(rec.Tags); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		if err := validateCollection(rec.Collection); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		if err := validateDescription(rec.Description); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		if err := validateMaxClicks(rec.MaxClicks, rec.NoTracking); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		if err := validateLinkHeaders(rec.Headers); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		if err := validateRedirect(rec.RedirectMode, rec.RedirectStatus, rec.Permanent); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		if err := validateDevices(rec.Devices, s.cfg); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		if err := validateCountries(rec.Countries, s.cfg); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		if err := validateVariants(rec.Variants, len(rec.Devices) > 0 || len(rec.Countries) > 0, rec.Permanent, rec.RedirectStatus, s.cfg); err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (h *urlHandler) handleExport(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	filter, ok := parseLinkFilter(w, r)
+	if !ok {
+		return
+	}
+	export := h.store.Export
+	if filter != (linkFilter{}) {
+		export = func() map[string]Record { return h.store.ExportMatching(filter) }
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+	case "csv":
+		writeCSVExport(w, export())
+		return
+	default:
+		writeError(w, r, "Format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	pretty, err := strconv.ParseBool(r.URL.Query().Get("pretty"))
+	if err != nil && r.URL.Query().Has("pretty") {
+		writeError(w, r, "Pretty must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="urls-export.json"`)
+	enc := json.NewEncoder(w)
+	if pretty {
+		enc.SetIndent("", "  ") // Keys are sorted either way, so exports diff cleanly
+	}
+	enc.Encode(export())
+}
+
+// writeCSVExport writes one row per record, ordered by short key. It is a summary for
+// spreadsheets, not a backup: fields other than these columns are left out, and
+// imports only accept JSON.
+func writeCSVExport(w http.ResponseWriter, records map[string]Record) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="urls-export.csv"`)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"shortKey", "longURL", "clicks", "createdAt", "expiresAt"})
+	for _, key := range slices.Sorted(maps.Keys(records)) {
+		rec := records[key] // An alias's URL is a copy of its target's; see putLocked
+		out.Write([]string{key, rec.URL, strconv.FormatUint(rec.Clicks, 10), csvTime(rec.CreatedAt), csvTime(rec.ExpiresAt)})
+	}
+	out.Flush()
+}
+
+// csvTime formats t as RFC 3339, leaving the cell empty for the zero time.
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (h *urlHandler) handleImport(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+	case "csv":
+		h.handleCSVImport(w, r, genericCSVColumns)
+		return
+	case "bitly-csv":
+		h.handleCSVImport(w, r, bitlyCSVColumns)
+		return
+	default:
+		writeError(w, r, "Format must be json, csv or bitly-csv", http.StatusBadRequest)
+		return
+	}
+	if !h.requireJSONBody(w, r) {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var records map[string]Record
+	if err := json.Unmarshal(body, &records); err != nil {
+		writeError(w, r, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.Import(records); err != nil {
+		storeError(w, r, err, "Failed to import links")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Imported int `json:"imported"`
+	}{
+		Imported: len(records),
+	})
+}
+
+// handleReplace serves POST /shorty/replace with a body in the export format.
+func (h *urlHandler) handleReplace(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) || !h.requireJSONBody(w, r) {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	var records map[string]Record
+	if err := json.Unmarshal(body, &records); err != nil {
+		writeError(w, r, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.Replace(r.Context(), records); err != nil {
+		storeError(w, r, err, "Failed to replace links")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Links int `json:"links"`
+	}{
+		Links: h.store.Len(),
+	})
+}
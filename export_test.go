@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestImportRejectsDanglingAndChainedAliases(t *testing.T) {
+	s := newTestStore(t, testConfig(t))
+	link := addTestLink(t, s, "https://example.com/a")
+	other := addTestLink(t, s, "https://example.com/b")
+	if _, err := s.Alias(link, "a1", "", false); err != nil {
+		t.Fatal(err)
+	}
+	alias := func(target string) Record {
+		return Record{URL: "https://example.com/a", AliasOf: target}
+	}
+
+	tests := []struct {
+		name    string
+		records map[string]Record
+	}{
+		{"missing target", map[string]Record{"dang": alias("nope")}},
+		{"stored alias", map[string]Record{"a2": alias("a1")}},
+		{"chain within the import", map[string]Record{"a3": alias("a2"), "a2": alias("a1")}},
+		{"link of a stored alias", map[string]Record{link: alias(other)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Import(tt.records); !errors.Is(err, ErrDanglingAlias) {
+				t.Fatalf("got %v, want ErrDanglingAlias", err)
+			}
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			if len(s.urls) != 3 || s.urls[link].AliasOf != "" {
+				t.Error("the rejected import changed the store")
+			}
+		})
+	}
+
+	if err := s.Import(map[string]Record{"a2": alias(link)}); err != nil {
+		t.Errorf("importing an alias of a stored link: %v", err)
+	}
+}
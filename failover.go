@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// =======================================================================================
+// Failover - A link created with "fallbacks": ["https://mirror.example", ...] keeps its
+// url as the primary destination and the fallbacks as backups, in order. Every
+// SHORTY_FAILOVER_INTERVAL the destinations of such links are probed in the background,
+// and visitors are redirected to the first one that answered, back to the primary as soon
+// as it recovers. When every destination is down, visitors still go to the primary.
+// Proxied links also fail over per request: a destination that can't be fetched right
+// away is skipped for the next one. Fallback links can't be permanent, since caches
+// would keep sending visitors to the primary.
+// =======================================================================================
+
+const (
+	maxFallbacks            = 4
+	defaultFailoverInterval = time.Minute
+)
+
+var ErrInvalidFallbacks = errors.New("invalid fallbacks")
+
+// validateFallbacks checks the fallback count and destinations.
+func validateFallbacks(fallbacks []string, splitsVisitors, permanent bool, status int, cfg Config) error {
+	permanent = permanent || status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+	switch {
+	case len(fallbacks) == 0:
+		return nil
+	case len(fallbacks) > maxFallbacks:
+		return fmt.Errorf("%w: a link has at most %d fallbacks", ErrInvalidFallbacks, maxFallbacks)
+	case splitsVisitors:
+		return fmt.Errorf("%w: fallbacks can't be combined with devices, countries or variants", ErrInvalidFallbacks)
+	case permanent:
+		return fmt.Errorf("%w: fallbacks can't be permanent, since caches would keep the primary", ErrInvalidFallbacks)
+	}
+	for i, fallback := range fallbacks {
+		if err := validateDestination(fallback, cfg); err != nil {
+			return fmt.Errorf("%w: fallback %d: %w", ErrInvalidFallbacks, i, err)
+		}
+	}
+	return nil
+}
+
+// applyFallbackPoliciesLocked rewrites each fallback the way a link's url is rewritten
+// before it is stored. Must be called with s.mu held.
+func (s *URLStore) applyFallbackPoliciesLocked(fallbacks []string) ([]string, error) {
+	if len(fallbacks) == 0 {
+		return nil, nil
+	}
+	applied := make([]string, len(fallbacks))
+	for i, fallback := range fallbacks {
+		targets, err := s.applyTargetPoliciesLocked(map[string]string{"": fallback})
+		if err != nil {
+			return nil, err
+		}
+		applied[i] = targets[""]
+	}
+	return applied, nil
+}
+
+// destinations returns rec's url followed by its fallbacks, in the order they are tried.
+func (rec Record) destinations() []string {
+	candidates := []string{rec.URL}
+	for _, fallback := range rec.Fallbacks {
+		if fallback != rec.URL {
+			candidates = append(candidates, fallback)
+		}
+	}
+	return candidates
+}
+
+// FailoverDestinations returns every distinct destination of links with fallbacks.
+func (s *URLStore) FailoverDestinations() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var destinations []string
+	for _, rec := range s.urls {
+		if len(rec.Fallbacks) == 0 || rec.AliasOf != "" {
+			continue
+		}
+		for _, destination := range rec.destinations() {
+			if !seen[destination] {
+				seen[destination] = true
+				destinations = append(destinations, destination)
+			}
+		}
+	}
+	return destinations
+}
+
+// healthChecker reports whether a destination answers; destinationChecker is one.
+type healthChecker interface {
+	Check(ctx context.Context, longURL string) error
+}
+
+// failoverMonitor probes the destinations of links with fallbacks and remembers which
+// are down.
+type failoverMonitor struct {
+	store   *URLStore
+	checker healthChecker
+
+	mu   sync.RWMutex
+	down map[string]bool // Destinations that failed their last check
+}
+
+func newFailoverMonitor(store *URLStore, checker healthChecker) *failoverMonitor {
+	return &failoverMonitor{store: store, checker: checker, down: make(map[string]bool)}
+}
+
+// start checks every interval for the life of the process, starting right away.
+func (m *failoverMonitor) start(interval time.Duration) {
+	go func() {
+		m.checkAll(context.Background())
+		for range time.Tick(interval) {
+			m.checkAll(context.Background())
+		}
+	}()
+}
+
+// checkAll probes every destination of links with fallbacks. Destinations no link has
+// any more are forgotten.
+func (m *failoverMonitor) checkAll(ctx context.Context) {
+	down := make(map[string]bool)
+	for _, destination := range m.store.FailoverDestinations() {
+		if err := m.checker.Check(ctx, destination); err != nil {
+			down[destination] = true
+		}
+	}
+
+	m.mu.Lock()
+	for destination := range down {
+		if !m.down[destination] {
+			slog.Warn("Link destination is down, failing over", "url", destination)
+		}
+	}
+	for destination := range m.down {
+		if !down[destination] {
+			slog.Info("Link destination recovered", "url", destination)
+		}
+	}
+	m.down = down
+	m.mu.Unlock()
+}
+
+// destination returns where to send visitors of rec: its first destination that isn't
+// down, or its url when all of them are.
+func (m *failoverMonitor) destination(rec Record) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, candidate := range rec.destinations() {
+		if !m.down[candidate] {
+			return candidate
+		}
+	}
+	return rec.URL
+}
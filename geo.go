@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// =======================================================================================
+// Country Targets - With SHORTY_GEOIP_DB pointing at a MaxMind country or city database,
+// a link may send visitors from some countries to destinations of their own, set with
+// "countries": {"DE": "...", "FR": "..."} at create. The database is read into memory at
+// startup, so a lookup never waits on disk or the network. Visitors whose country isn't
+// listed or can't be told get the device target or url as usual; a country target takes
+// precedence over a device target.
+// =======================================================================================
+
+var (
+	ErrInvalidCountries = errors.New("invalid countries")
+	ErrGeoDisabled      = errors.New(`"countries" requires SHORTY_GEOIP_DB`)
+)
+
+// geoResolver returns the ISO 3166-1 alpha-2 code of the country ip is in, or "" when it
+// isn't known.
+type geoResolver interface {
+	Country(ip net.IP) (string, error)
+}
+
+// maxmindResolver looks countries up in a MaxMind database held in memory.
+type maxmindResolver struct {
+	db *maxminddb.Reader
+}
+
+func newMaxmindResolver(path string) (*maxmindResolver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("reading GeoIP database: %w", err)
+	}
+	return &maxmindResolver{db: db}, nil
+}
+
+func (m *maxmindResolver) Country(ip net.IP) (string, error) {
+	var result struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := m.db.Lookup(ip, &result); err != nil {
+		return "", err
+	}
+	return result.Country.ISOCode, nil
+}
+
+// validateCountries checks that each rule is keyed by an upper-case two-letter country
+// code and that each target would be accepted as a link's url.
+func validateCountries(countries map[string]string, cfg Config) error {
+	for country, target := range countries {
+		if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+			return fmt.Errorf("%w: %q is not an upper-case two-letter country code such as \"DE\"", ErrInvalidCountries, country)
+		}
+		if err := validateDestination(target, cfg); err != nil {
+			return fmt.Errorf("%w: %s target: %w", ErrInvalidCountries, country, err)
+		}
+	}
+	return nil
+}
+
+// countryTarget returns rec with URL set to the destination for the visitor's country,
+// or unchanged when the country has no target or can't be looked up.
+func (h *urlHandler) countryTarget(r *http.Request, rec Record) (Record, bool) {
+	ip := net.ParseIP(clientIP(r, h.cfg.TrustedProxies))
+	if h.geo == nil || ip == nil {
+		return rec, false
+	}
+	country, err := h.geo.Country(ip)
+	if err != nil {
+		slog.Debug("GeoIP lookup failed", "ip", ip, "error", err)
+		return rec, false
+	}
+	target, found := rec.Countries[country]
+	if !found {
+		return rec, false
+	}
+	rec.URL = target
+	return rec, true
+}
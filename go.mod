@@ -2,12 +2,21 @@ module go-shorty
 
 go 1.24.0
 
-require github.com/gogo/status v1.1.1
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/gogo/status v1.1.1
+	github.com/oschwald/maxminddb-golang v1.13.1
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/net v0.43.0
+)
 
 require (
 	github.com/gogo/googleapis v0.0.0-20180223154316-0cd9801be74a // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/protobuf v1.3.2 // indirect
+	golang.org/x/sys v0.35.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
 	google.golang.org/genproto v0.0.0-20180518175338-11a468237815 // indirect
 	google.golang.org/grpc v1.12.0 // indirect
 )
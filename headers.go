@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// =======================================================================================
+// Link Headers - Fixed response headers a creator attaches to a link, such as a stricter
+// Referrer-Policy, sent with every redirect. Only an allowlist of names plus X- headers
+// is accepted, so a link can't override the redirect itself, set cookies or send
+// hop-by-hop headers.
+// =======================================================================================
+
+const (
+	maxLinkHeaders      = 10
+	maxHeaderValueBytes = 256
+)
+
+var ErrInvalidHeaders = errors.New("invalid headers")
+
+// allowedLinkHeaders are the standard headers a link may set, in canonical form.
+var allowedLinkHeaders = map[string]bool{
+	"Referrer-Policy":         true,
+	"X-Robots-Tag":            true,
+	"Link":                    true,
+	"Content-Security-Policy": true,
+	"Permissions-Policy":      true,
+	"Timing-Allow-Origin":     true,
+}
+
+// validateLinkHeaders checks the header count, names and values. Names are matched
+// case-insensitively.
+func validateLinkHeaders(headers map[string]string) error {
+	if len(headers) > maxLinkHeaders {
+		return fmt.Errorf("%w: at most %d headers are allowed", ErrInvalidHeaders, maxLinkHeaders)
+	}
+
+	seen := make(map[string]bool, len(headers))
+	for name, value := range headers {
+		key := http.CanonicalHeaderKey(name)
+		if !linkHeaderAllowed(key) {
+			return fmt.Errorf("%w: %q may not be set on a link", ErrInvalidHeaders, name)
+		}
+		if len(value) > maxHeaderValueBytes || strings.ContainsFunc(value, func(c rune) bool { return c < ' ' || c == 0x7f }) {
+			return fmt.Errorf("%w: value of %q must be at most %d printable bytes", ErrInvalidHeaders, name, maxHeaderValueBytes)
+		}
+		if seen[key] {
+			return fmt.Errorf("%w: duplicate header %q", ErrInvalidHeaders, key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// setLinkHeaders adds rec's headers to the response.
+func setLinkHeaders(w http.ResponseWriter, rec Record) {
+	for name, value := range rec.Headers {
+		w.Header().Set(name, value)
+	}
+}
+
+// linkHeaderAllowed reports whether a link may set the canonical header name. X- headers
+// are open for tracking and similar uses, apart from the proxy ones.
+func linkHeaderAllowed(name string) bool {
+	for _, c := range name {
+		if !isKeyChar(c) || c == '_' {
+			return false
+		}
+	}
+	if allowedLinkHeaders[name] {
+		return true
+	}
+	return strings.HasPrefix(name, "X-") && len(name) > 2 &&
+		!strings.HasPrefix(name, "X-Forwarded-") && name != "X-Real-Ip"
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// =======================================================================================
+// Health - Background saves can fail silently (full disk, permission changes), so the
+// store counts consecutive failures and reports them through /healthz. Optionally, Add
+// starts refusing new links once the failures pass a threshold, instead of accepting data
+// that won't reach the disk. /healthz also reports when and how quickly the last save
+// completed, and warns when changes have waited too long to be saved. A background save
+// that panics is recovered and counted as a failure rather than crashing the process.
+// =======================================================================================
+
+// defaultSaveStaleAfter is how long a change may wait for a save before /healthz warns.
+const defaultSaveStaleAfter = 5 * time.Minute
+
+var (
+	ErrSaveUnavailable = errors.New("links cannot be saved right now")
+	ErrSavePanicked    = errors.New("save panicked")
+)
+
+// saveStatus tracks the outcome of recent saves. Guarded by URLStore.healthMu.
+type saveStatus struct {
+	consecutiveFailures int
+	lastError           string
+
+	lastSaved    time.Time     // When the last successful save finished
+	lastDuration time.Duration // How long it took
+	pendingSince time.Time     // First change not yet covered by a successful save
+}
+
+// recordSave notes the result of a save attempt.
+func (s *URLStore) recordSave(err error) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	if err == nil {
+		s.health.consecutiveFailures = 0
+		s.health.lastError = ""
+		return
+	}
+	s.health.consecutiveFailures++
+	s.health.lastError = err.Error()
+}
+
+// notePending records that the store has changed and needs saving.
+func (s *URLStore) notePending() {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	if s.health.pendingSince.IsZero() {
+		s.health.pendingSince = time.Now()
+	}
+}
+
+// noteSaved records a successful save of a snapshot taken at snapshotAt. Changes made
+// after the snapshot stay pending.
+func (s *URLStore) noteSaved(snapshotAt time.Time, duration time.Duration) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.health.lastSaved = time.Now()
+	s.health.lastDuration = duration
+	if s.health.pendingSince.Before(snapshotAt) {
+		s.health.pendingSince = time.Time{}
+	}
+}
+
+func (s *URLStore) saveHealth() saveStatus {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	return s.health
+}
+
+// checkWritable returns ErrReadOnly on a read-only replica, ErrMaintenance in maintenance
+// mode, and ErrSaveUnavailable once consecutive save failures reach the configured
+// threshold. Each such refusal also retries the save, so the store recovers on its own
+// when the disk does.
+func (s *URLStore) checkWritable() error {
+	if s.cfg.ReadOnly {
+		return ErrReadOnly
+	}
+	if s.maintenance.Load() {
+		return ErrMaintenance
+	}
+	if s.cfg.SaveFailureThreshold == 0 {
+		return nil
+	}
+	if s.saveHealth().consecutiveFailures < s.cfg.SaveFailureThreshold {
+		return nil
+	}
+	s.saveAsync()
+	return ErrSaveUnavailable
+}
+
+func (h *urlHandler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	health := h.store.saveHealth()
+
+	responseData := struct {
+		Status           string    `json:"status"`
+		SaveFailures     int       `json:"saveFailures"`
+		LastSaveError    string    `json:"lastSaveError,omitempty"`
+		LastSave         time.Time `json:"lastSave,omitzero"`
+		LastSaveDuration string    `json:"lastSaveDuration,omitempty"`
+		UnsavedSince     time.Time `json:"unsavedSince,omitzero"`
+		ReadOnly         bool      `json:"readOnly,omitempty"`
+		Maintenance      bool      `json:"maintenance,omitempty"`
+		ClicksDropped    uint64    `json:"clickEventsDropped,omitempty"`
+		WebhooksDropped  uint64    `json:"webhookEventsDropped,omitempty"`
+	}{
+		Status:          "ok",
+		ReadOnly:        h.cfg.ReadOnly,
+		Maintenance:     h.store.InMaintenance(),
+		ClicksDropped:   h.clicks.Dropped(),
+		WebhooksDropped: h.hook.Dropped(),
+		SaveFailures:    health.consecutiveFailures,
+		LastSaveError:   health.lastError,
+		LastSave:        health.lastSaved,
+		UnsavedSince:    health.pendingSince,
+	}
+	if !health.lastSaved.IsZero() {
+		responseData.LastSaveDuration = health.lastDuration.String()
+	}
+
+	status := http.StatusOK
+	switch {
+	case health.consecutiveFailures > 0:
+		responseData.Status = "unhealthy"
+		status = http.StatusServiceUnavailable
+	case h.cfg.SaveStaleAfter > 0 && !health.pendingSince.IsZero() && time.Since(health.pendingSince) > h.cfg.SaveStaleAfter:
+		// Saves aren't failing but aren't keeping up either, e.g. on a very slow disk.
+		responseData.Status = "warning"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(responseData)
+}
+
+// saveRecovering saves like save, but turns a panic during the save into an error, so a
+// background save can't take the server down with it. The failure is counted like any
+// other, and under Bolt every link is written again by the next save, since the panic may
+// have lost track of which ones changed.
+func (s *URLStore) saveRecovering(ctx context.Context) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			slog.Error("Save panicked", "file", s.filename, "panic", p, "stack", string(debug.Stack()))
+			err = fmt.Errorf("%w: %v", ErrSavePanicked, p)
+			if s.db != nil {
+				s.mu.Lock()
+				s.rewriteAll = true
+				s.mu.Unlock()
+			}
+		}
+	}()
+	return s.save(ctx)
+}
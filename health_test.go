@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRedirectsResolveDuringStorageOutage(t *testing.T) {
+	t.Setenv("SHORTY_SAVE_FAILURE_THRESHOLD", "2")
+	s := newTestStore(t, testConfig(t))
+	h := &urlHandler{store: s, cfg: s.cfg}
+	saves := make(chan error, 10)
+	s.onSave = func(err error) { saves <- err }
+	key := addTestLink(t, s, "https://example.com/a")
+	waitForSave(t, saves)
+
+	breakSaves(t, s)
+	for range s.cfg.SaveFailureThreshold {
+		addTestLink(t, s, "https://example.com/more")
+		select {
+		case err := <-saves:
+			if err == nil {
+				t.Fatal("save succeeded although the data directory is gone")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no save was attempted")
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); s.saveHealth().consecutiveFailures < s.cfg.SaveFailureThreshold; {
+		if time.Now().After(deadline) {
+			t.Fatal("failed saves were not counted")
+		}
+		time.Sleep(time.Millisecond) // onSave runs just before the failure is recorded
+	}
+
+	_, _, err := s.Add(context.Background(), AddRequest{URL: "https://example.com/b"})
+	if !errors.Is(err, ErrSaveUnavailable) || storeErrorStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("Add during the outage: got %v, want ErrSaveUnavailable (503)", err)
+	}
+	if err := s.Delete(key, ""); !errors.Is(err, ErrSaveUnavailable) {
+		t.Errorf("Delete during the outage: got %v, want ErrSaveUnavailable", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+key, nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/a" {
+		t.Errorf("redirect during the outage answered %d to %q", w.Code, w.Header().Get("Location"))
+	}
+}
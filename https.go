@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// =======================================================================================
+// HTTPS Destinations - SHORTY_HTTPS_DESTINATIONS keeps short links from sending visitors
+// over plain HTTP. "reject" refuses http:// destinations; "upgrade" stores them as
+// https://, for sites known to serve both. Imported records are checked under "reject"
+// but stored as they are under "upgrade".
+// =======================================================================================
+
+const (
+	HTTPSOff     = "off"
+	HTTPSReject  = "reject"
+	HTTPSUpgrade = "upgrade"
+)
+
+var ErrInsecureURL = errors.New("url must use https")
+
+// applyHTTPSPolicy returns the URL to store for longURL under HTTPSUpgrade. It runs after
+// validateDestination, so longURL starts with a valid scheme.
+func (s *URLStore) applyHTTPSPolicy(longURL string) string {
+	if s.cfg.HTTPSDestinations != HTTPSUpgrade || len(longURL) < len("http:") || !strings.EqualFold(longURL[:len("http:")], "http:") {
+		return longURL
+	}
+	return "https:" + longURL[len("http:"):]
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// =======================================================================================
+// IDN Hosts - With SHORTY_ASCII_HOSTS, internationalized host names are stored in their
+// ASCII (punycode) form, so "bücher.example" and "xn--bcher-kva.example" are one
+// destination for host rules and duplicate detection, and lookalike Unicode hosts show
+// their true spelling. Only the host is rewritten; path and query are kept byte for byte.
+// =======================================================================================
+
+var errInvalidIDN = fmt.Errorf("%w: host is not a valid internationalized domain name", ErrInvalidURL)
+
+// asciiHost returns host in its ASCII form, mapping and validating non-ASCII hosts per
+// IDNA's lookup profile. ASCII-only hosts are returned unchanged.
+func asciiHost(host string) (string, error) {
+	if isASCII(host) {
+		return host, nil
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", errInvalidIDN
+	}
+	return ascii, nil
+}
+
+// asciiHostURL rewrites the host of longURL with asciiHost, leaving the rest of the URL as
+// it was sent.
+func asciiHostURL(longURL string) (string, error) {
+	u, err := url.Parse(longURL)
+	if err != nil || isASCII(u.Host) {
+		return longURL, nil // Invalid URLs are left for validateDestination to reject
+	}
+	host, err := asciiHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	// The authority sits between "scheme://" and the first '/', '?' or '#', and the host
+	// after any userinfo.
+	start := len(u.Scheme) + len("://")
+	end := len(longURL)
+	if i := strings.IndexAny(longURL[start:], "/?#"); i >= 0 {
+		end = start + i
+	}
+	if at := strings.LastIndex(longURL[start:end], "@"); at >= 0 {
+		start += at + 1
+	}
+	if !strings.HasPrefix(longURL[start:end], u.Hostname()) {
+		return "", errInvalidIDN // A percent-encoded host, which this doesn't rewrite
+	}
+	return longURL[:start] + host + longURL[start+len(u.Hostname()):], nil
+}
+
+// applyASCIIHosts returns the URL to store for longURL under Config.ASCIIHosts.
+func (s *URLStore) applyASCIIHosts(longURL string) (string, error) {
+	if !s.cfg.ASCIIHosts {
+		return longURL, nil
+	}
+	return asciiHostURL(longURL)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestASCIIHostURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"https://bücher.example/Straße?q=ü&x=%20#Ä", "https://xn--bcher-kva.example/Straße?q=ü&x=%20#Ä"},
+		{"https://user:pw@BÜCHER.example:8443/a/b", "https://user:pw@xn--bcher-kva.example:8443/a/b"},
+		{"https://例え.テスト/パス", "https://xn--r8jz45g.xn--zckzah/パス"},
+		{"https://example.com/ü?q=ü", "https://example.com/ü?q=ü"},
+	}
+	for _, tt := range tests {
+		got, err := asciiHostURL(tt.in)
+		if err != nil {
+			t.Errorf("asciiHostURL(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("asciiHostURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := asciiHostURL("https://a\u200d.example/"); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("invalid IDN: got error %v, want %v", err, ErrInvalidURL)
+	}
+}
+
+func TestAddStoresASCIIHost(t *testing.T) {
+	t.Setenv("SHORTY_ASCII_HOSTS", "true")
+	s := newTestStore(t, testConfig(t))
+	key := addTestLink(t, s, "https://bücher.example/Straße?q=ü")
+	rec, _ := s.Lookup(key)
+	if want := "https://xn--bcher-kva.example/Straße?q=ü"; rec.URL != want {
+		t.Errorf("stored %q, want %q", rec.URL, want)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =======================================================================================
+// CSV Import - POST /import?format=csv loads links exported by other shorteners. Columns
+// are picked by header name, and format=bitly-csv presets the names of Bitly's export.
+// Unlike JSON imports, which restore a backup all or nothing, rows are imported one by
+// one: bad rows are reported and skipped so one typo doesn't hold up a migration.
+// =======================================================================================
+
+// What a CSV import does with a key that is already stored.
+const (
+	ImportOverwrite = "overwrite"
+	ImportSkip      = "skip"
+)
+
+// csvColumns names the header of each column a CSV import reads. Clicks is optional.
+type csvColumns struct {
+	key, url, clicks string
+}
+
+var (
+	genericCSVColumns = csvColumns{key: "key", url: "url", clicks: "clicks"}
+	bitlyCSVColumns   = csvColumns{key: "bitlink", url: "long url", clicks: "clicks"}
+)
+
+// CSVRow is one link read from a CSV import. Row is the line it starts on, counting the
+// header as line 1.
+type CSVRow struct {
+	Row    int
+	Key    string
+	URL    string
+	Clicks uint64
+}
+
+// CSVRowError reports why a row was not imported.
+type CSVRowError struct {
+	Row   int    `json:"row"`
+	Key   string `json:"shortKey,omitempty"`
+	Error string `json:"error"`
+}
+
+// normalizeHeader makes "Long URL", "long_url" and "LONG-URL" the same column name.
+func normalizeHeader(name string) string {
+	return strings.NewReplacer("_", " ", "-", " ").Replace(strings.ToLower(strings.TrimSpace(name)))
+}
+
+// readCSVRows parses a CSV export. Keys may be given as full short links such as
+// "https://bit.ly/abc123", since keys never contain a slash. Rows that can't be parsed
+// are returned as errors alongside the rows that can.
+func readCSVRows(body io.Reader, columns csvColumns) ([]CSVRow, []CSVRowError, error) {
+	in := csv.NewReader(body)
+	in.FieldsPerRecord = -1 // Ragged rows are reported per row below
+	header, err := in.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading header: %w", err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[normalizeHeader(name)] = i
+	}
+	keyCol, hasKey := index[normalizeHeader(columns.key)]
+	urlCol, hasURL := index[normalizeHeader(columns.url)]
+	clicksCol, hasClicks := index[normalizeHeader(columns.clicks)]
+	if !hasKey || !hasURL {
+		return nil, nil, fmt.Errorf("header must have %q and %q columns", columns.key, columns.url)
+	}
+
+	var rows []CSVRow
+	var errs []CSVRowError
+	for {
+		fields, err := in.Read()
+		if err == io.EOF {
+			return rows, errs, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			errs = append(errs, CSVRowError{Row: parseErr.StartLine, Error: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := in.FieldPos(0) // Quoted fields may span lines, so count as the reader does
+		if keyCol >= len(fields) || urlCol >= len(fields) || hasClicks && clicksCol >= len(fields) {
+			errs = append(errs, CSVRowError{Row: line, Error: "row has too few columns"})
+			continue
+		}
+
+		row := CSVRow{Row: line, URL: strings.TrimSpace(fields[urlCol])}
+		row.Key = strings.TrimSpace(fields[keyCol])
+		row.Key = row.Key[strings.LastIndex(row.Key, "/")+1:]
+		if hasClicks {
+			if value := strings.TrimSpace(fields[clicksCol]); value != "" {
+				if row.Clicks, err = strconv.ParseUint(value, 10, 64); err != nil {
+					errs = append(errs, CSVRowError{Row: line, Key: row.Key, Error: "clicks must be a non-negative integer"})
+					continue
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// ImportRows stores each row as a link, validating it like a create by an admin. Existing
+// keys are replaced, or left alone with ImportSkip; keys in the recycle bin are always
+// left alone. It returns how many rows were stored
+// and skipped, and an error for each row that was rejected.
+func (s *URLStore) ImportRows(rows []CSVRow, mode string) (imported, skipped int, errs []CSVRowError) {
+	if err := s.checkWritable(); err != nil {
+		for _, row := range rows {
+			errs = append(errs, CSVRowError{Row: row.Row, Key: row.Key, Error: err.Error()})
+		}
+		return 0, 0, errs
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, row := range rows {
+		rec := Record{URL: row.URL, CreatedAt: now, Clicks: row.Clicks}
+		if s.cfg.DisplayURLs {
+			rec.DisplayURL = displayURL(row.URL)
+		}
+		err := s.validateChosenKey(row.Key, true)
+		if err == nil {
+			err = s.validateRecords(map[string]Record{row.Key: rec})
+		}
+		if existing, taken := s.urls[row.Key]; err == nil && taken && (existing.inBin() || !existing.expired(now) && mode == ImportSkip) {
+			skipped++
+			continue
+		}
+		if err == nil {
+			err = s.makeRoom(row.Key)
+		}
+		if err != nil {
+			errs = append(errs, CSVRowError{Row: row.Row, Key: row.Key, Error: err.Error()})
+			continue
+		}
+		s.putLocked(row.Key, rec)
+		imported++
+	}
+
+	if imported > 0 {
+		s.saveAsync()
+	}
+	return imported, skipped, errs
+}
+
+// handleCSVImport serves POST /import?format=csv or bitly-csv. The keyColumn, urlColumn
+// and clicksColumn parameters override the header names read.
+func (h *urlHandler) handleCSVImport(w http.ResponseWriter, r *http.Request, columns csvColumns) {
+	query := r.URL.Query()
+	mode := query.Get("mode")
+	switch mode {
+	case "":
+		mode = ImportOverwrite
+	case ImportOverwrite, ImportSkip:
+	default:
+		writeError(w, r, "Mode must be overwrite or skip", http.StatusBadRequest)
+		return
+	}
+	for param, column := range map[string]*string{"keyColumn": &columns.key, "urlColumn": &columns.url, "clicksColumn": &columns.clicks} {
+		if value := query.Get(param); value != "" {
+			*column = value
+		}
+	}
+
+	rows, errs, err := readCSVRows(r.Body, columns)
+	if err != nil {
+		writeError(w, r, "Invalid CSV: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	imported, skipped, rowErrs := h.store.ImportRows(rows, mode)
+	errs = append(errs, rowErrs...)
+	slices.SortFunc(errs, func(a, b CSVRowError) int { return a.Row - b.Row })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Imported int           `json:"imported"`
+		Skipped  int           `json:"skipped"`
+		Errors   []CSVRowError `json:"errors"`
+	}{
+		Imported: imported,
+		Skipped:  skipped,
+		Errors:   append([]CSVRowError{}, errs...),
+	})
+}
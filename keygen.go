@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math/big"
+)
+
+// =======================================================================================
+// Key Generation - Strategies for minting short keys when the client doesn't pick one.
+// =======================================================================================
+
+const (
+	KeyStrategyRandom  = "random"
+	KeyStrategyHash    = "hash"
+	KeyStrategyCounter = "counter"
+)
+
+// KeyGenerator proposes short keys for longURL. attempt starts at zero and grows each
+// time the previous proposal was already taken by a different link, so deterministic
+// generators can derive a fresh candidate instead of repeating themselves.
+type KeyGenerator interface {
+	Generate(longURL string, attempt int) (string, error)
+}
+
+// newKeyGenerator returns the generator for strategy. counterFile is where
+// KeyStrategyCounter keeps its high-water mark, and random feeds KeyStrategyRandom.
+func newKeyGenerator(strategy, counterFile string, random io.Reader) KeyGenerator {
+	switch strategy {
+	case KeyStrategyHash:
+		return hashKeyGenerator{length: 7}
+	case KeyStrategyCounter:
+		return &counterKeyGenerator{store: newFileCounterStore(counterFile)}
+	}
+	return randomKeyGenerator{source: random}
+}
+
+// randomKeyGenerator returns 8 random hex characters read from source, ignoring the URL.
+type randomKeyGenerator struct {
+	source io.Reader
+}
+
+func (g randomKeyGenerator) Generate(string, int) (string, error) {
+	keyBytes := make([]byte, 4)
+	if _, err := io.ReadFull(g.source, keyBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(keyBytes), nil
+}
+
+// hashKeyGenerator derives the key from the SHA-256 of the URL in base62, so the same
+// URL always maps to the same key. A truncation collision is resolved by using one more
+// character of the hash per attempt.
+type hashKeyGenerator struct {
+	length int
+}
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func (g hashKeyGenerator) Generate(longURL string, attempt int) (string, error) {
+	sum := sha256.Sum256([]byte(longURL))
+	encoded := base62(sum[:])
+	return encoded[:min(g.length+attempt, len(encoded))], nil
+}
+
+func base62(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	base := big.NewInt(int64(len(base62Alphabet)))
+	mod := new(big.Int)
+
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, base62Alphabet[mod.Int64()])
+	}
+	return string(out)
+}
+
+// SetRandomSource makes the random key strategy read from source instead of crypto/rand,
+// for deterministic tests or an approved FIPS generator. Keys are generated with s.mu
+// held, so source needn't be safe for concurrent use. Other strategies ignore it.
+func (s *URLStore) SetRandomSource(source io.Reader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys.(randomKeyGenerator); ok {
+		s.keys = randomKeyGenerator{source: source}
+	}
+}
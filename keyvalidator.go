@@ -0,0 +1,47 @@
+package main
+
+import "errors"
+
+// =======================================================================================
+// Key Validators - Deployments with naming rules of their own, such as a required prefix
+// or keys that must start with a letter, can install a KeyValidator with
+// SetKeyValidator. It runs on every chosen key, from creates, aliases and CSV imports,
+// after the built-in checks have passed, for admins too. A key it rejects gets 400 with
+// the validator's message, so that should be fit to show to clients.
+// =======================================================================================
+
+// KeyValidator checks a chosen key, returning an error to reject it.
+type KeyValidator func(key string) error
+
+// ErrKeyRejected matches every rejection by a KeyValidator.
+var ErrKeyRejected = errors.New("short key rejected")
+
+// keyRejectedError carries a KeyValidator's error, whose message is the one sent.
+type keyRejectedError struct{ err error }
+
+func (e keyRejectedError) Error() string        { return e.err.Error() }
+func (e keyRejectedError) Unwrap() error        { return e.err }
+func (e keyRejectedError) Is(target error) bool { return target == ErrKeyRejected }
+
+// SetKeyValidator makes the store check chosen keys with validate as well; nil removes
+// the validator. It is safe to call while the store is in use.
+func (s *URLStore) SetKeyValidator(validate KeyValidator) {
+	if validate == nil {
+		s.keyValidator.Store(nil)
+		return
+	}
+	s.keyValidator.Store(&validate)
+}
+
+// validateChosenKey runs validateCustomKey and then the installed KeyValidator, if any.
+func (s *URLStore) validateChosenKey(key string, admin bool) error {
+	if err := validateCustomKey(key, admin, s.cfg); err != nil {
+		return err
+	}
+	if validate := s.keyValidator.Load(); validate != nil {
+		if err := (*validate)(key); err != nil {
+			return keyRejectedError{err}
+		}
+	}
+	return nil
+}
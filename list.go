@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =======================================================================================
+// Listing - Paginated listing of stored links, optionally filtered by tag or by creation time.
+// =======================================================================================
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// List returns one page of links ordered by key, together with the total number of links
+// matching the filter. An empty tag matches every link.
+func (s *URLStore) List(tag string, limit, offset int) ([]linkView, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []string
+	if tag != "" {
+		for key := range s.byTag[tag] {
+			keys = append(keys, key)
+		}
+	} else {
+		keys = make([]string, 0, len(s.urls))
+		for key, rec := range s.urls {
+			if !rec.inBin() {
+				keys = append(keys, key)
+			}
+		}
+	}
+	slices.Sort(keys)
+
+	total := len(keys)
+	page := keys[min(offset, total):min(offset+limit, total)]
+	links := make([]linkView, len(page))
+	for i, key := range page {
+		links[i] = linkView{ShortKey: key, Record: s.urls[key]}
+	}
+	return links, total
+}
+
+// linkFilter selects links by tag and by creation time in [since, until). Empty fields
+// match every link.
+type linkFilter struct {
+	tag          string
+	since, until time.Time
+}
+
+func (f linkFilter) matches(rec Record) bool {
+	return (f.tag == "" || slices.Contains(rec.Tags, f.tag)) &&
+		(f.since.IsZero() || !rec.CreatedAt.Before(f.since)) &&
+		(f.until.IsZero() || rec.CreatedAt.Before(f.until))
+}
+
+// ListByTime returns one page of links created in [since, until), oldest first, together
+// with the total number of links in the range. A zero since or until leaves that end open.
+func (s *URLStore) ListByTime(since, until time.Time, limit, offset int) ([]linkView, int) {
+	filter := linkFilter{since: since, until: until}
+	matches := make([]linkView, 0)
+	s.Range(func(key string, rec Record) bool {
+		if !rec.inBin() && filter.matches(rec) {
+			matches = append(matches, linkView{ShortKey: key, Record: rec})
+		}
+		return true
+	})
+	slices.SortFunc(matches, func(a, b linkView) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ShortKey, b.ShortKey)
+	})
+
+	total := len(matches)
+	return matches[min(offset, total):min(offset+limit, total)], total
+}
+
+func (h *urlHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	limit, err := queryInt(query.Get("limit"), defaultListLimit)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		writeError(w, r, "Limit must be between 1 and "+strconv.Itoa(maxListLimit), http.StatusBadRequest)
+		return
+	}
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, r, "Offset must be a non-negative integer", http.StatusBadRequest)
+		return
+	}
+
+	filter, ok := parseLinkFilter(w, r)
+	if !ok {
+		return
+	}
+
+	var links []linkView
+	var total int
+	switch {
+	case filter.since.IsZero() && filter.until.IsZero():
+		links, total = h.store.List(filter.tag, limit, offset)
+	case filter.tag != "":
+		writeError(w, r, "Tag cannot be combined with since or until", http.StatusBadRequest)
+		return
+	default:
+		links, total = h.store.ListByTime(filter.since, filter.until, limit, offset)
+	}
+
+	setPageLinks(w, r, limit, offset, total)
+	switch query.Get("format") {
+	case "", "json":
+	case "text":
+		writeTextList(w, links)
+		return
+	default:
+		writeError(w, r, "Format must be json or text", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Total int        `json:"total"`
+		Links []linkView `json:"links"`
+	}{
+		Total: total,
+		Links: links,
+	})
+}
+
+// parseLinkFilter reads the tag, since and until query parameters of r, replying with
+// 400 if they are invalid.
+func parseLinkFilter(w http.ResponseWriter, r *http.Request) (linkFilter, bool) {
+	query := r.URL.Query()
+	since, err := queryTime(query.Get("since"))
+	if err != nil {
+		writeError(w, r, "Since must be an RFC 3339 timestamp", http.StatusBadRequest)
+		return linkFilter{}, false
+	}
+	until, err := queryTime(query.Get("until"))
+	if err != nil {
+		writeError(w, r, "Until must be an RFC 3339 timestamp", http.StatusBadRequest)
+		return linkFilter{}, false
+	}
+	if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+		writeError(w, r, "Since must be before until", http.StatusBadRequest)
+		return linkFilter{}, false
+	}
+	return linkFilter{tag: query.Get("tag"), since: since, until: until}, true
+}
+
+// setPageLinks sends the total in X-Total-Count and a Link header (RFC 8288) with the
+// first, previous, next and last pages of the listing, so clients can page through it
+// without building URLs. Each link repeats the request's query with another offset.
+func setPageLinks(w http.ResponseWriter, r *http.Request, limit, offset, total int) {
+	page := func(offset int, rel string) string {
+		query := r.URL.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return "<" + r.URL.EscapedPath() + "?" + query.Encode() + `>; rel="` + rel + `"`
+	}
+
+	last := max(total-1, 0) / limit * limit
+	links := []string{page(0, "first")}
+	if offset > 0 {
+		links = append(links, page(min(max(offset-limit, 0), last), "prev"))
+	}
+	if offset+limit < total {
+		links = append(links, page(offset+limit, "next"))
+	}
+	links = append(links, page(last, "last"))
+	w.Header().Set("Link", strings.Join(links, ", "))
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+}
+
+// textEscaper percent-encodes the characters that would break a key<TAB>url line.
+// Validation keeps them out of stored URLs, but an imported file may not have been checked.
+var textEscaper = strings.NewReplacer("\t", "%09", "\n", "%0A", "\r", "%0D")
+
+// writeTextList writes one key<TAB>url line per link for shell scripts.
+func writeTextList(w http.ResponseWriter, links []linkView) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	for _, link := range links {
+		bw.WriteString(textEscaper.Replace(link.ShortKey) + "\t" + textEscaper.Replace(link.URL) + "\n")
+	}
+	bw.Flush()
+}
+
+// queryTime parses an optional RFC 3339 query parameter, returning the zero time when absent.
+func queryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// queryInt parses an optional integer query parameter.
+func queryInt(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// =======================================================================================
+// Log Files - With SHORTY_LOG_FILE set, the server's own logs are written to that file as
+// JSON lines instead of to stderr as text. That file and a SHORTY_ACCESS_LOG file are
+// rotated by size: once a write would take one past SHORTY_LOG_MAX_BYTES, it is renamed
+// to name.1, older files move up to name.2 and so on, and only the newest
+// SHORTY_LOG_MAX_FILES of those are kept. A single line is never split across files.
+// =======================================================================================
+
+const (
+	defaultLogMaxBytes = 100 << 20
+	defaultLogMaxFiles = 5
+)
+
+// rotatingFile is an io.Writer appending to a file that it rotates by size. It is safe
+// for concurrent use.
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// openRotatingFile opens path for appending, creating it if needed.
+func openRotatingFile(path string, maxBytes int64, maxFiles int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			// Keep logging to the oversized file rather than losing lines.
+			fmt.Fprintf(os.Stderr, "Rotating log file %s failed: %v\n", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file to path.1, shifting older files up and deleting the one
+// past maxFiles, and starts a new file. Must be called with f.mu held.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(rotatedLogName(f.path, f.maxFiles))
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		os.Rename(rotatedLogName(f.path, i), rotatedLogName(f.path, i+1)) // Missing files are fine
+	}
+	if f.maxFiles > 0 {
+		if err := os.Rename(f.path, rotatedLogName(f.path, 1)); err != nil {
+			f.open()
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		f.open()
+		return err
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// rotatedLogName returns the name of the i-th newest rotated copy of path.
+func rotatedLogName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
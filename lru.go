@@ -0,0 +1,44 @@
+package main
+
+import "container/list"
+
+// =======================================================================================
+// Recency Tracking - Orders keys by last use so a capped store knows which link to evict.
+// =======================================================================================
+
+type recency struct {
+	order *list.List               // Front is the most recently used key
+	elems map[string]*list.Element // Key -> position in order
+}
+
+func newRecency() *recency {
+	return &recency{
+		order: list.New(),
+		elems: make(map[string]*list.Element),
+	}
+}
+
+// touch marks key as the most recently used, adding it if it is not tracked yet.
+func (r *recency) touch(key string) {
+	if elem, ok := r.elems[key]; ok {
+		r.order.MoveToFront(elem)
+		return
+	}
+	r.elems[key] = r.order.PushFront(key)
+}
+
+func (r *recency) remove(key string) {
+	if elem, ok := r.elems[key]; ok {
+		r.order.Remove(elem)
+		delete(r.elems, key)
+	}
+}
+
+// oldest returns the least recently used key.
+func (r *recency) oldest() (string, bool) {
+	elem := r.order.Back()
+	if elem == nil {
+		return "", false
+	}
+	return elem.Value.(string), true
+}
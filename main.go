@@ -1,17 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
-	"encoding/hex"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
-	"log"
+	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	_ "github.com/gogo/status"
+	bolt "go.etcd.io/bbolt"
 )
 
 // =======================================================================================
@@ -19,56 +30,594 @@ import (
 // It is now thread-safe using a sync.RWMutex to handle concurrent web requests.
 // =======================================================================================
 
+var (
+	ErrStoreFull    = errors.New("link limit reached")
+	ErrKeySpaceFull = errors.New("could not find an unused short key")
+	ErrLinkNotFound = errors.New("short link not found")
+	ErrSaveCanceled = errors.New("link was created but not saved before the request ended")
+)
+
+// keyGenAttempts is how many random keys are tried before giving up with ErrKeySpaceFull.
+const keyGenAttempts = 10
+
 type URLStore struct {
-	urls     map[string]string
-	mu       sync.RWMutex // Mutex to make our map safe for concurrent access
-	filename string
+	urls         map[string]Record
+	mu           sync.RWMutex // Mutex to make our map safe for concurrent access
+	filename     string
+	cfg          Config
+	recent       *recency // Usage order of keys, maintained only when MaxLinks is set
+	keys         KeyGenerator
+	byTag        map[string]map[string]struct{} // Tag -> keys carrying it
+	byCollection map[string]map[string]struct{} // Collection -> keys in it
+	aliases      map[string]map[string]struct{} // Key -> aliases pointing at it
+	byURL        map[string]map[string]struct{} // Destination, or its urlIndexKey -> keys holding it, aliases excluded
+	ownerLinks   map[string]int                 // Owner -> number of links they own, aliases excluded
+	checker      *destinationChecker            // Nil unless destination checks are enabled
+	activity     activityRing                   // Latest creations, for GET /activity
+
+	db         *bolt.DB            // Nil unless Config.Storage is StorageBolt; see bolt.go
+	dirty      map[string]struct{} // Keys changed since the last save, tracked only with db
+	rewriteAll bool                // The next save rewrites the database, after replaceLocked
+	secondary  *secondaryStore     // Nil unless Config.SecondaryStorage is set; see secondary.go
+	heldLinks  bool                // Any link was stored since loading; see emptysave.go
+
+	journal map[string]*journalEntry // Changes to undo if a save fails, nil unless recording; see rollback.go
+
+	saveMu      sync.Mutex   // Serializes writes so an older snapshot never overwrites a newer one
+	lastWritten [32]byte     // SHA-256 of the file last saved or loaded, guarded by saveMu; see watch.go
+	saveQueued  atomic.Bool  // A saveAsync goroutine is waiting for saveMu; see saveAsync
+	clicksDirty atomic.Bool  // Clicks not yet written, under ClickPersistEventual
+	maintenance atomic.Bool  // Changes are refused until turned off; see maintenance.go
+	linkTotal   atomic.Int64 // Links stored, aliases excluded; see totals.go
+	clickTotal  atomic.Int64 // Clicks recorded across all links
+
+	keyValidator atomic.Pointer[KeyValidator] // Nil unless set; see keyvalidator.go
+
+	events eventHub // Subscribers to store events; see events.go
+
+	healthMu sync.Mutex // Guards health separately so reporting never waits on mu
+	health   saveStatus
+
+	onSave func(error) // Called after each background save when set, for tests
 }
 
-func (s *URLStore) Add(longURL string, customKey *string) (string, error) {
-	var shortKey string
+// Add stores a new link and returns its key, and whether the link was created rather than
+// an existing one with the same URL reused. With SyncWrites the link is on disk before
+// Add returns; ctx bounds that save, and if it ends first Add fails with ErrSaveCanceled
+// while the save carries on in the background.
+func (s *URLStore) Add(ctx context.Context, req AddRequest) (string, bool, error) {
+	if err := s.validateAdd(req); err != nil {
+		return "", false, err
+	}
+	if err := s.checkWritable(); err != nil {
+		return "", false, err
+	}
+	if err := s.checkDestination(ctx, req.sampleURL()); err != nil {
+		return "", false, err
+	}
 
-	if customKey != nil {
-		shortKey = *customKey
+	rollback := s.cfg.SaveFailure == SaveFailureRollback
+	s.mu.Lock()
+	if rollback {
+		s.startJournalLocked()
+	}
+	shortKey, created, err := s.insertLocked(req)
+	var journal map[string]*journalEntry
+	if rollback {
+		journal = s.stopJournalLocked()
+	}
+	if err == nil && !s.cfg.SyncWrites {
+		s.saveAsync()
+	}
+	s.mu.Unlock()
+
+	if err != nil || !s.cfg.SyncWrites {
+		return shortKey, created, err
+	}
+	if err := s.saveSync(ctx); err != nil {
+		if rollback && !errors.Is(err, ErrSaveCanceled) && len(journal) > 0 {
+			s.rollback(journal) // A canceled save carries on and may still succeed
+		}
+		return "", false, err
+	}
+	return shortKey, created, nil
+}
+
+// validateAdd runs the checks that don't depend on the store's contents, so they can
+// happen before the write lock is taken.
+func (s *URLStore) validateAdd(req AddRequest) error {
+	if err := validateDestination(req.sampleURL(), s.cfg); err != nil {
+		return err
+	}
+	if err := validateParams(req.URL, req.Params, req.splitsVisitors() || len(req.Fallbacks) > 0 || req.Prefix); err != nil {
+		return err
+	}
+	if req.CustomKey != nil {
+		if s.cfg.CustomKeysRequireAuth && !req.Admin && req.Owner == "" {
+			return ErrKeyNeedsAuth
+		}
+		if err := s.validateChosenKey(*req.CustomKey, req.Admin); err != nil {
+			return err
+		}
+	}
+	if err := validateLinkHeaders(req.Headers); err != nil {
+		return err
+	}
+	if err := validateRedirect(req.RedirectMode, req.RedirectStatus, req.Permanent); err != nil {
+		return err
+	}
+	if err := validateDevices(req.Devices, s.cfg); err != nil {
+		return err
+	}
+	if err := validateCountries(req.Countries, s.cfg); err != nil {
+		return err
+	}
+	if len(req.Countries) > 0 && s.cfg.GeoIPDB == "" {
+		return ErrGeoDisabled
+	}
+	if err := validateVariants(req.Variants, req.hasTargets(), req.Permanent, req.RedirectStatus, s.cfg); err != nil {
+		return err
+	}
+	if err := validateFallbacks(req.Fallbacks, req.hasTargets() || len(req.Variants) > 0, req.Permanent, req.RedirectStatus, s.cfg); err != nil {
+		return err
+	}
+	if req.RedirectMode == RedirectProxy && !s.cfg.ProxyLinks {
+		return ErrProxyDisabled
+	}
+	if err := validateCollection(req.Collection); err != nil {
+		return err
+	}
+	if err := validateDescription(req.Description); err != nil {
+		return err
+	}
+	if err := validateMaxClicks(req.MaxClicks, req.NoTracking); err != nil {
+		return err
+	}
+	if _, err := req.ttl(s.cfg.DefaultTTL); err != nil {
+		return err
+	}
+	return validateTags(req.Tags)
+}
+
+// insertLocked stores a validated link under req.CustomKey, or under a generated key when
+// no custom key is given. created is false when an existing link with the same URL was
+// reused instead. Must be called with s.mu held for writing.
+func (s *URLStore) insertLocked(req AddRequest) (shortKey string, created bool, err error) {
+	req.URL = s.applySlashPolicy(s.applyHTTPSPolicy(req.URL))
+	if req.URL, err = s.applyASCIIHosts(req.URL); err != nil {
+		return "", false, err
+	}
+	if req.URL, err = s.applySelfLinkPolicyLocked(req.URL); err != nil {
+		return "", false, err
+	}
+	if req.Devices, err = s.applyTargetPoliciesLocked(req.Devices); err != nil {
+		return "", false, err
+	}
+	if req.Countries, err = s.applyTargetPoliciesLocked(req.Countries); err != nil {
+		return "", false, err
+	}
+	if req.Variants, err = s.applyVariantPoliciesLocked(req.Variants); err != nil {
+		return "", false, err
+	}
+	if req.Fallbacks, err = s.applyFallbackPoliciesLocked(req.Fallbacks); err != nil {
+		return "", false, err
+	}
+
+	if req.CustomKey != nil {
+		shortKey = *req.CustomKey
+		if rec, taken := s.urls[shortKey]; taken && rec.inBin() {
+			return "", false, ErrKeyExists // Kept free for restoring the binned link
+		} else if taken && !rec.expired(time.Now()) {
+			if req.CreateOnly {
+				return "", false, ErrKeyExists
+			}
+			if rec.Generated {
+				if err := s.claimGeneratedKeyLocked(req.Owner, shortKey, rec); err != nil {
+					return "", false, err
+				}
+			} else if s.cfg.CustomKeyConflict == CustomKeyReject {
+				return "", false, ErrKeyExists
+			}
+		}
+	} else if req.needsOwnKey() {
+		// Another link with the same url may send visitors elsewhere, answer fewer paths
+		// or resolve at other times, so never reuse one.
+		if shortKey, err = s.unusedKeyLocked(req.URL); err != nil {
+			return "", false, err
+		}
+	} else if existing, found := s.existingKeyLocked(req.URL); found && s.cfg.DuplicateURLs != DuplicateAllow {
+		if s.cfg.DuplicateURLs == DuplicateReject {
+			return "", false, &DuplicateURLError{ShortKey: existing}
+		}
+		return existing, false, nil
 	} else {
-		keyBytes := make([]byte, 4)
-		if _, err := rand.Read(keyBytes); err != nil {
-			return "", err
+		var exists bool
+		if shortKey, exists, err = s.newKeyLocked(req.URL); err != nil {
+			return "", false, err
+		}
+		if exists {
+			return shortKey, false, nil
 		}
-		shortKey = hex.EncodeToString(keyBytes)
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	if err := s.checkOwnerLocked(req.Owner, shortKey); err != nil {
+		return "", false, err
+	}
+	if err := s.makeRoom(shortKey); err != nil {
+		return "", false, err
+	}
+	now := time.Now()
+	s.activity.add(shortKey, now)
+	rec := Record{
+		URL:            req.URL,
+		CreatedAt:      now,
+		Generated:      req.CustomKey == nil,
+		Tags:           req.Tags,
+		Collection:     req.Collection,
+		Description:    req.Description,
+		Owner:          req.Owner,
+		CreatorIP:      req.CreatorIP,
+		Permanent:      req.Permanent,
+		Headers:        req.Headers,
+		Devices:        req.Devices,
+		Countries:      req.Countries,
+		Variants:       req.Variants,
+		Fallbacks:      req.Fallbacks,
+		Prefix:         req.Prefix,
+		Params:         req.Params,
+		NoTracking:     req.NoTracking,
+		MaxClicks:      req.MaxClicks,
+		RedirectMode:   req.RedirectMode,
+		RedirectStatus: req.RedirectStatus,
+		ActiveAt:       req.ActiveAt,
+	}
+	if s.cfg.DisplayURLs {
+		rec.DisplayURL = displayURL(req.URL)
+	}
+	if ttl, _ := req.ttl(s.cfg.DefaultTTL); ttl > 0 {
+		rec.ExpiresAt = now.Add(ttl)
+	}
+	s.putLocked(shortKey, rec)
+	s.emit(EventCreated, shortKey, rec)
+	return shortKey, true, nil
+}
+
+// putLocked stores rec under shortKey, replacing any existing record, and keeps the
+// indexes and the URL copies of aliases in step. Every write to s.urls other than a click count goes through here or
+// deleteLocked. Must be called with s.mu held for writing.
+func (s *URLStore) putLocked(shortKey string, rec Record) {
+	s.journalLocked(shortKey)
+	if target, found := s.urls[rec.AliasOf]; rec.AliasOf != "" && found && target.AliasOf == "" {
+		rec.URL = target.URL
+	}
+	if old, exists := s.urls[shortKey]; exists {
+		s.unindexAlias(shortKey, old)
+		s.unindexListed(shortKey, old)
+	}
+	s.urls[shortKey] = rec
+	s.heldLinks = true
+	s.markDirtyLocked(shortKey)
+	s.indexAlias(shortKey, rec)
+	s.indexListed(shortKey, rec)
+	if s.recent != nil {
+		s.recent.touch(shortKey)
+	}
+	if rec.AliasOf == "" {
+		s.syncAliasURLsLocked(shortKey, rec.URL)
+	}
+}
 
-	s.urls[shortKey] = longURL
+// deleteLocked removes shortKey and its index entries. Must be called with s.mu held for writing.
+func (s *URLStore) deleteLocked(shortKey string) {
+	s.journalLocked(shortKey)
+	if old, exists := s.urls[shortKey]; exists {
+		s.unindexAlias(shortKey, old)
+		s.unindexListed(shortKey, old)
+	}
+	delete(s.urls, shortKey)
+	s.markDirtyLocked(shortKey)
+	if s.recent != nil {
+		s.recent.remove(shortKey)
+	}
+}
+
+// newKeyLocked asks the key generator for a key that is free, or that already holds
+// longURL, in which case exists is true and the link is reused as is. Must be called
+// with s.mu held.
+func (s *URLStore) newKeyLocked(longURL string) (shortKey string, exists bool, err error) {
+	for attempt := range keyGenAttempts {
+		if shortKey, err = s.keys.Generate(longURL, attempt); err != nil {
+			return "", false, err
+		}
+		if reservedKeys[shortKey] || keyBlocked(shortKey, s.cfg) {
+			continue
+		}
+		rec, taken := s.urls[shortKey]
+		if !taken {
+			return shortKey, false, nil
+		}
+		if rec.URL == longURL && !rec.inBin() {
+			return shortKey, true, nil
+		}
+	}
+	return "", false, ErrKeySpaceFull
+}
 
+// saveAsync writes the store to disk in the background. It is called with s.mu held, so
+// the save itself waits for the caller's change to be complete. Changes made while a
+// background save is still waiting to take its snapshot coalesce into that save, so a
+// burst of changes costs one or two saves rather than one each.
+func (s *URLStore) saveAsync() {
+	s.notePending()
+	if !s.saveQueued.CompareAndSwap(false, true) {
+		return // The queued save hasn't taken its snapshot yet, so it will include this change
+	}
 	go func() {
-		if err := s.save(); err != nil {
-			log.Printf("Error saving to file: %v", err)
+		err := s.saveRecovering(context.Background())
+		if err != nil {
+			slog.Error("Error saving to file", "file", s.filename, "error", err)
+		}
+		if s.onSave != nil {
+			s.onSave(err)
 		}
+		s.recordSave(err)
 	}()
+}
+
+// saveSync writes the store before returning. If ctx ends first, the write is abandoned
+// without touching the file and handed to saveAsync instead. Must be called without s.mu held.
+func (s *URLStore) saveSync(ctx context.Context) error {
+	err := s.save(ctx)
+	if err != nil && ctx.Err() != nil {
+		s.saveAsync()
+		return fmt.Errorf("%w: %w", ErrSaveCanceled, err)
+	}
+	if err != nil {
+		slog.Error("Error saving to file", "file", s.filename, "error", err)
+	}
+	s.recordSave(err)
+	return err
+}
+
+// makeRoom enforces MaxLinks before shortKey is stored. Overwriting an existing key never
+// counts against the cap. Must be called with s.mu held for writing.
+func (s *URLStore) makeRoom(shortKey string) error {
+	if s.cfg.MaxLinks == 0 || len(s.urls) < s.cfg.MaxLinks {
+		return nil
+	}
+	if _, exists := s.urls[shortKey]; exists {
+		return nil
+	}
+	if s.cfg.EvictionPolicy != EvictLRU {
+		return ErrStoreFull
+	}
+
+	oldest, ok := s.recent.oldest()
+	if !ok {
+		return ErrStoreFull
+	}
+	s.deleteLinkLocked(oldest)
+	slog.Info("Link limit reached, evicted least recently used key", "key", oldest)
+	return nil
+}
+
+// resolveLocked finds the record shortKey resolves to, following an alias to its target.
+// Expired keys and aliases whose target is gone don't resolve. Must be called with s.mu held.
+func (s *URLStore) resolveLocked(shortKey string) (canonical string, rec Record, found bool) {
+	rec, found = s.urls[shortKey]
+	if !found || rec.expired(time.Now()) {
+		return "", Record{}, false
+	}
+	if rec.AliasOf == "" {
+		return shortKey, rec, true
+	}
+	target, found := s.urls[rec.AliasOf]
+	if !found || target.expired(time.Now()) {
+		return "", Record{}, false
+	}
+	return rec.AliasOf, target, true
+}
+
+// Get returns the record shortKey redirects with. For an alias that expires before its
+// target, the returned ExpiresAt is the alias's.
+func (s *URLStore) Get(shortKey string) (Record, bool) {
+	if rec, signed := s.lookupSigned(shortKey); signed {
+		return rec, !rec.expired(time.Now())
+	}
+
+	// Under the LRU policy every lookup reorders the recency list, so it needs the write lock.
+	if s.recent != nil && s.cfg.EvictionPolicy == EvictLRU {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		canonical, rec, found := s.resolveLocked(shortKey)
+		if found {
+			s.recent.touch(shortKey)
+			s.recent.touch(canonical)
+		}
+		return s.withAliasExpiryLocked(shortKey, rec), found
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, rec, found := s.resolveLocked(shortKey)
+	return s.withAliasExpiryLocked(shortKey, rec), found
+}
 
-	return shortKey, nil
+func (s *URLStore) withAliasExpiryLocked(shortKey string, rec Record) Record {
+	alias := s.urls[shortKey]
+	if alias.AliasOf != "" && !alias.ExpiresAt.IsZero() && (rec.ExpiresAt.IsZero() || alias.ExpiresAt.Before(rec.ExpiresAt)) {
+		rec.ExpiresAt = alias.ExpiresAt
+	}
+	return rec
 }
 
-func (s *URLStore) Get(shortKey string) (string, bool) {
+// Len returns the number of stored links.
+func (s *URLStore) Len() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	longURL, found := s.urls[shortKey]
-	return longURL, found
+	return len(s.urls)
+}
+
+// Expired reports whether shortKey, or the link it is an alias of, is stored but past its
+// expiry. Expired records are only dropped when the file is next loaded.
+func (s *URLStore) Expired(shortKey string) bool {
+	if rec, signed := s.lookupSigned(shortKey); signed {
+		return rec.expired(time.Now())
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, found := s.urls[shortKey]
+	if !found {
+		return false
+	}
+	now := time.Now()
+	if rec.AliasOf != "" && !rec.expired(now) {
+		rec, found = s.urls[rec.AliasOf]
+	}
+	return found && rec.expired(now) && !rec.inBin() // Binned links answer 404
 }
 
-func (s *URLStore) save() error {
-	data, err := json.Marshal(s.urls)
+// Lookup returns the full record for shortKey without counting as a use of the link.
+// For an alias this is the record it resolves to.
+func (s *URLStore) Lookup(shortKey string) (Record, bool) {
+	if rec, signed := s.lookupSigned(shortKey); signed {
+		return rec, !rec.expired(time.Now())
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, rec, found := s.resolveLocked(shortKey)
+	return rec, found
+}
+
+// Range calls fn for every stored record, in no particular order, until fn returns false.
+// It holds the read lock throughout without copying the map, so fn must be quick and must
+// not call back into the store, which could deadlock against a waiting writer.
+func (s *URLStore) Range(fn func(key string, rec Record) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key, rec := range s.urls {
+		if !fn(key, rec) {
+			return
+		}
+	}
+}
+
+// IncrementClicks records one redirect through shortKey. When the count reaches the disk
+// depends on Config.ClickPersistence; see persistClick. It reports false, counting
+// nothing, when the link has used up its MaxClicks and the redirect must not be served.
+func (s *URLStore) IncrementClicks(shortKey string, variant int) bool {
+	s.mu.Lock()
+	canonical, rec, found := s.resolveLocked(shortKey)
+	if found && rec.clicksUsedUp() {
+		s.mu.Unlock()
+		return false
+	}
+	if found {
+		before := rec.Clicks
+		rec.countClick(time.Now())
+		if variant >= 0 && variant < len(rec.Variants) {
+			rec.Variants = slices.Clone(rec.Variants) // Records handed out share the old slice
+			rec.Variants[variant].Clicks = addClicks(rec.Variants[variant].Clicks, 1)
+		}
+		s.urls[canonical] = rec
+		s.markDirtyLocked(canonical)
+		s.clickTotal.Add(totalClicks(rec.Clicks) - totalClicks(before))
+		s.emit(EventClicked, canonical, rec)
+	}
+	s.mu.Unlock()
+
+	if found {
+		s.persistClick()
+	}
+	return true
+}
+
+// save writes the store to disk atomically. A save cut short by ctx leaves the previous
+// file in place.
+func (s *URLStore) save(ctx context.Context) error {
+	if s.cfg.ReadOnly {
+		return nil // Only in-memory click counts change, and replicas don't keep them
+	}
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	// Cleared before the snapshot below, which waits for any change holding s.mu, so a
+	// change either lands in this snapshot or queues a new save.
+	s.saveQueued.Store(false)
+	if s.db != nil {
+		err := s.saveBolt(ctx)
+		if err == nil {
+			s.saveSecondary(ctx, nil)
+		}
+		return err
+	}
+
+	snapshotAt, data, empty, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	if empty {
+		if err := s.checkEmptySave(len(data)); err != nil {
+			return err
+		}
+	}
+	plain := data
+	if isCompressedFile(s.filename) {
+		if data, err = compressData(data); err != nil {
+			return err
+		}
+	}
+	if len(s.cfg.EncryptionKey) > 0 {
+		if data, err = encryptData(s.cfg.EncryptionKey, data); err != nil {
+			return err
+		}
+	}
+	if s.cfg.DailyFiles > 0 {
+		err = s.writeDailyFile(ctx, data, snapshotAt)
+	} else {
+		err = writeFileAtomic(ctx, s.filename, data, 0644)
+	}
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.filename, data, 0644)
+	if s.cfg.WatchFile {
+		s.lastWritten = sha256.Sum256(data)
+	}
+	s.noteSaved(snapshotAt, time.Since(snapshotAt))
+	s.saveSecondary(ctx, plain)
+	return nil
+}
+
+// snapshot encodes the store as the data file's contents, returning when it was taken.
+// empty reports that the store has held no links since it was loaded; see emptysave.go.
+func (s *URLStore) snapshot() (snapshotAt time.Time, data []byte, empty bool, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock() // Also on a panic, which saveRecovering survives
+	snapshotAt = time.Now()
+	s.clicksDirty.Store(false)
+	urls := s.persistedLocked()
+	data, err = encodeDataFile(urls, s.cfg.PrettyData)
+	return snapshotAt, data, len(urls) == 0 && !s.heldLinks, err
+}
+
+// persistedLocked returns the links as they are written to the data file. Must be called
+// with s.mu held.
+func (s *URLStore) persistedLocked() map[string]Record {
+	if s.cfg.ClickPersistence != ClickPersistNone {
+		return s.urls
+	}
+	urls := make(map[string]Record, len(s.urls))
+	for key, rec := range s.urls {
+		rec.Clicks = 0
+		rec.Variants = variantsWithoutClicks(rec.Variants)
+		urls[key] = rec
+	}
+	return urls
 }
 
 func (s *URLStore) load() error {
-	data, err := os.ReadFile(s.filename)
+	urls, err := s.readFile()
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -77,7 +626,80 @@ func (s *URLStore) load() error {
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return json.Unmarshal(data, &s.urls)
+	s.replaceLocked(urls)
+	s.markLoadedLocked(urls)
+	return nil
+}
+
+func (s *URLStore) readFile() (map[string]Record, error) {
+	if s.db != nil {
+		return s.readBolt()
+	}
+	path := s.filename
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) && isCompressedFile(s.filename) {
+		// Compression was just turned on: start from the plain file, saves go to filename.
+		path = strings.TrimSuffix(s.filename, compressedExt)
+		_, err = os.Stat(path)
+	}
+	if os.IsNotExist(err) && s.cfg.DailyFiles > 0 {
+		if latest, found := latestDailyFile(s.filename); found {
+			slog.Warn("Data file link is missing, loading the newest daily file", "file", latest)
+			path = latest
+		}
+	}
+
+	if len(s.cfg.EncryptionKey) == 0 {
+		if urls, err := streamDataFile(path, s.cfg.LoadBytesPerLink); !errors.Is(err, errNotStreamable) {
+			return urls, err
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.decodeFile(data)
+}
+
+// decodeFile parses the contents of the data file, decrypting and decompressing as needed.
+func (s *URLStore) decodeFile(data []byte) (map[string]Record, error) {
+	var err error
+	if data, err = decryptData(s.cfg.EncryptionKey, data); err != nil {
+		return nil, err
+	}
+	if data, err = decompressData(data); err != nil {
+		return nil, err
+	}
+	return decodeDataFile(data)
+}
+
+// replaceLocked makes urls the store's contents and rebuilds every index from it. Expired
+// links are skipped, which drops them from the file with the next save. Must be called
+// with s.mu held for writing.
+func (s *URLStore) replaceLocked(urls map[string]Record) {
+	s.urls = make(map[string]Record, len(urls))
+	s.byTag = make(map[string]map[string]struct{})
+	s.byCollection = make(map[string]map[string]struct{})
+	s.aliases = make(map[string]map[string]struct{})
+	s.byURL = make(map[string]map[string]struct{})
+	s.ownerLinks = make(map[string]int)
+	s.linkTotal.Store(0)
+	s.clickTotal.Store(0)
+	s.rewriteAll = s.db != nil // Keys missing from urls must leave the database too
+	// Loaded links count as held even if every one of them has expired; see emptysave.go.
+	s.heldLinks = s.heldLinks || len(urls) > 0
+	if s.recent != nil {
+		s.recent = newRecency()
+	}
+
+	now := time.Now()
+	for key, rec := range urls {
+		if !rec.removable(now, s.cfg.RecycleBinRetention) {
+			// The file carries no usage history, so loaded keys start in arbitrary order.
+			s.putLocked(key, rec)
+		}
+	}
+	s.rebuildActivityLocked()
 }
 
 // =======================================================================================
@@ -85,100 +707,888 @@ func (s *URLStore) load() error {
 // =======================================================================================
 
 type urlHandler struct {
-	store *URLStore
+	store  *URLStore
+	cfg    Config
+	clicks *clickLogger       // nil unless the click event log is enabled
+	hook   *webhookDispatcher // nil unless a click webhook is configured
+
+	keyLimiter *rateLimiter      // Redirects per short key; nil unless SHORTY_KEY_RATE_LIMIT is set
+	limiter    *rateLimiter      // The global limiter, set by withMiddleware; nil unless enabled
+	proxy      *linkProxy        // Serves proxied links; nil unless SHORTY_PROXY_LINKS is set
+	geo        geoResolver       // Looks up visitors' countries; nil unless SHORTY_GEOIP_DB is set
+	previews   *previewFetcher   // Fetches link previews; nil unless SHORTY_LINK_PREVIEWS is set
+	failover   *failoverMonitor  // Tracks which fallback destinations are down; nil unless checked
+	challenge  ChallengeVerifier // Checks anonymous creates; nil unless SHORTY_CHALLENGE is set
+
+	welcome *template.Template // Custom root page; nil shows the plain-text welcome
+	static  http.Handler       // Serves SHORTY_STATIC_DIR; nil unless it is set
 }
 
 func (h *urlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path == "/shorty" {
-		if r.Method == http.MethodPost {
-			h.handlePost(w, r)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	path, ok := h.routePath(r)
+	if !ok {
+		notFound(w, r)
+		return
+	}
+	if path == "/shorty/" {
+		// Keys never end in a slash, so this can only mean the API; clients building
+		// URLs from a base with a trailing slash send it.
+		path = "/shorty"
+	}
+	if h.static != nil {
+		if path+"/" == h.cfg.StaticPrefix {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		if strings.HasPrefix(path, h.cfg.StaticPrefix) {
+			h.serveStatic(w, r, path)
+			return
+		}
+	}
+
+	switch path {
+	case "/shorty":
+		if !allowMethods(w, r, h.shortyMethods()...) {
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost || r.Method == http.MethodPut:
+			if h.checkShortyQuery(w, r, createQueryParams) {
+				h.handlePost(w, r)
+			}
+		case r.Method == http.MethodGet && r.URL.Query().Has("url") && slices.Contains(h.cfg.CreateMethods, http.MethodGet):
+			if h.checkShortyQuery(w, r, createQueryParams, queryCreateParams) {
+				h.handleQueryCreate(w, r)
+			}
+		default:
+			if h.checkShortyQuery(w, r, listQueryParams) {
+				h.handleList(w, r)
+			}
+		}
+		return
+	case "/shorty/bulk":
+		if allowMethods(w, r, http.MethodPost) {
+			h.handleBulk(w, r)
+		}
+		return
+	case "/shorty/replace":
+		if allowMethods(w, r, http.MethodPost) {
+			h.handleReplace(w, r)
+		}
+		return
+	case "/shorty/expire":
+		if allowMethods(w, r, http.MethodPost) {
+			h.handleExpire(w, r)
+		}
+		return
+	case "/shorty/purge":
+		if allowMethods(w, r, http.MethodPost) {
+			h.handlePurge(w, r)
+		}
+		return
+	case "/admin/maintenance":
+		if allowMethods(w, r, http.MethodGet, http.MethodHead, http.MethodPost) {
+			h.handleMaintenance(w, r)
+		}
+		return
+	case "/shorty/dedupe":
+		if allowMethods(w, r, http.MethodPost) {
+			h.handleDedupe(w, r)
+		}
+		return
+	case "/export":
+		if allowMethods(w, r, http.MethodGet) {
+			h.handleExport(w, r)
+		}
+		return
+	case "/export/qr.zip":
+		if allowMethods(w, r, http.MethodGet) {
+			h.handleQRZip(w, r)
+		}
+		return
+	case "/import":
+		if allowMethods(w, r, http.MethodPost) {
+			h.handleImport(w, r)
+		}
+		return
+	case "/healthz":
+		if allowMethods(w, r, http.MethodGet, http.MethodHead) {
+			h.handleHealth(w, r)
+		}
+		return
+	case "/debug/state":
+		if allowMethods(w, r, http.MethodGet, http.MethodHead) {
+			h.handleDebugState(w, r)
+		}
+		return
+	case "/validate":
+		if allowMethods(w, r, http.MethodPost) {
+			h.handleValidate(w, r)
+		}
+		return
+	case "/activity":
+		if allowMethods(w, r, http.MethodGet, http.MethodHead) {
+			h.handleActivity(w, r)
+		}
+		return
+	case "/version":
+		if allowMethods(w, r, http.MethodGet, http.MethodHead) {
+			h.handleVersion(w, r)
 		}
 		return
 	}
 
-	if r.Method == http.MethodGet {
-		h.handleGet(w, r)
+	if name, ok := strings.CutPrefix(path, "/collections/"); ok {
+		if allowMethods(w, r, http.MethodGet, http.MethodHead, http.MethodPatch, http.MethodDelete) {
+			h.handleCollection(w, r, name)
+		}
+		return
+	}
+	if rest, ok := strings.CutPrefix(path, "/stats/"); ok {
+		if rest == "count" {
+			if allowMethods(w, r, http.MethodGet, http.MethodHead) {
+				h.handleCount(w, r)
+			}
+			return
+		}
+		if shortKey, ok := strings.CutSuffix(rest, "/clicks"); ok {
+			if allowMethods(w, r, http.MethodGet, http.MethodHead) {
+				h.handleClickStats(w, r, shortKey)
+			}
+			return
+		}
+		// Keys can't contain dots, so the extension is never part of one.
+		for _, format := range []string{"json", "csv"} {
+			if shortKey, ok := strings.CutSuffix(rest, "."+format); ok {
+				if allowMethods(w, r, http.MethodGet, http.MethodHead) {
+					h.handleStatsFile(w, r, shortKey, format)
+				}
+				return
+			}
+		}
+		notFound(w, r)
+		return
+	}
+	if shortKey, ok := strings.CutSuffix(path[1:], "/rotate"); ok {
+		if allowMethods(w, r, http.MethodPost) {
+			h.handleRotate(w, r, shortKey)
+		}
+		return
+	}
+	if shortKey, ok := strings.CutSuffix(path[1:], "/restore"); ok {
+		if allowMethods(w, r, http.MethodPost) {
+			h.handleRestore(w, r, shortKey)
+		}
+		return
+	}
+	if shortKey, ok := strings.CutSuffix(path[1:], "/alias"); ok {
+		if allowMethods(w, r, http.MethodPost) {
+			h.handleAlias(w, r, shortKey)
+		}
+		return
+	}
+	if shortKey, ok := strings.CutSuffix(path[1:], "/preview"); ok {
+		if allowMethods(w, r, http.MethodGet, http.MethodHead) {
+			h.handlePreview(w, r, shortKey)
+		}
+		return
+	}
+	if shortKey, ok := strings.CutSuffix(path[1:], "/info"); ok {
+		if allowMethods(w, r, http.MethodGet, http.MethodHead) {
+			h.handleInfo(w, r, shortKey)
+		}
+		return
+	}
+	if shortKey, ok := strings.CutSuffix(path[1:], "/meta"); ok {
+		if allowMethods(w, r, http.MethodGet, http.MethodHead) {
+			h.handleMeta(w, r, shortKey)
+		}
 		return
 	}
 
-	http.NotFound(w, r)
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodPost, http.MethodPut, http.MethodPatch) {
+		return
+	}
+	if r.Method == http.MethodDelete {
+		h.handleDelete(w, r, path[1:])
+		return
+	}
+	if r.Method == http.MethodPatch && (h.isAdmin(r) || h.owner(r) != "") {
+		// Unauthenticated PATCHes fall through to links that pass the method on.
+		h.handleUpdate(w, r, path[1:])
+		return
+	}
+	h.handleGet(w, r, path[1:])
+}
+
+// routePath returns the request path with the configured PathPrefix removed, always
+// starting with a slash. It reports false for requests outside the prefix. Unless
+// Config.KeepSlashes is set, runs of slashes count as one, so "//abc123" is "/abc123".
+// The path is percent-decoded unless Config.RawPaths is set, in which case "%31" never
+// matches "1" and an encoded "%2F" doesn't split the path.
+func (h *urlHandler) routePath(r *http.Request) (string, bool) {
+	path := r.URL.Path
+	if h.cfg.RawPaths {
+		path = r.URL.EscapedPath()
+	}
+	if !h.cfg.KeepSlashes {
+		path = collapseSlashes(path)
+	}
+	if h.cfg.PathPrefix == "" {
+		return path, true
+	}
+	rest, ok := strings.CutPrefix(path, h.cfg.PathPrefix)
+	if !ok {
+		return "", false
+	}
+	if rest == "" {
+		return "/", true
+	}
+	if rest[0] != '/' {
+		return "", false // e.g. "/gopher" when the prefix is "/go"
+	}
+	return rest, true
 }
 
-func (h *urlHandler) handleGet(w http.ResponseWriter, r *http.Request) {
-	shortKey := r.URL.Path[1:]
+// collapseSlashes replaces every run of consecutive slashes in path with a single one.
+func collapseSlashes(path string) string {
+	if !strings.Contains(path, "//") {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && i > 0 && path[i-1] == '/' {
+			continue
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// shortyMethods lists the methods /shorty answers: listing with GET and HEAD, and creating
+// with Config.CreateMethods.
+func (h *urlHandler) shortyMethods() []string {
+	methods := []string{http.MethodGet, http.MethodHead}
+	for _, method := range h.cfg.CreateMethods {
+		if method != http.MethodGet {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// allowMethods reports whether r uses one of the methods a route supports. Otherwise it
+// answers the request itself: OPTIONS gets 204 and any other method 405, both with an
+// Allow header listing what the route accepts.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	}
+	writeError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// wantsJSON reports whether the client listed application/json in its Accept header.
+func wantsJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), "application/json") {
+			return true
+		}
+	}
+	return false
+}
+
+// requireJSONBody reports whether r may carry its body as JSON, replying with 415 if not.
+// Any content type is accepted unless Config.StrictContentType is set.
+func (h *urlHandler) requireJSONBody(w http.ResponseWriter, r *http.Request) bool {
+	if !h.cfg.StrictContentType {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeError(w, r, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
+
+// notFound replies with a JSON error envelope for API clients and plain text otherwise.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	if !wantsJSON(r) {
+		http.NotFound(w, r)
+		return
+	}
+	jsonError(w, http.StatusNotFound, "not found")
+}
+
+// linkExpired answers a request for an expired link: a redirect to the configured landing
+// page, or 410 Gone.
+func (h *urlHandler) linkExpired(w http.ResponseWriter, r *http.Request) {
+	if h.cfg.ExpiredRedirect != "" {
+		http.Redirect(w, r, h.cfg.ExpiredRedirect, http.StatusFound)
+		return
+	}
+	if !wantsJSON(r) {
+		http.Error(w, "This link has expired", http.StatusGone)
+		return
+	}
+	jsonError(w, http.StatusGone, "expired")
+}
+
+// writeError replies with message and status like http.Error, except that clients
+// asking for JSON get the JSON error envelope. Headers set before, such as Allow or
+// Retry-After, are kept.
+func writeError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if !wantsJSON(r) {
+		http.Error(w, message, status)
+		return
+	}
+	jsonError(w, status, message)
+}
+
+func jsonError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{
+		Error: message,
+	})
+}
+
+func (h *urlHandler) handleGet(w http.ResponseWriter, r *http.Request, shortKey string) {
 	if shortKey == "" {
-		http.Error(w, "Welcome to Go-Shorty! Use POST to /shorty to create a short URL.", http.StatusOK)
+		if allowMethods(w, r, http.MethodGet, http.MethodHead, http.MethodDelete) {
+			h.handleRoot(w, r)
+		}
 		return
 	}
 
-	longURL, found := h.store.Get(shortKey)
+	// Keys pasted from emails and chat often carry a stray space or newline. Keys can't
+	// contain whitespace (see validateCustomKey), so trimming never changes which link
+	// a valid key resolves to.
+	shortKey = strings.TrimSpace(shortKey)
+	var remainder string
+	if strings.Contains(shortKey, "/") {
+		if key, rest, found := h.store.MatchPrefix(shortKey); found {
+			shortKey, remainder = key, rest
+		}
+	}
+	if !h.mayExist(shortKey) {
+		h.delayMiss(r)
+		notFound(w, r) // Without taking the store's lock, so huge paths cost next to nothing
+		return
+	}
+	rec, found := h.store.Get(shortKey)
 	if !found {
-		http.NotFound(w, r)
+		if h.store.Expired(shortKey) {
+			h.linkExpired(w, r)
+			return
+		}
+		h.delayMiss(r)
+		notFound(w, r)
+		return
+	}
+	if rec.NoTracking {
+		skipRequestLog(r)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && !h.preservesMethod(rec) {
+		// Only 307 and 308 redirects carry other methods on; see preservesMethod.
+		allowMethods(w, r, http.MethodGet, http.MethodHead, http.MethodDelete)
+		return
+	}
+	if rec.pending(time.Now()) {
+		linkNotYetActive(w, r, rec.ActiveAt)
+		return
+	}
+	if rec.clicksUsedUp() {
+		h.linkExpired(w, r) // Visits that aren't counted, such as HEAD requests, stop here
 		return
 	}
+	if override := r.URL.Query().Get(overrideParam); override != "" && h.isAdmin(r) {
+		h.redirectOverride(w, r, shortKey, rec, override)
+		return
+	}
+	if !h.allowRedirect(w, r, shortKey) {
+		return // Not counted as a click, since nothing was served
+	}
+	var byCountry bool
+	if len(rec.Countries) > 0 {
+		rec, byCountry = h.countryTarget(r, rec)
+	}
+	if len(rec.Devices) > 0 && !byCountry {
+		w.Header().Add("Vary", "User-Agent")
+		rec = deviceTarget(r, rec)
+	}
+	variant := noVariant
+	if len(rec.Variants) > 0 {
+		rec, variant = h.variantTarget(w, r, shortKey, rec)
+	}
+	if len(rec.Fallbacks) > 0 && h.failover != nil {
+		rec.URL = h.failover.destination(rec)
+	}
+	if len(rec.Params) > 0 {
+		target, err := fillTemplate(rec.URL, rec.Params, remainder, r.URL.RawQuery, h.cfg.RawPaths)
+		if err != nil {
+			writeError(w, r, "Invalid link parameters: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		rec.URL = target
+	} else if remainder != "" {
+		if h.cfg.RawPaths {
+			remainder, _ = url.PathUnescape(remainder) // Appended as a path, which is escaped again
+		}
+		target, ok := appendRemainder(rec.URL, remainder, r.URL.RawQuery)
+		if !ok {
+			notFound(w, r)
+			return
+		}
+		rec.URL = target
+	}
 
-	http.Redirect(w, r, longURL, http.StatusFound)
+	if !rec.NoTracking && (r.Method != http.MethodHead || h.cfg.CountHeadClicks) {
+		if !h.store.IncrementClicks(shortKey, variant) {
+			h.linkExpired(w, r) // Another visit took the last click
+			return
+		}
+		if h.clicks != nil || h.hook != nil {
+			ev := newClickEvent(r, shortKey, rec.URL, h.cfg.ClickLogIP, h.cfg.TrustedProxies)
+			if h.clicks != nil {
+				h.clicks.Log(ev)
+			}
+			if h.hook != nil {
+				h.hook.Send(ev, ev.RequestID)
+			}
+		}
+	}
+	h.redirect(w, r, rec)
 }
 
-func (h *urlHandler) handlePost(w http.ResponseWriter, r *http.Request) {
-	var requestData struct {
-		URL       string  `json:"url"`
-		CustomKey *string `json:"customKey,omitempty"`
+// handleInfo describes where shortKey points without redirecting or counting a click,
+// so link-safety tools can inspect a link before following it.
+func (h *urlHandler) handleInfo(w http.ResponseWriter, r *http.Request, shortKey string) {
+	rec, found := h.store.Lookup(shortKey)
+	if !found {
+		notFound(w, r)
+		return
+	}
+
+	if !h.isAdmin(r) {
+		rec.CreatorIP = ""
+	}
+	responseData := linkView{ShortKey: shortKey, Record: rec}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(responseData)
+}
+
+// storeError replies with the status matching an error returned by the store. Errors the
+// client can act on are passed through; anything else is reported as fallback with a 500.
+func storeError(w http.ResponseWriter, r *http.Request, err error, fallback string) {
+	status := storeErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		slog.Error(fallback, "error", err)
+		writeError(w, r, fallback, status)
+		return
+	}
+	writeError(w, r, err.Error(), status)
+}
+
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidURL), errors.Is(err, ErrInsecureURL), errors.Is(err, ErrInvalidTags), errors.Is(err, ErrInvalidCollection), errors.Is(err, ErrInvalidDescription), errors.Is(err, ErrInvalidExpiresIn), errors.Is(err, ErrInvalidHeaders), errors.Is(err, ErrInvalidDevices), errors.Is(err, ErrInvalidCountries), errors.Is(err, ErrGeoDisabled), errors.Is(err, ErrInvalidVariants), errors.Is(err, ErrInvalidFallbacks), errors.Is(err, ErrInvalidParams), errors.Is(err, ErrSelfLink), errors.Is(err, ErrUntrackedLimit),
+		errors.Is(err, ErrChainTooDeep), errors.Is(err, ErrKeyReserved), errors.Is(err, ErrKeyBlocked), errors.Is(err, ErrKeyRejected), errors.Is(err, ErrInvalidKey), errors.Is(err, ErrKeyTooShort), errors.Is(err, ErrKeyTooLong),
+		errors.Is(err, ErrDanglingAlias), errors.Is(err, ErrInvalidRedirectMode), errors.Is(err, ErrInvalidRedirectStatus), errors.Is(err, ErrProxyDisabled),
+		errors.Is(err, ErrKeyGenerated):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrDestinationDown):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrLinkNotFound), errors.Is(err, ErrCollectionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrIsAlias), errors.Is(err, ErrKeyExists), errors.Is(err, ErrTooManyAliases), errors.Is(err, ErrGeneratedKeyTaken), errors.Is(err, ErrDuplicateURL):
+		return http.StatusConflict
+	case errors.Is(err, ErrHostNotAllowed), errors.Is(err, ErrShortenerHost), errors.Is(err, ErrNotOwner), errors.Is(err, ErrBadDeleteToken), errors.Is(err, ErrQuotaExceeded), errors.Is(err, ErrKeyNeedsAuth):
+		return http.StatusForbidden
+	case errors.Is(err, ErrStoreFull), errors.Is(err, ErrKeySpaceFull):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, ErrSaveUnavailable), errors.Is(err, ErrSaveCanceled), errors.Is(err, ErrReadOnly), errors.Is(err, ErrMaintenance):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+var errCustomKeyType = errors.New("customKey must be a string")
+
+// decodeAddRequest parses a create request. A non-string customKey gets a message naming
+// the field instead of a generic JSON error; in lenient mode a numeric one is used as its
+// decimal string, for clients that send numeric IDs as keys.
+func decodeAddRequest(body []byte, lenient bool) (AddRequest, error) {
+	var req AddRequest
+	err := json.Unmarshal(body, &req)
+
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Field != "customKey" {
+		return req, err
+	}
+	if lenient && typeErr.Value == "number" {
+		var numeric struct {
+			CustomKey json.Number `json:"customKey"`
+		}
+		if json.Unmarshal(body, &numeric) == nil {
+			key := numeric.CustomKey.String()
+			req.CustomKey = &key
+			return req, nil
+		}
 	}
+	return req, errCustomKeyType
+}
 
+func (h *urlHandler) handlePost(w http.ResponseWriter, r *http.Request) {
+	if !h.requireJSONBody(w, r) {
+		return
+	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		writeError(w, r, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		writeError(w, r, "Request body is required", http.StatusBadRequest)
 		return
 	}
 
-	if err := json.Unmarshal(body, &requestData); err != nil {
-		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+	requestData, err := decodeAddRequest(body, h.cfg.LenientCustomKey)
+	if errors.Is(err, errCustomKeyType) {
+		writeError(w, r, "The customKey field must be a string", http.StatusBadRequest)
 		return
 	}
+	if err != nil {
+		writeError(w, r, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	h.createLink(w, r, requestData)
+}
+
+// handleQueryCreate serves GET /shorty?url=...&customKey=..., for clients that can't send a
+// request body. It is only routed when SHORTY_CREATE_METHODS includes GET.
+func (h *urlHandler) handleQueryCreate(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	requestData := AddRequest{URL: query.Get("url")}
+	if query.Has("customKey") {
+		key := query.Get("customKey")
+		requestData.CustomKey = &key
+	}
+	if tags := query.Get("tags"); tags != "" {
+		requestData.Tags = strings.Split(tags, ",")
+	}
+	requestData.Collection = query.Get("collection")
+	requestData.ExpiresIn = query.Get("expiresIn")
+	h.createLink(w, r, requestData)
+}
 
+// createLink completes a create request whose fields came from the body or the query.
+func (h *urlHandler) createLink(w http.ResponseWriter, r *http.Request, requestData AddRequest) {
 	if requestData.URL == "" {
-		http.Error(w, "URL field is required", http.StatusBadRequest)
+		writeError(w, r, "URL field is required", http.StatusBadRequest)
 		return
 	}
 
-	shortKey, err := h.store.Add(requestData.URL, requestData.CustomKey)
+	requestData.Admin = h.isAdmin(r)
+	requestData.Owner = h.owner(r)
+	requestData.CreatorIP = h.creatorIP(r)
+	requestData.CreateOnly = r.Header.Get("If-None-Match") == "*"
+	if !h.requireChallenge(w, r, requestData) {
+		return
+	}
+	if r.URL.Query().Get("mode") == "signed" {
+		h.handleSignedPost(w, r, requestData)
+		return
+	}
+	if r.URL.Query().Get("dryRun") == "true" {
+		h.handleDryRun(w, r, requestData)
+		return
+	}
+	shortKey, created, err := h.store.Add(r.Context(), requestData)
+	var dup *DuplicateURLError
+	if errors.As(err, &dup) {
+		duplicateConflict(w, dup)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to create short key", http.StatusInternalServerError)
+		storeError(w, r, err, "Failed to create short key")
 		return
 	}
 
-	responseData := struct {
-		ShortKey string `json:"shortKey"`
-	}{
-		ShortKey: shortKey,
+	responseData := createdLink{ShortKey: shortKey}
+	if len(h.cfg.DeletionKey) > 0 && created {
+		// Never for a reused link, whose creator may be someone else.
+		if rec, found := h.store.Lookup(shortKey); found {
+			responseData.DeleteToken = deleteToken(h.cfg.DeletionKey, shortKey, rec)
+		}
+	}
+	if wantsRepresentation(r) {
+		if rec, found := h.store.Lookup(shortKey); found {
+			w.Header().Set("Preference-Applied", "return=representation")
+			responseData.ShortURL = h.shortURL(r, shortKey)
+			responseData.LongURL = rec.URL
+			responseData.CreatedAt = rec.CreatedAt
+			responseData.ExpiresAt = rec.ExpiresAt
+			responseData.Clicks = &rec.Clicks
+		}
 	}
 
+	w.Header().Set("Location", h.linkLocation(shortKey))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(responseData)
 }
 
-func NewURLStore(filename string) *URLStore {
+// createdLink is the body of a successful create. Only ShortKey is set unless the client
+// asked for the full representation.
+type createdLink struct {
+	ShortKey  string    `json:"shortKey"`
+	ShortURL  string    `json:"shortURL,omitempty"`
+	LongURL   string    `json:"longURL,omitempty"`
+	CreatedAt time.Time `json:"createdAt,omitzero"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	Clicks    *uint64   `json:"clicks,omitempty"`
+	// DeleteToken deletes the link without other credentials; see deletetoken.go.
+	DeleteToken string `json:"deleteToken,omitempty"`
+}
+
+// wantsRepresentation reports whether a create asked for the full link in its response,
+// with ?verbose=true or Prefer: return=representation.
+func wantsRepresentation(r *http.Request) bool {
+	if r.URL.Query().Get("verbose") == "true" {
+		return true
+	}
+	for _, value := range r.Header.Values("Prefer") {
+		for _, part := range strings.Split(value, ",") {
+			preference, _, _ := strings.Cut(part, ";")
+			if strings.EqualFold(strings.TrimSpace(preference), "return=representation") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// shortURL returns the absolute URL of the link stored under shortKey, built from the
+// request's host when no BaseURL is configured.
+func (h *urlHandler) shortURL(r *http.Request, shortKey string) string {
+	location := h.linkLocation(shortKey)
+	if h.cfg.BaseURL != "" {
+		return location
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + location
+}
+
+// linkLocation returns where the link stored under shortKey is served, under BaseURL when
+// one is configured and otherwise relative to the requested host.
+func (h *urlHandler) linkLocation(shortKey string) string {
+	base := h.cfg.BaseURL
+	if base == "" {
+		base = h.cfg.PathPrefix
+	}
+	return base + "/" + url.PathEscape(shortKey)
+}
+
+// NewURLStore loads filename into a new store. A missing file starts an empty store, but
+// any other load failure is returned: carrying on would let the first save replace a
+// file that still holds data with an empty map.
+func NewURLStore(filename string, cfg Config) (*URLStore, error) {
 	store := &URLStore{
-		urls:     make(map[string]string),
-		filename: filename,
+		urls:         make(map[string]Record),
+		filename:     filename,
+		cfg:          cfg,
+		keys:         newKeyGenerator(cfg.KeyStrategy, strings.TrimSuffix(filename, compressedExt)+".counter", rand.Reader),
+		byTag:        make(map[string]map[string]struct{}),
+		byCollection: make(map[string]map[string]struct{}),
+		aliases:      make(map[string]map[string]struct{}),
+		byURL:        make(map[string]map[string]struct{}),
+		ownerLinks:   make(map[string]int),
+	}
+	if cfg.MaxLinks > 0 {
+		store.recent = newRecency()
+	}
+	if cfg.CheckDestination == CheckWarn || cfg.CheckDestination == CheckReject {
+		store.checker = newDestinationChecker(cfg.CheckTimeout)
+	}
+	if cfg.Storage == StorageBolt {
+		db, err := openBolt(filename, cfg.ReadOnly)
+		if err != nil {
+			return nil, fmt.Errorf("opening %s: %w", filename, err)
+		}
+		store.db, store.dirty = db, make(map[string]struct{})
 	}
 	if err := store.load(); err != nil {
-		log.Printf("Warning: could not load data from %s: %v", filename, err)
+		store.Close()
+		return nil, fmt.Errorf("loading %s: %w", filename, err)
+	}
+	if cfg.SecondaryStorage != "" {
+		secondary, err := openSecondary(filename, cfg)
+		if err != nil {
+			store.Close()
+			return nil, fmt.Errorf("opening secondary storage %s: %w", cfg.SecondaryFile, err)
+		}
+		store.secondary = secondary
+		store.saveAsync() // Backfills the secondary
 	}
-	return store
+	return store, nil
 }
 
 func main() {
-	const filename = "urls.json"
-	store := NewURLStore(filename)
-	handler := &urlHandler{store: store}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBench(os.Args[2:], os.Stdout); err != nil {
+			fatal("Benchmark failed", err)
+		}
+		return
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	filename := "urls.json"
+	if cfg.Storage == StorageBolt {
+		filename = "urls.db"
+	} else if cfg.CompressData {
+		filename += compressedExt
+	}
+	logOptions := &slog.HandlerOptions{Level: cfg.LogLevel}
+	if cfg.LogFile != "" {
+		logFile, err := openRotatingFile(cfg.LogFile, int64(cfg.LogMaxBytes), cfg.LogMaxFiles)
+		if err != nil {
+			fatal("Failed to open log file", err)
+		}
+		defer logFile.Close()
+		slog.SetDefault(slog.New(slog.NewJSONHandler(logFile, logOptions)))
+	} else {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, logOptions)))
+	}
+
+	store, err := NewURLStore(filename, cfg)
+	if err != nil {
+		fatal("Could not load data", err)
+	}
+	defer store.Close()
+	if cfg.WatchFile {
+		if err := store.watchFile(); err != nil {
+			fatal("Failed to watch data file", err)
+		}
+	}
+	if cfg.CompactOnStart {
+		if _, err := store.Compact(); err != nil {
+			fatal("Failed to compact data file", err)
+		}
+	}
+	store.startClickFlusher(cfg.ClickFlushInterval)
+	store.startBinPurger()
+	reloadOnHangup(store)
+	handler := &urlHandler{store: store, cfg: cfg, challenge: newChallengeVerifier(cfg)}
+	if cfg.KeyRateLimit > 0 {
+		handler.keyLimiter = newRateLimiter(cfg.KeyRateLimit, nil)
+	}
+	if cfg.ProxyLinks {
+		handler.proxy = newLinkProxy(cfg)
+	}
+	if cfg.LinkPreviews {
+		handler.previews = newPreviewFetcher(cfg.PreviewConcurrency)
+	}
+	if cfg.FailoverInterval > 0 {
+		handler.failover = newFailoverMonitor(store, newDestinationChecker(cfg.CheckTimeout))
+		handler.failover.start(cfg.FailoverInterval)
+	}
+	if cfg.GeoIPDB != "" {
+		if handler.geo, err = newMaxmindResolver(cfg.GeoIPDB); err != nil {
+			fatal("Failed to load GeoIP database", err)
+		}
+	}
+
+	if cfg.WelcomeTemplate != "" {
+		if handler.welcome, err = template.ParseFiles(cfg.WelcomeTemplate); err != nil {
+			fatal("Failed to parse welcome template", err)
+		}
+	}
+	if cfg.StaticDir != "" {
+		if handler.static, err = newStaticHandler(cfg.StaticDir); err != nil {
+			fatal("Failed to open static directory", err)
+		}
+	}
+
+	if cfg.ClickLog != "" {
+		out := os.Stdout
+		if cfg.ClickLog != "stdout" {
+			out, err = os.OpenFile(cfg.ClickLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+			if err != nil {
+				fatal("Failed to open click log", err)
+			}
+			defer out.Close()
+		}
+		handler.clicks = newClickLogger(out, cfg.ClickLogQueueSize, cfg.ClickQueueFull == QueueFullBlock)
+		defer handler.clicks.Close()
+	}
+	if cfg.ClickWebhookURL != "" {
+		handler.hook = newWebhookDispatcher(cfg.ClickWebhookURL, cfg.ClickWebhookSecret, cfg.ClickWebhookQueueSize, cfg.ClickQueueFull == QueueFullBlock)
+		defer handler.hook.Close()
+	}
+
+	var access *accessLogger
+	if cfg.AccessLog != "" {
+		var out io.Writer = os.Stdout
+		if cfg.AccessLog != "stdout" {
+			file, err := openRotatingFile(cfg.AccessLog, int64(cfg.LogMaxBytes), cfg.LogMaxFiles)
+			if err != nil {
+				fatal("Failed to open access log", err)
+			}
+			defer file.Close()
+			out = file
+		}
+		access = newAccessLogger(out, cfg.AccessLogFormat, cfg.TrustedProxies)
+	}
 
 	fmt.Println("Starting Go-Shorty URL shortener API on :8080")
-	if err := http.ListenAndServe(":8080", handler); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	if err := http.ListenAndServe(":8080", withMiddleware(handler, cfg, access)); err != nil {
+		fatal("Failed to start server", err)
 	}
 }
+
+// withMiddleware wraps handler in the middleware cfg enables, as served on :8080, logging
+// requests to access when it is set.
+func withMiddleware(handler *urlHandler, cfg Config, access *accessLogger) http.Handler {
+	server := limitConcurrency(handler, cfg.MaxConcurrentLookups, cfg.MaxConcurrentCreates)
+	if cfg.RateLimit > 0 || len(cfg.RateLimitKeys) > 0 {
+		limiter := newRateLimiter(cfg.RateLimit, cfg.RateLimitKeys)
+		server = limitRate(server, limiter, cfg.RateLimitBy == RateLimitByAPIKey, handler)
+		handler.limiter = limiter
+	}
+	if cfg.GzipLevel > 0 {
+		server = compressResponses(server, cfg.GzipLevel, cfg.GzipMinSize, cfg.GzipRouteMinSizes, cfg.PathPrefix)
+	}
+	if len(cfg.CORSOrigins) > 0 {
+		server = allowCORS(server, cfg.CORSOrigins, cfg.PathPrefix)
+	}
+	return logRequests(server, access)
+}
+
+// fatal logs err at error level and exits, like log.Fatal for the structured logger.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testConfig returns the configuration loadConfig builds from the environment, which
+// tests adjust with t.Setenv beforehand.
+func testConfig(t *testing.T) Config {
+	t.Helper()
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// newTestStore opens a store on a fresh data file in a temporary directory.
+func newTestStore(t *testing.T, cfg Config) *URLStore {
+	t.Helper()
+	return openTestStore(t, filepath.Join(t.TempDir(), "urls.json"), cfg)
+}
+
+// openTestStore opens a store on filename, as a restart of the server would.
+func openTestStore(t *testing.T, filename string, cfg Config) *URLStore {
+	t.Helper()
+	s, err := NewURLStore(filename, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// addTestLink stores a link to longURL under a generated key and returns the key.
+func addTestLink(t *testing.T, s *URLStore, longURL string) string {
+	t.Helper()
+	key, _, err := s.Add(context.Background(), AddRequest{URL: longURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// waitForSave waits for the next background save reported to saves, failing the test if
+// it fails or doesn't come.
+func waitForSave(t *testing.T, saves <-chan error) {
+	t.Helper()
+	select {
+	case err := <-saves:
+		if err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the store was never saved")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// =======================================================================================
+// Maintenance Mode - POST /admin/maintenance puts a running server into maintenance, for
+// backups and migrations: like a read-only replica, every change is refused with 503,
+// while redirects, lookups and stats keep working. Unlike SHORTY_READ_ONLY it is switched
+// on and off without a restart. Turning it on waits for changes already in progress and
+// saves the store before answering, so the data file is current from then on. Clicks are
+// still counted, and saved as usual. The mode lasts until it is turned off or the process
+// restarts. GET /admin/maintenance reports it.
+// =======================================================================================
+
+var ErrMaintenance = errors.New("this instance is in maintenance mode")
+
+// SetMaintenance turns maintenance mode on or off. Turning it on returns once changes
+// that were already under way have finished and been saved.
+func (s *URLStore) SetMaintenance(enabled bool) error {
+	if s.maintenance.Swap(enabled) == enabled || !enabled {
+		return nil
+	}
+	// Changes hold s.mu while they apply, so once it is free the last of them is done.
+	s.mu.Lock()
+	s.mu.Unlock()
+	return s.saveSync(context.Background())
+}
+
+// InMaintenance reports whether maintenance mode is on.
+func (s *URLStore) InMaintenance() bool {
+	return s.maintenance.Load()
+}
+
+// handleMaintenance serves GET and POST /admin/maintenance. POST takes {"enabled": true}
+// or false; without a body it toggles the mode.
+func (h *urlHandler) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var requestData struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, r, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		enabled := !h.store.InMaintenance()
+		if requestData.Enabled != nil {
+			enabled = *requestData.Enabled
+		}
+		if err := h.store.SetMaintenance(enabled); err != nil {
+			storeError(w, r, err, "Failed to save before maintenance")
+			return
+		}
+		slog.Info("Maintenance mode changed", "enabled", enabled)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Maintenance bool `json:"maintenance"`
+	}{h.store.InMaintenance()})
+}
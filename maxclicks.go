@@ -0,0 +1,36 @@
+package main
+
+import "errors"
+
+// =======================================================================================
+// Click Limits - A link created with "maxClicks": 100 redirects that many times and then
+// answers 410 Gone like an expired link. The check and the count happen together under
+// the store's lock in IncrementClicks, so concurrent visits can't overshoot the limit.
+// The link itself stays, so its info and stats keep working and report the clicks left.
+// =======================================================================================
+
+var ErrUntrackedLimit = errors.New("maxClicks can't be combined with noTracking")
+
+func validateMaxClicks(maxClicks uint64, noTracking bool) error {
+	if maxClicks > 0 && noTracking {
+		return ErrUntrackedLimit // Its visits would never be counted against the limit
+	}
+	return nil
+}
+
+// clicksUsedUp reports whether rec has a click limit it has reached.
+func (rec Record) clicksUsedUp() bool {
+	return rec.MaxClicks > 0 && rec.Clicks >= rec.MaxClicks
+}
+
+// remainingClicks returns how many more redirects rec allows, or nil when it has no limit.
+func (rec Record) remainingClicks() *uint64 {
+	if rec.MaxClicks == 0 {
+		return nil
+	}
+	var remaining uint64
+	if !rec.clicksUsedUp() {
+		remaining = rec.MaxClicks - rec.Clicks
+	}
+	return &remaining
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRemainingClicksDecrementPerRedirect(t *testing.T) {
+	s := newTestStore(t, testConfig(t))
+	h := &urlHandler{store: s, cfg: s.cfg}
+	key, _, err := s.Add(context.Background(), AddRequest{URL: "https://example.com/a", MaxClicks: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remaining := func() uint64 {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stats/"+key+".json", nil))
+		var stats struct {
+			RemainingClicks *uint64 `json:"remainingClicks"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&stats); err != nil || stats.RemainingClicks == nil {
+			t.Fatalf("stats answered %d without remainingClicks (%v)", w.Code, err)
+		}
+		return *stats.RemainingClicks
+	}
+	visit := func() int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+key, nil))
+		return w.Code
+	}
+
+	for want := uint64(3); want > 0; want-- {
+		if got := remaining(); got != want {
+			t.Fatalf("got %d clicks remaining, want %d", got, want)
+		}
+		if code := visit(); code != http.StatusFound {
+			t.Fatalf("redirect answered %d with %d clicks remaining", code, want)
+		}
+	}
+	if got := remaining(); got != 0 {
+		t.Errorf("got %d clicks remaining after the last one, want 0", got)
+	}
+	if code := visit(); code != http.StatusGone {
+		t.Errorf("visit past the limit answered %d, want %d", code, http.StatusGone)
+	}
+	if got := remaining(); got != 0 {
+		t.Errorf("a refused visit changed the remaining clicks to %d", got)
+	}
+}
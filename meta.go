@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// =======================================================================================
+// Link Metadata - GET /{shortKey}/meta returns how a link is organized: its tags,
+// collection, description, owner and timestamps, for UIs that show them next to a link.
+// Unlike /{shortKey}/info it leaves out destinations and click counts, so it can be
+// shown to people who shouldn't see those. It never counts a click.
+// =======================================================================================
+
+// linkMeta is the response of GET /{shortKey}/meta.
+type linkMeta struct {
+	ShortKey    string    `json:"shortKey"`
+	Tags        []string  `json:"tags"`
+	Collection  string    `json:"collection,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ActiveAt    time.Time `json:"activeAt,omitzero"`
+	ExpiresAt   time.Time `json:"expiresAt,omitzero"`
+}
+
+// handleMeta serves GET /{shortKey}/meta. An alias reports the metadata of the link it
+// points to, under its own key.
+func (h *urlHandler) handleMeta(w http.ResponseWriter, r *http.Request, shortKey string) {
+	rec, found := h.store.Lookup(shortKey)
+	if !found {
+		notFound(w, r)
+		return
+	}
+
+	meta := linkMeta{
+		ShortKey:    shortKey,
+		Tags:        rec.Tags,
+		Collection:  rec.Collection,
+		Description: rec.Description,
+		Owner:       rec.Owner,
+		CreatedAt:   rec.CreatedAt,
+		ActiveAt:    rec.ActiveAt,
+		ExpiresAt:   rec.ExpiresAt,
+	}
+	if meta.Tags == nil {
+		meta.Tags = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meta)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =======================================================================================
+// Middleware - Cross-cutting request handling wrapped around urlHandler.
+// =======================================================================================
+
+// limitConcurrency caps the number of requests processed at once. Lookups (GET, HEAD)
+// and everything else (creates) draw from separate pools so a burst of one cannot starve
+// the other. A limit of zero leaves that pool unlimited. Requests over the limit are
+// turned away immediately with 503 rather than queued.
+func limitConcurrency(next http.Handler, lookupLimit, createLimit int) http.Handler {
+	var lookups, creates chan struct{}
+	if lookupLimit > 0 {
+		lookups = make(chan struct{}, lookupLimit)
+	}
+	if createLimit > 0 {
+		creates = make(chan struct{}, createLimit)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sem := creates
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			sem = lookups
+		}
+		if sem == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		default:
+			slog.Warn("Concurrency limit reached, rejecting request", "method", r.Method, "path", r.URL.Path)
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, "Server is busy, try again shortly", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// logRequests writes one entry per request with its outcome: a line in access when it
+// is set, otherwise a debug-level entry with the request's duration. Requests a handler
+// passed to skipRequestLog get no entry.
+func logRequests(next http.Handler, access *accessLogger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		skip := new(bool)
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), skipLogKey{}, skip)))
+		if *skip {
+			return
+		}
+		if access != nil {
+			access.Log(r, start, rec.status, rec.size)
+			return
+		}
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start),
+		}
+		if id := requestID(r); id != "" {
+			attrs = append(attrs, "requestID", id)
+		}
+		slog.Debug("Request served", attrs...)
+	})
+}
+
+type skipLogKey struct{}
+
+// skipRequestLog keeps r out of the request log, for visits that must leave no trace.
+func skipRequestLog(r *http.Request) {
+	if skip, ok := r.Context().Value(skipLogKey{}).(*bool); ok {
+		*skip = true
+	}
+}
+
+// statusRecorder remembers the status code and body size written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.size += n
+	return n, err
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Route classes for per-route compression thresholds.
+var compressionRoutes = []string{"export", "list", "stats", "info", "other"}
+
+// parseCompressionThresholds reads "route=bytes" entries for the routes in compressionRoutes.
+func parseCompressionThresholds(entries []string) (map[string]int, error) {
+	sizes := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		route, value, _ := strings.Cut(entry, "=")
+		size, err := strconv.Atoi(value)
+		if err != nil || !slices.Contains(compressionRoutes, route) {
+			return nil, fmt.Errorf("SHORTY_GZIP_ROUTE_MIN_SIZES entry %q must be route=bytes with a route among %s", entry, strings.Join(compressionRoutes, ", "))
+		}
+		sizes[route] = size
+	}
+	return sizes, nil
+}
+
+// compressionRoute names the class of route path belongs to, with the path prefix
+// already removed. CORS is configured by the same classes.
+func compressionRoute(path string) string {
+	switch {
+	case path == "/export":
+		return "export"
+	case path == "/shorty" || path == "/shorty/":
+		return "list"
+	case strings.HasPrefix(path, "/stats/"):
+		return "stats"
+	case strings.HasSuffix(path, "/info"), strings.HasSuffix(path, "/meta"):
+		return "info"
+	}
+	return "other"
+}
+
+// compressResponses gzips responses for clients that accept it once the body reaches
+// the threshold of its route: minSizes[route] when set, otherwise minSize. A negative
+// threshold never compresses that route. Bodies are held back until the threshold is
+// reached, so small responses go out unchanged with their usual headers.
+func compressResponses(next http.Handler, level, minSize int, minSizes map[string]int, pathPrefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		threshold, ok := minSizes[compressionRoute(strings.TrimPrefix(r.URL.Path, pathPrefix))]
+		if !ok {
+			threshold = minSize
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		if threshold < 0 || r.Method == http.MethodHead || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, level: level, threshold: threshold, status: http.StatusOK}
+		defer gw.finish()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether the body
+// reaches the threshold, then either compresses everything or passes it through.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	level     int
+	threshold int
+	status    int
+	buf       []byte
+	gz        *gzip.Writer
+	decided   bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if !w.decided {
+		w.status = status
+	}
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) < w.threshold {
+		return len(p), nil
+	}
+	if err := w.start(true); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// start sends the header and the buffered body, compressed or not.
+func (w *gzipResponseWriter) start(compress bool) error {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		compress = false
+	}
+	if compress {
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", http.DetectContentType(w.buf)) // Sniffing after gzip would see compressed bytes
+		}
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		w.gz, _ = gzip.NewWriterLevel(w.ResponseWriter, w.level) // level is validated by loadConfig
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(w.buf)
+	} else if len(w.buf) > 0 {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
+
+// finish sends a response that stayed below the threshold and closes the gzip stream.
+func (w *gzipResponseWriter) finish() {
+	if !w.decided {
+		w.start(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
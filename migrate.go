@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// =======================================================================================
+// Data File Migrations - The data file is saved as {"version": N, "links": {...}}. Loading
+// a file written in an older format runs the migrations from its version up to the
+// current one, in order, and the next save writes it back in the current format. Each
+// migration rewrites the raw links of one version into the next, so a change to Record
+// that old files can't simply be decoded into gets its own step here.
+//
+// Versions:
+//
+//	1: a bare map of key -> URL string, from before links had records
+//	2: a bare map of key -> Record, without the envelope
+//	3: the envelope, with links as in version 2
+// =======================================================================================
+
+const currentFormatVersion = 3
+
+// dataFile is the envelope of the data file from version 3 on.
+type dataFile struct {
+	Version int                        `json:"version"`
+	Links   map[string]json.RawMessage `json:"links"`
+}
+
+// A migration rewrites the links of a file at one version into the next.
+type migration func(links map[string]json.RawMessage) (map[string]json.RawMessage, error)
+
+// migrations[v] migrates version v to v+1. Their order is the order they run in.
+var migrations = map[int]migration{
+	1: migrateURLStrings,
+	2: migrateEnvelope,
+}
+
+// migrateURLStrings turns each bare URL string into a record with that URL.
+func migrateURLStrings(links map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	for key, raw := range links {
+		var longURL string
+		if json.Unmarshal(raw, &longURL) != nil {
+			continue // Files of mixed age already hold some records
+		}
+		rec, err := json.Marshal(Record{URL: longURL})
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key, err)
+		}
+		links[key] = rec
+	}
+	return links, nil
+}
+
+// migrateEnvelope leaves the links as they are; version 3 only adds the envelope.
+func migrateEnvelope(links map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	return links, nil
+}
+
+// decodeDataFile reads the data file's JSON in any known format, migrating it to the
+// current one.
+func decodeDataFile(data []byte) (map[string]Record, error) {
+	file, err := readDataFileVersion(data)
+	if err != nil {
+		return nil, err
+	}
+	if file.Version > currentFormatVersion {
+		return nil, fmt.Errorf("data file format version %d is newer than this build supports (%d)", file.Version, currentFormatVersion)
+	}
+	for version := file.Version; version < currentFormatVersion; version++ {
+		if file.Links, err = migrations[version](file.Links); err != nil {
+			return nil, fmt.Errorf("migrating data file from version %d: %w", version, err)
+		}
+	}
+
+	urls := make(map[string]Record, len(file.Links))
+	for key, raw := range file.Links {
+		var rec Record
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return nil, fmt.Errorf("key %q: %w", key, err)
+		}
+		urls[key] = rec
+	}
+	return urls, nil
+}
+
+// readDataFileVersion parses data into its links and format version. Files without the
+// envelope are version 1 if any link is a bare string and version 2 otherwise.
+func readDataFileVersion(data []byte) (dataFile, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return dataFile{}, err
+	}
+	var version int
+	_, hasLinks := top["links"]
+	if hasLinks && len(top) == 2 && json.Unmarshal(top["version"], &version) == nil && version > 0 {
+		var file dataFile
+		err := json.Unmarshal(data, &file)
+		return file, err
+	}
+
+	// A bare map, which may hold keys named "version" and "links" like any others.
+	file := dataFile{Version: 2, Links: top}
+	for _, raw := range top {
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte(`"`)) {
+			file.Version = 1
+			break
+		}
+	}
+	return file, nil
+}
+
+// encodeDataFile writes urls in the current format, indented when pretty.
+func encodeDataFile(urls map[string]Record, pretty bool) ([]byte, error) {
+	file := struct {
+		Version int               `json:"version"`
+		Links   map[string]Record `json:"links"`
+	}{currentFormatVersion, urls}
+	if pretty {
+		return json.MarshalIndent(file, "", "  ")
+	}
+	return json.Marshal(file)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// =======================================================================================
+// Miss Delay - With SHORTY_MISS_DELAY, redirects to keys that don't exist wait a random
+// time up to the configured bound before answering 404. A miss is otherwise answered
+// faster than a hit, so timing alone tells an enumerator which guesses landed; the jitter
+// blurs that and slows down scans without touching the latency of working links.
+// =======================================================================================
+
+// maxMissDelay bounds SHORTY_MISS_DELAY, since every waiting miss holds a connection.
+const maxMissDelay = 2 * time.Second
+
+// delayMiss waits up to Config.MissDelay, or until the client goes away.
+func (h *urlHandler) delayMiss(r *http.Request) {
+	if h.cfg.MissDelay <= 0 {
+		return
+	}
+	timer := time.NewTimer(rand.N(h.cfg.MissDelay + 1))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+}
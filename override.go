@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// =======================================================================================
+// Target Override - An admin request for GET /{shortKey}?override=https://staging.example
+// is redirected to the override instead of the link's destination, so QA can try a link
+// against another target without changing it. The override must be a destination the
+// link itself could have. Such visits aren't counted, logged as clicks or sent to
+// webhooks, and are never redirected permanently. Anyone else's override parameter is
+// ignored.
+// =======================================================================================
+
+const overrideParam = "override"
+
+// redirectOverride sends an admin to override in place of rec's destinations, keeping
+// rec's redirect mode and headers.
+func (h *urlHandler) redirectOverride(w http.ResponseWriter, r *http.Request, shortKey string, rec Record, override string) {
+	if err := validateDestination(override, h.cfg); err != nil {
+		storeError(w, r, err, "Invalid override")
+		return
+	}
+
+	rec.URL = override
+	rec.Permanent = false // A cache must never keep the override for other visitors
+	if rec.RedirectStatus == http.StatusMovedPermanently || rec.RedirectStatus == http.StatusPermanentRedirect {
+		rec.RedirectStatus = 0
+	}
+	slog.Info("Redirecting to override", "key", shortKey, "url", override)
+	h.redirect(w, r, rec)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// =======================================================================================
+// Owners - Clients identified by an API key (SHORTY_API_KEYS) own the links they create.
+// An owner can cap out at a quota of stored links, free a slot by deleting one of their
+// links, and cannot replace a link that belongs to someone else. Anonymous links have no
+// owner and no quota.
+// =======================================================================================
+
+var (
+	ErrQuotaExceeded = errors.New("link quota reached for this API key")
+	ErrNotOwner      = errors.New("short key belongs to another owner")
+)
+
+// APIKey maps a bearer token to the owner it identifies.
+type APIKey struct {
+	Owner string
+	Token string
+}
+
+// parseAPIKeys reads "owner:token" entries.
+func parseAPIKeys(entries []string) ([]APIKey, error) {
+	keys := make([]APIKey, 0, len(entries))
+	for _, entry := range entries {
+		owner, token, ok := strings.Cut(entry, ":")
+		if !ok || owner == "" || token == "" {
+			return nil, fmt.Errorf("SHORTY_API_KEYS entry %q must be owner:token", entry)
+		}
+		keys = append(keys, APIKey{Owner: owner, Token: token})
+	}
+	return keys, nil
+}
+
+// parseOwnerQuotas reads "owner=limit" entries.
+func parseOwnerQuotas(entries []string) (map[string]int, error) {
+	quotas := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		owner, value, _ := strings.Cut(entry, "=")
+		limit, err := strconv.Atoi(value)
+		if owner == "" || err != nil || limit < 0 {
+			return nil, fmt.Errorf("SHORTY_OWNER_QUOTAS entry %q must be owner=limit", entry)
+		}
+		quotas[owner] = limit
+	}
+	return quotas, nil
+}
+
+// owner returns the owner whose API key r carries, or "" for anonymous requests.
+func (h *urlHandler) owner(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	for _, key := range h.cfg.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key.Token)) == 1 {
+			return key.Owner
+		}
+	}
+	return ""
+}
+
+// quotaFor returns how many links owner may store; zero means unlimited.
+func (s *URLStore) quotaFor(owner string) int {
+	if limit, ok := s.cfg.OwnerQuotas[owner]; ok {
+		return limit
+	}
+	return s.cfg.OwnerQuota
+}
+
+// checkOwnerLocked applies ownership rules before owner stores a link under shortKey.
+// Must be called with s.mu held.
+func (s *URLStore) checkOwnerLocked(owner, shortKey string) error {
+	existing, replacing := s.urls[shortKey]
+	if replacing && existing.Owner != "" && existing.Owner != owner {
+		return ErrNotOwner
+	}
+	if owner == "" || (replacing && existing.Owner == owner) {
+		return nil
+	}
+	if limit := s.quotaFor(owner); limit > 0 && s.ownerLinks[owner] >= limit {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func (s *URLStore) indexOwner(rec Record) {
+	if rec.Owner != "" && rec.AliasOf == "" {
+		s.ownerLinks[rec.Owner]++
+	}
+}
+
+func (s *URLStore) unindexOwner(rec Record) {
+	if rec.Owner != "" && rec.AliasOf == "" {
+		if s.ownerLinks[rec.Owner]--; s.ownerLinks[rec.Owner] == 0 {
+			delete(s.ownerLinks, rec.Owner)
+		}
+	}
+}
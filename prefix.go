@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// =======================================================================================
+// Prefix Links - A link created with "prefix": true also answers paths below its key, and
+// appends the rest of the path to its destination, so /docs/getting-started redirects to
+// the destination of "docs" plus /getting-started. One key then shortens a whole path
+// hierarchy. When stored keys overlap, the longest one that is a prefix link wins. The
+// request's query string is carried over too, after the destination's own.
+// =======================================================================================
+
+// MatchPrefix splits path into the longest stored key that is a prefix or template link
+// and the rest of the path, starting with a slash. found is false when none matches.
+// Paths whose first segment is too long to be a key are turned away without the lock.
+func (s *URLStore) MatchPrefix(path string) (shortKey, remainder string, found bool) {
+	if first := strings.IndexByte(path, '/'); first <= 0 || first > maxKeyLength {
+		return "", "", false
+	}
+	start := strings.LastIndexByte(path[:min(len(path), maxKeyLength+1)], '/')
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := start; i > 0; i = strings.LastIndexByte(path[:i], '/') {
+		if _, rec, exists := s.resolveLocked(path[:i]); exists && (rec.Prefix || len(rec.Params) > 0) {
+			return path[:i], path[i:], true
+		}
+	}
+	return "", "", false
+}
+
+// appendRemainder returns target with remainder appended to its path and query appended
+// to its query string. It reports false for a remainder that climbs out of the target's
+// path with "..".
+func appendRemainder(target, remainder, query string) (string, bool) {
+	for _, segment := range strings.Split(remainder, "/") {
+		if segment == ".." {
+			return "", false
+		}
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", false
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + remainder
+	u.RawPath = ""
+	if query != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += query
+	}
+	return u.String(), true
+}
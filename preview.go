@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// =======================================================================================
+// Link Previews - With SHORTY_LINK_PREVIEWS, GET /{shortKey}/preview returns the Open
+// Graph title, description and image of a link's destination, for chat apps that unfurl
+// links. The page is fetched on the first request and the result kept on the link for a
+// day. Fetches only reach public addresses, read at most the first megabyte within a few
+// seconds, and are refused once the destination's host is no longer allowed. At most
+// SHORTY_PREVIEW_CONCURRENCY pages are fetched at once; a request that can't get its
+// turn within a second is asked to retry, as is one for a host whose circuit breaker is
+// open (see breaker.go). Tags a page lacks are left out of the result rather than failing
+// it.
+// =======================================================================================
+
+const (
+	previewTimeout   = 5 * time.Second
+	previewMaxBytes  = 1 << 20
+	previewMaxAge    = 24 * time.Hour
+	maxPreviewField  = 1024        // Longer values are cut, so a page can't bloat the data file
+	previewQueueWait = time.Second // How long a fetch waits for a free slot
+
+	defaultPreviewConcurrency = 4
+)
+
+var (
+	errNotHTML     = errors.New("destination is not an HTML page")
+	errPreviewBusy = errors.New("too many previews are being fetched")
+)
+
+// LinkPreview is the Open Graph metadata of a link's destination.
+type LinkPreview struct {
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+}
+
+// previewFetcher fetches previews, making one request per link however many clients
+// ask for its preview at once, and at most cap(slots) requests at a time overall.
+type previewFetcher struct {
+	client  *http.Client
+	slots   chan struct{}
+	breaker *hostBreaker
+
+	mu       sync.Mutex
+	inflight map[string]*previewCall
+}
+
+type previewCall struct {
+	done    chan struct{}
+	preview LinkPreview
+	err     error
+}
+
+func newPreviewFetcher(concurrency int) *previewFetcher {
+	return &previewFetcher{
+		client:   newPublicClient(previewTimeout),
+		slots:    make(chan struct{}, concurrency),
+		breaker:  newHostBreaker(),
+		inflight: make(map[string]*previewCall),
+	}
+}
+
+// fetch returns the preview of longURL, waiting for a fetch of the same URL already in
+// progress instead of starting another. When every slot stays taken for
+// previewQueueWait it fails with errPreviewBusy, and while the breaker of longURL's host
+// is open with a breakerOpenError.
+func (p *previewFetcher) fetch(longURL string) (LinkPreview, error) {
+	p.mu.Lock()
+	if call, found := p.inflight[longURL]; found {
+		p.mu.Unlock()
+		<-call.done
+		return call.preview, call.err
+	}
+	call := &previewCall{done: make(chan struct{})}
+	p.inflight[longURL] = call
+	p.mu.Unlock()
+
+	select {
+	case p.slots <- struct{}{}:
+		host := breakerHost(longURL)
+		if wait, ok := p.breaker.allow(host, time.Now()); ok {
+			call.preview, call.err = p.get(longURL)
+			p.breaker.record(host, call.err != nil && !errors.Is(call.err, errNotHTML), time.Now())
+		} else {
+			call.err = breakerOpenError{retryAfter: wait}
+		}
+		<-p.slots
+	case <-time.After(previewQueueWait):
+		call.err = errPreviewBusy
+	}
+	p.mu.Lock()
+	delete(p.inflight, longURL)
+	p.mu.Unlock()
+	close(call.done)
+	return call.preview, call.err
+}
+
+func (p *previewFetcher) get(longURL string) (LinkPreview, error) {
+	req, err := http.NewRequest(http.MethodGet, longURL, nil)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	req.Header.Set("User-Agent", "go-shorty-preview")
+	req.Header.Set("Accept", "text/html")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return LinkPreview{}, ErrDestinationDown
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return LinkPreview{}, errNotHTML
+	}
+	preview := parseOpenGraph(io.LimitReader(resp.Body, previewMaxBytes), resp.Request.URL)
+	preview.FetchedAt = time.Now()
+	return preview, nil
+}
+
+// parseOpenGraph reads og:title, og:description and og:image from a page's meta tags,
+// falling back to its <title> for the title. It stops at the end of the head. A relative
+// image is resolved against base, the URL the page was fetched from.
+func parseOpenGraph(body io.Reader, base *url.URL) LinkPreview {
+	var preview LinkPreview
+	var inTitle bool
+	var title string
+	tokens := html.NewTokenizer(body)
+	for {
+		switch tokens.Next() {
+		case html.ErrorToken:
+			return finishPreview(preview, title, base)
+		case html.TextToken:
+			if inTitle {
+				title += string(tokens.Text())
+			}
+		case html.EndTagToken:
+			name, _ := tokens.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				return finishPreview(preview, title, base)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokens.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = true
+			case atom.Body:
+				return finishPreview(preview, title, base)
+			case atom.Meta:
+				var property, content string
+				for hasAttr {
+					var key, value []byte
+					key, value, hasAttr = tokens.TagAttr()
+					switch string(key) {
+					case "property", "name":
+						property = strings.ToLower(string(value))
+					case "content":
+						content = string(value)
+					}
+				}
+				switch property {
+				case "og:title":
+					preview.Title = content
+				case "og:description":
+					preview.Description = content
+				case "og:image":
+					preview.Image = content
+				}
+			}
+		}
+	}
+}
+
+func finishPreview(preview LinkPreview, title string, base *url.URL) LinkPreview {
+	if preview.Title == "" {
+		preview.Title = title
+	}
+	preview.Title = truncateRunes(strings.TrimSpace(preview.Title), maxPreviewField)
+	preview.Description = truncateRunes(strings.TrimSpace(preview.Description), maxPreviewField)
+	if image, err := base.Parse(strings.TrimSpace(preview.Image)); err == nil && preview.Image != "" {
+		preview.Image = image.String()
+	}
+	if len(preview.Image) > maxPreviewField || validateDestination(preview.Image, Config{}) != nil {
+		preview.Image = "" // Only absolute http(s) images are useful to an unfurler
+	}
+	return preview
+}
+
+func truncateRunes(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+// SetPreview caches preview on the link stored under shortKey, or on the link it is an
+// alias of.
+func (s *URLStore) SetPreview(shortKey string, preview LinkPreview) {
+	if s.checkWritable() != nil {
+		return // The preview is still served, just not kept
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	canonical, rec, found := s.resolveLocked(shortKey)
+	if !found {
+		return
+	}
+	rec.Preview = &preview
+	s.putLocked(canonical, rec)
+	s.saveAsync()
+}
+
+// handlePreview serves GET /{shortKey}/preview.
+func (h *urlHandler) handlePreview(w http.ResponseWriter, r *http.Request, shortKey string) {
+	rec, found := h.store.Lookup(shortKey)
+	if !found || h.previews == nil {
+		notFound(w, r)
+		return
+	}
+
+	if rec.Preview == nil || time.Since(rec.Preview.FetchedAt) > previewMaxAge {
+		// The host policy may have tightened since the link was created.
+		if err := validateDestination(rec.URL, h.cfg); err != nil {
+			storeError(w, r, err, "Failed to fetch preview")
+			return
+		}
+		preview, err := h.previews.fetch(rec.URL)
+		var open breakerOpenError
+		if errors.As(err, &open) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(open.retryAfter.Seconds()))))
+			writeError(w, r, "Destination keeps failing, try the preview again later", http.StatusServiceUnavailable)
+			return
+		}
+		if errors.Is(err, errPreviewBusy) {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, "Preview not available yet, try again shortly", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			slog.Info("Fetching link preview failed", "key", shortKey, "error", err)
+			writeError(w, r, "Failed to fetch preview", http.StatusBadGateway)
+			return
+		}
+		h.store.SetPreview(shortKey, preview)
+		rec.Preview = &preview
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(struct {
+		ShortKey string `json:"shortKey"`
+		URL      string `json:"url"`
+		LinkPreview
+	}{shortKey, rec.URL, *rec.Preview})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// =======================================================================================
+// Destination Checks - Optionally probes a destination before a link to it is created, so
+// short links don't point at dead pages. The probe is bounded by a timeout and refuses to
+// connect to loopback, private and link-local addresses, so creating links can't be used
+// to reach internal services through this server. Destinations on such addresses are
+// stored without a check.
+// =======================================================================================
+
+const (
+	CheckOff    = "off"
+	CheckWarn   = "warn"   // Store the link but log the failure
+	CheckReject = "reject" // Refuse the link
+)
+
+const (
+	defaultCheckTimeout = 5 * time.Second
+	maxCheckRedirects   = 5
+)
+
+var (
+	ErrDestinationDown = errors.New("destination did not respond successfully")
+
+	errPrivateAddress = errors.New("refusing to probe a non-public address")
+)
+
+// destinationChecker issues the probes with a newPublicClient.
+type destinationChecker struct {
+	client *http.Client
+}
+
+func newDestinationChecker(timeout time.Duration) *destinationChecker {
+	return &destinationChecker{client: newPublicClient(timeout)}
+}
+
+// newPublicClient returns a client that only dials public addresses, including for every
+// redirect it follows, failing with errPrivateAddress otherwise.
+func newPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(addrPort.Addr()) {
+				return errPrivateAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxCheckRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxCheckRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !(addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified())
+}
+
+// Check probes longURL with HEAD, falling back to GET for servers that don't support HEAD.
+// It returns nil when the destination answers below 400 or is on a non-public address.
+func (c *destinationChecker) Check(ctx context.Context, longURL string) error {
+	status, err := c.probe(ctx, http.MethodHead, longURL)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = c.probe(ctx, http.MethodGet, longURL)
+	}
+	switch {
+	case errors.Is(err, errPrivateAddress):
+		return nil
+	case err != nil:
+		// The cause can name internal resolvers or proxies, so it is logged, not returned.
+		slog.Info("Destination unreachable", "url", longURL, "error", err)
+		return fmt.Errorf("%w: unreachable", ErrDestinationDown)
+	case status >= 400:
+		return fmt.Errorf("%w: status %d", ErrDestinationDown, status)
+	}
+	return nil
+}
+
+func (c *destinationChecker) probe(ctx context.Context, method, longURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, longURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "go-shorty-link-check")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	return resp.StatusCode, nil
+}
+
+// checkDestination applies the configured check mode to a new link's destination.
+func (s *URLStore) checkDestination(ctx context.Context, longURL string) error {
+	if s.checker == nil {
+		return nil
+	}
+	err := s.checker.Check(ctx, longURL)
+	if err != nil && s.cfg.CheckDestination == CheckWarn {
+		slog.Warn("Destination check failed, storing link anyway", "url", longURL, "error", err)
+		return nil
+	}
+	return err
+}
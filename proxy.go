@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =======================================================================================
+// Proxied Links - With SHORTY_PROXY_LINKS, a link created with "redirectMode": "proxy" is
+// fetched server-side and its response streamed back under the short URL, so visitors
+// never see the destination. Fetches only reach public addresses, are bounded in time and
+// size, and only pass on content types from SHORTY_PROXY_CONTENT_TYPES. Proxied content
+// is served sandboxed, since it arrives from our origin. Proxied links only answer GET
+// and HEAD, and are redirected normally once the option is turned off.
+// =======================================================================================
+
+const RedirectProxy = "proxy"
+
+const (
+	defaultProxyTimeout  = 10 * time.Second
+	defaultProxyMaxBytes = 10 << 20
+)
+
+// defaultProxyContentTypes leaves out HTML and scripts, which could act on our origin.
+var defaultProxyContentTypes = []string{"image/*", "text/plain", "application/pdf", "application/json"}
+
+var ErrProxyDisabled = errors.New(`redirectMode "proxy" requires SHORTY_PROXY_LINKS`)
+
+// proxiedHeaders are the response headers passed on from the destination.
+var proxiedHeaders = []string{"Content-Type", "Content-Length", "Last-Modified", "ETag"}
+
+type linkProxy struct {
+	client       *http.Client
+	maxBytes     int64
+	contentTypes []string
+}
+
+func newLinkProxy(cfg Config) *linkProxy {
+	client := newPublicClient(cfg.ProxyTimeout)
+	return &linkProxy{client: client, maxBytes: int64(cfg.ProxyMaxBytes), contentTypes: cfg.ProxyContentTypes}
+}
+
+// allowed reports whether contentType matches one of the configured types, either
+// exactly or as "type/*".
+func (p *linkProxy) allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range p.contentTypes {
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// serve fetches rec's destination and streams it to w, trying its fallbacks in turn
+// when a destination can't be fetched. Failures answer 502 without saying why, since the
+// cause may describe internal network details.
+func (p *linkProxy) serve(w http.ResponseWriter, r *http.Request, rec Record) {
+	var resp *http.Response
+	var err error
+	for _, destination := range rec.destinations() {
+		if resp, err = p.fetch(r, destination); err == nil {
+			rec.URL = destination
+			break
+		}
+		slog.Info("Proxying link failed", "url", destination, "error", err)
+	}
+	if err != nil {
+		writeError(w, r, "Failed to fetch destination", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, name := range proxiedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(resp.StatusCode)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	n, err := io.Copy(w, io.LimitReader(resp.Body, p.maxBytes+1))
+	if err == nil && n > p.maxBytes {
+		// Headers are gone, so the only way to tell the client is to cut the response off.
+		slog.Warn("Proxied response exceeded the size limit, aborting", "url", rec.URL, "limit", p.maxBytes)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// fetch requests longURL for r, failing unless the response is one serve can pass on.
+func (p *linkProxy) fetch(r *http.Request, longURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, longURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Nothing identifying the visitor, such as cookies or their address, is passed on.
+	req.Header.Set("User-Agent", "go-shorty-proxy")
+	if accept := r.Header.Get("Accept-Language"); accept != "" {
+		req.Header.Set("Accept-Language", accept)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		err = errors.New("status " + strconv.Itoa(resp.StatusCode))
+	case !p.allowed(resp.Header.Get("Content-Type")):
+		err = errors.New("content type " + strconv.Quote(resp.Header.Get("Content-Type")) + " is not allowed")
+	case resp.ContentLength > p.maxBytes:
+		err = errors.New("response too large")
+	}
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
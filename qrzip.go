@@ -0,0 +1,85 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// =======================================================================================
+// QR Code Export - GET /export/qr.zip streams a zip archive holding a PNG QR code of the
+// short URL of each link, named after its key, for print campaigns. Entries are encoded
+// and written one at a time, so memory use doesn't grow with the number of links.
+// =======================================================================================
+
+const (
+	maxQRZipKeys = 1000 // Each code takes a few milliseconds to encode
+	qrCodeSize   = 512  // Pixels along each side
+)
+
+// handleQRZip serves GET /export/qr.zip?keys=a,b,c for admins, or every link when keys
+// is left out.
+func (h *urlHandler) handleQRZip(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var keys []string
+	if value := r.URL.Query().Get("keys"); value != "" {
+		for _, key := range strings.Split(value, ",") {
+			key = strings.TrimSpace(key)
+			if _, found := h.store.Lookup(key); !found {
+				writeError(w, r, "Link not found: "+key, http.StatusNotFound)
+				return
+			}
+			keys = append(keys, key)
+		}
+	} else {
+		now := time.Now()
+		records := h.store.Export()
+		for _, key := range slices.Sorted(maps.Keys(records)) {
+			if !records[key].expired(now) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+	if len(keys) > maxQRZipKeys {
+		writeError(w, r, "At most "+strconv.Itoa(maxQRZipKeys)+" QR codes can be exported at once; pick them with keys", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="qr.zip"`)
+	archive := zip.NewWriter(w)
+	for _, key := range keys {
+		png, err := qrcode.Encode(h.shortURL(r, key), qrcode.Medium, qrCodeSize)
+		if err == nil {
+			var entry io.Writer
+			// PNGs are already compressed, so they are stored rather than deflated. Keys
+			// are escaped so an imported one can't name a path outside the archive.
+			name := url.PathEscape(key) + ".png"
+			if entry, err = archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()}); err == nil {
+				_, err = entry.Write(png)
+			}
+		}
+		if err != nil {
+			// The status is gone, so a truncated archive is all the client can be given.
+			slog.Error("Writing QR code archive failed", "key", key, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		slog.Error("Writing QR code archive failed", "error", err)
+	}
+}
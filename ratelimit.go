@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =======================================================================================
+// Rate Limiting - Caps how many requests each client may make per minute with a token
+// bucket per client. Clients are told apart by IP, or with SHORTY_RATE_LIMIT_BY=apikey by
+// the owner of their API key, so many users behind one NAT don't share a budget.
+// Requests without a valid API key always fall back to their IP. Separately,
+// SHORTY_KEY_RATE_LIMIT caps redirects through each short key, whoever sends them, to
+// slow down scraping and click inflation. Throttled requests get 429 with Retry-After, and
+// with SHORTY_RATE_LIMIT_HEADERS every limited request reports its client's budget in
+// X-RateLimit-Limit and X-RateLimit-Remaining.
+// =======================================================================================
+
+const (
+	RateLimitByIP     = "ip"
+	RateLimitByAPIKey = "apikey"
+)
+
+// rateLimitSweepInterval is how often buckets that have refilled are dropped, which keeps
+// the table from growing with every client ever seen.
+const rateLimitSweepInterval = time.Minute
+
+const defaultRateLimitMessage = "Too many requests, try again later"
+
+type tokenBucket struct {
+	tokens float64
+	limit  int
+	last   time.Time
+}
+
+// rateLimiter holds a bucket per client. A bucket holds up to its limit in tokens and
+// refills at limit tokens per minute, so short bursts are allowed.
+type rateLimiter struct {
+	limit       int
+	ownerLimits map[string]int
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(limit int, ownerLimits map[string]int) *rateLimiter {
+	return &rateLimiter{limit: limit, ownerLimits: ownerLimits, buckets: make(map[string]*tokenBucket)}
+}
+
+// parseRateLimits reads "owner=requests" entries.
+func parseRateLimits(entries []string) (map[string]int, error) {
+	limits := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		owner, value, _ := strings.Cut(entry, "=")
+		limit, err := strconv.Atoi(value)
+		if owner == "" || err != nil || limit < 0 {
+			return nil, fmt.Errorf("SHORTY_RATE_LIMIT_KEYS entry %q must be owner=requests", entry)
+		}
+		limits[owner] = limit
+	}
+	return limits, nil
+}
+
+// limitFor returns the per-minute limit for owner; zero means unlimited.
+func (l *rateLimiter) limitFor(owner string) int {
+	if limit, ok := l.ownerLimits[owner]; ok && owner != "" {
+		return limit
+	}
+	return l.limit
+}
+
+// allow takes a token from the bucket for client, whose limit is limit, and reports how
+// many whole tokens are left. When the bucket is empty it reports false and how long
+// until the next token.
+func (l *rateLimiter) allow(client string, limit int, now time.Time) (ok bool, wait time.Duration, remaining int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweepLocked(now)
+	}
+
+	rate := float64(limit) / time.Minute.Seconds() // Tokens per second
+	b, ok := l.buckets[client]
+	if !ok || b.limit != limit {
+		b = &tokenBucket{tokens: float64(limit), limit: limit, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(float64(limit), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second)), 0
+	}
+	b.tokens--
+	return true, 0, int(b.tokens)
+}
+
+// sweepLocked drops buckets that would be full by now, since a new bucket starts full
+// anyway. Must be called with l.mu held.
+func (l *rateLimiter) sweepLocked(now time.Time) {
+	for client, b := range l.buckets {
+		if now.Sub(b.last) >= time.Minute {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// limitRate rejects requests over the client's budget with 429. With byAPIKey, requests
+// carrying a valid API key are counted against its owner; all others are counted against
+// their IP. It authenticates the API key itself, since it runs before h does.
+func limitRate(next http.Handler, limiter *rateLimiter, byAPIKey bool, h *urlHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var client, name string
+		if byAPIKey {
+			name = h.owner(r)
+		}
+		if name != "" {
+			client = "key:" + name
+		} else {
+			client = "ip:" + clientIP(r, h.cfg.TrustedProxies)
+		}
+
+		limit := limiter.limitFor(name)
+		if limit == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ok, wait, remaining := limiter.allow(client, limit, time.Now())
+		if h.cfg.RateLimitHeaders {
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		}
+		if !ok {
+			slog.Debug("Rate limit reached, rejecting request", "method", r.Method, "path", r.URL.Path)
+			h.tooManyRequests(w, r, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowRedirect applies SHORTY_KEY_RATE_LIMIT to a redirect through shortKey, replying
+// with 429 when the key has used up its budget.
+func (h *urlHandler) allowRedirect(w http.ResponseWriter, r *http.Request, shortKey string) bool {
+	if h.keyLimiter == nil {
+		return true
+	}
+	ok, wait, _ := h.keyLimiter.allow(shortKey, h.keyLimiter.limit, time.Now())
+	if !ok {
+		slog.Debug("Key rate limit reached, rejecting redirect", "key", shortKey)
+		h.tooManyRequests(w, r, wait)
+	}
+	return ok
+}
+
+// tooManyRequests answers 429 with Config.RateLimitMessage, telling the client in
+// Retry-After how many seconds until its next token.
+func (h *urlHandler) tooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeError(w, r, h.cfg.RateLimitMessage, http.StatusTooManyRequests)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// =======================================================================================
+// Record - Everything the store keeps about a single short link.
+// =======================================================================================
+
+type Record struct {
+	URL string `json:"url"`
+	// DisplayURL is a short readable form of URL for UIs; see display.go.
+	DisplayURL string    `json:"displayURL,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Clicks     uint64    `json:"clicks"`
+	// Hourly and Daily break recent clicks down over time; see stats.go.
+	Hourly clickBuckets `json:"hourly,omitzero"`
+	Daily  clickBuckets `json:"daily,omitzero"`
+	Tags   []string     `json:"tags,omitempty"`
+	// Collection is the one collection the link belongs to, if any; see collection.go.
+	Collection string `json:"collection,omitempty"`
+	// Description is a free-text note for the people managing the link; see description.go.
+	Description string `json:"description,omitempty"`
+	// Generated is set when the key was generated rather than chosen by the creator.
+	Generated bool `json:"generated,omitempty"`
+	// Owner is the API key owner that created the link, empty for anonymous links.
+	Owner string `json:"owner,omitempty"`
+	// CreatorIP is the creating client's address or its hash, per Config.CreatorIP. It is
+	// only shown to admins.
+	CreatorIP string `json:"creatorIP,omitempty"`
+	// Permanent links redirect with 301 and may be cached by browsers and CDNs.
+	Permanent bool `json:"permanent,omitempty"`
+	// Headers are extra response headers sent with the redirect; see headers.go.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Devices maps DeviceMobile and DeviceDesktop to their own destinations, with URL as
+	// the fallback; see device.go.
+	Devices map[string]string `json:"devices,omitempty"`
+	// Countries maps country codes to their own destinations, ahead of Devices; see geo.go.
+	Countries map[string]string `json:"countries,omitempty"`
+	// Variants split visitors by weight in place of URL; see variant.go.
+	Variants []Variant `json:"variants,omitempty"`
+	// Fallbacks are tried in order when URL is down; see failover.go.
+	Fallbacks []string `json:"fallbacks,omitempty"`
+	// Preview caches the destination's Open Graph metadata; see preview.go.
+	Preview *LinkPreview `json:"preview,omitempty"`
+	// Prefix links also answer paths below their key, appending the rest; see prefix.go.
+	Prefix bool `json:"prefix,omitempty"`
+	// Params make URL a template, maps each placeholder to the expression its value must
+	// match; see template.go.
+	Params map[string]string `json:"params,omitempty"`
+	// NoTracking keeps visits out of click counts, the click log and webhooks.
+	NoTracking bool `json:"noTracking,omitempty"`
+	// MaxClicks, when set, is how many redirects the link serves; see maxclicks.go.
+	MaxClicks uint64 `json:"maxClicks,omitempty"`
+	// RedirectMode overrides Config.RedirectMode for this link when set.
+	RedirectMode string `json:"redirectMode,omitempty"`
+	// RedirectStatus overrides the status Permanent and Config.PreserveMethod imply.
+	RedirectStatus int `json:"redirectStatus,omitempty"`
+
+	// AliasOf, when set, makes this key resolve to the record stored under that key,
+	// which also receives its clicks. URL is kept in step with the target's, as a copy
+	// for readable exports.
+	AliasOf string `json:"aliasOf,omitempty"`
+	// ActiveAt, when set, is when the key starts resolving; see schedule.go.
+	ActiveAt time.Time `json:"activeAt,omitzero"`
+	// ExpiresAt, when set, is when the key stops resolving.
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	// DeletedAt, when set, is when the link was moved to the recycle bin; see recyclebin.go.
+	DeletedAt time.Time `json:"deletedAt,omitzero"`
+}
+
+// expired reports whether rec has an expiry that is not after now, or is in the recycle
+// bin. Either way the key no longer resolves.
+func (rec Record) expired(now time.Time) bool {
+	return rec.inBin() || !rec.ExpiresAt.IsZero() && !now.Before(rec.ExpiresAt)
+}
+
+// linkView is how a link is presented in API responses.
+type linkView struct {
+	ShortKey string `json:"shortKey"`
+	Record
+}
+
+// UnmarshalJSON also accepts a bare string, which is how data files written before
+// records existed stored each link (a plain key -> URL map).
+func (rec *Record) UnmarshalJSON(data []byte) error {
+	var longURL string
+	if err := json.Unmarshal(data, &longURL); err == nil {
+		*rec = Record{URL: longURL}
+		return nil
+	}
+
+	type plain Record // Drops the methods so Unmarshal doesn't recurse
+	return json.Unmarshal(data, (*plain)(rec))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// =======================================================================================
+// Recycle Bin - With SHORTY_RECYCLE_BIN_RETENTION set, deleting a link moves it to the
+// recycle bin instead of removing it: the key stops resolving, answering 404, but the
+// link and its clicks are kept with a deletedAt time, and POST /{key}/restore brings it
+// back. Aliases deleted along with the link come back with it. Binned keys can't be
+// claimed by new links or imports, so a restore never finds its key taken. Binned links
+// are left out of listings, collections, owner quotas and /stats/count. Links are purged
+// for good once they have been in the bin for the retention period, or when deleted a
+// second time.
+// =======================================================================================
+
+// maxPurgeInterval is how often the bin is checked at most, however long the retention.
+const maxPurgeInterval = time.Hour
+
+// inBin reports whether rec has been deleted into the recycle bin.
+func (rec Record) inBin() bool {
+	return !rec.DeletedAt.IsZero()
+}
+
+// removable reports whether rec is due to leave the store: a binned link once it has been
+// in the bin for retention, any other link once it has expired.
+func (rec Record) removable(now time.Time, retention time.Duration) bool {
+	if rec.inBin() {
+		return !now.Before(rec.DeletedAt.Add(retention))
+	}
+	return rec.expired(now)
+}
+
+// indexListed adds rec to the indexes behind listings, collections, duplicate detection,
+// owner quotas and totals. Binned links are left out of them, so they stop counting as
+// soon as they are deleted; only the alias index, which restoring relies on, keeps them.
+func (s *URLStore) indexListed(shortKey string, rec Record) {
+	if rec.inBin() {
+		return
+	}
+	s.indexTags(shortKey, rec.Tags)
+	s.indexCollection(shortKey, rec)
+	s.indexURL(shortKey, rec)
+	s.indexOwner(rec)
+	s.indexTotals(rec)
+}
+
+func (s *URLStore) unindexListed(shortKey string, rec Record) {
+	if rec.inBin() {
+		return
+	}
+	s.unindexTags(shortKey, rec.Tags)
+	s.unindexCollection(shortKey, rec)
+	s.unindexURL(shortKey, rec)
+	s.unindexOwner(rec)
+	s.unindexTotals(rec)
+}
+
+// removeLinkLocked deletes shortKey on request: into the recycle bin when it is enabled
+// and the link isn't there already, for good otherwise. Must be called with s.mu held
+// for writing.
+func (s *URLStore) removeLinkLocked(shortKey string) {
+	rec := s.urls[shortKey]
+	if s.cfg.RecycleBinRetention <= 0 || rec.inBin() {
+		s.deleteLinkLocked(shortKey)
+		return
+	}
+
+	now := time.Now()
+	if s.cfg.AliasOnDelete != AliasDeleteOrphan {
+		for alias := range s.aliases[shortKey] {
+			if aliasRec := s.urls[alias]; !aliasRec.inBin() {
+				aliasRec.DeletedAt = now
+				s.emit(EventDeleted, alias, aliasRec)
+				s.putLocked(alias, aliasRec)
+			}
+		}
+	}
+	rec.DeletedAt = now
+	s.emit(EventDeleted, shortKey, rec)
+	s.putLocked(shortKey, rec)
+}
+
+// Restore takes the link stored under shortKey out of the recycle bin, along with the
+// aliases that were deleted with it. A non-empty owner may only restore their own links;
+// admins pass an empty owner.
+func (s *URLStore) Restore(shortKey, owner string) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, found := s.urls[shortKey]
+	if !found || !rec.inBin() {
+		return ErrLinkNotFound
+	}
+	if owner != "" && rec.Owner != owner {
+		return ErrNotOwner
+	}
+	if limit := s.quotaFor(rec.Owner); rec.Owner != "" && limit > 0 && s.ownerLinks[rec.Owner] >= limit {
+		return ErrQuotaExceeded // Binned links don't count, so others may have taken its place
+	}
+
+	for alias := range s.aliases[shortKey] {
+		if aliasRec := s.urls[alias]; aliasRec.DeletedAt.Equal(rec.DeletedAt) {
+			aliasRec.DeletedAt = time.Time{}
+			s.putLocked(alias, aliasRec)
+			s.emit(EventCreated, alias, aliasRec)
+		}
+	}
+	rec.DeletedAt = time.Time{}
+	s.putLocked(shortKey, rec)
+	s.emit(EventCreated, shortKey, rec)
+
+	s.saveAsync()
+	return nil
+}
+
+// purgeRecycleBin removes links that have been in the bin for the retention period,
+// returning how many were removed.
+func (s *URLStore) purgeRecycleBin() int {
+	if s.checkWritable() != nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var purged int
+	for key, rec := range s.urls {
+		if rec.inBin() && rec.removable(now, s.cfg.RecycleBinRetention) {
+			s.deleteLocked(key)
+			purged++
+		}
+	}
+	if purged > 0 {
+		slog.Info("Purged links from the recycle bin", "removed", purged)
+		s.saveAsync()
+	}
+	return purged
+}
+
+// startBinPurger purges the recycle bin periodically for the life of the process. It
+// does nothing when the bin is disabled or the store is a read-only replica.
+func (s *URLStore) startBinPurger() {
+	if s.cfg.RecycleBinRetention <= 0 || s.cfg.ReadOnly {
+		return
+	}
+	go func() {
+		for range time.Tick(min(s.cfg.RecycleBinRetention, maxPurgeInterval)) {
+			s.purgeRecycleBin()
+		}
+	}()
+}
+
+// handleRestore serves POST /{shortKey}/restore for admins and the link's owner.
+func (h *urlHandler) handleRestore(w http.ResponseWriter, r *http.Request, shortKey string) {
+	owner := h.owner(r)
+	if owner == "" && !h.requireAdmin(w, r) {
+		return
+	}
+
+	if err := h.store.Restore(shortKey, owner); err != nil {
+		storeError(w, r, err, "Failed to restore link")
+		return
+	}
+	slog.Info("Link restored", "key", shortKey)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// =======================================================================================
+// Redirects - Status and caching headers for the redirect itself. Permanent links may be
+// cached, which takes load off the server at the cost of clicks served from a cache never
+// being counted. Temporary links must always come back to us. Links can instead be served
+// as a small HTML page that moves on with a meta refresh and JavaScript, for clients that
+// don't follow 3xx responses or pages that want a beacon to fire first. Links answering
+// 307 or 308 keep the request's method and body, so they also accept POST, PUT and PATCH,
+// e.g. to forward webhooks.
+// =======================================================================================
+
+// defaultPermanentCacheMaxAge is how long a permanent redirect may be cached by default.
+const defaultPermanentCacheMaxAge = 24 * time.Hour
+
+// How a link sends visitors on, globally (Config.RedirectMode) or per link.
+const (
+	RedirectHTTP = "http"
+	RedirectHTML = "html"
+)
+
+var (
+	ErrInvalidRedirectMode   = errors.New(`redirectMode must be "http", "html" or "proxy"`)
+	ErrInvalidRedirectStatus = errors.New("redirectStatus must be 301, 302, 307 or 308, and 301 or 308 for permanent links")
+)
+
+// validateRedirect checks a link's own redirect settings.
+func validateRedirect(mode string, status int, permanent bool) error {
+	if mode != "" && mode != RedirectHTTP && mode != RedirectHTML && mode != RedirectProxy {
+		return ErrInvalidRedirectMode
+	}
+	switch status {
+	case 0, http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		return nil
+	case http.StatusFound, http.StatusTemporaryRedirect:
+		if !permanent {
+			return nil
+		}
+	}
+	return ErrInvalidRedirectStatus
+}
+
+// redirectStatus returns the status rec redirects with: its own RedirectStatus, or else
+// 301 for permanent links and 302 for others, or 308 and 307 with Config.PreserveMethod.
+func (h *urlHandler) redirectStatus(rec Record) int {
+	switch {
+	case rec.RedirectStatus != 0:
+		return rec.RedirectStatus
+	case rec.Permanent && h.cfg.PreserveMethod:
+		return http.StatusPermanentRedirect
+	case rec.Permanent:
+		return http.StatusMovedPermanently
+	case h.cfg.PreserveMethod:
+		return http.StatusTemporaryRedirect
+	default:
+		return http.StatusFound
+	}
+}
+
+// preservesMethod reports whether rec is served with a redirect that clients repeat with
+// the same method and body.
+func (h *urlHandler) preservesMethod(rec Record) bool {
+	switch {
+	case rec.RedirectMode == RedirectProxy && h.proxy != nil:
+		return false
+	case rec.RedirectMode == RedirectHTML || rec.RedirectMode == "" && h.cfg.RedirectMode == RedirectHTML:
+		return false
+	}
+	status := h.redirectStatus(rec)
+	return status == http.StatusTemporaryRedirect || status == http.StatusPermanentRedirect
+}
+
+// redirectPage is the HTML redirect. html/template escapes the destination for each
+// context it appears in: attribute, script string and link.
+var redirectPage = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="0; url={{.}}">
+<title>Redirecting</title>
+<script>window.location.replace({{.}});</script>
+</head>
+<body>
+<p>Redirecting to <a href="{{.}}">{{.}}</a></p>
+</body>
+</html>
+`))
+
+func (h *urlHandler) redirect(w http.ResponseWriter, r *http.Request, rec Record) {
+	setLinkHeaders(w, rec)
+	mode := rec.RedirectMode
+	if mode == "" {
+		mode = h.cfg.RedirectMode
+	}
+	if mode == RedirectHTML {
+		h.redirectHTML(w, rec)
+		return
+	}
+	if mode == RedirectProxy && h.proxy != nil {
+		h.proxy.serve(w, r, rec)
+		return
+	}
+
+	status := h.redirectStatus(rec)
+	if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+		w.Header().Set("Cache-Control", "no-cache")
+		http.Redirect(w, r, rec.URL, status)
+		return
+	}
+
+	// A cache must not keep serving the link after it expires.
+	maxAge := h.cfg.PermanentCacheMaxAge
+	if !rec.ExpiresAt.IsZero() {
+		maxAge = min(maxAge, time.Until(rec.ExpiresAt))
+	}
+	scope := "public"
+	if len(rec.Countries) > 0 {
+		scope = "private" // Shared caches can't tell visitors' countries apart
+	}
+	if maxAge > 0 {
+		w.Header().Set("Cache-Control", scope+", max-age="+strconv.Itoa(int(maxAge.Seconds())))
+		w.Header().Set("Expires", time.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	http.Redirect(w, r, rec.URL, status)
+}
+
+func (h *urlHandler) redirectHTML(w http.ResponseWriter, rec Record) {
+	var buf bytes.Buffer
+	if err := redirectPage.Execute(&buf, rec.URL); err != nil {
+		slog.Error("Error rendering redirect page", "error", err)
+		http.Error(w, "Failed to render redirect page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
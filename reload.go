@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// =======================================================================================
+// Reload - SIGHUP re-reads the data file, e.g. after restoring a backup or editing it by
+// hand. A reload and a save never overlap: both hold saveMu, so a reload waits for a
+// write in progress and a save that starts during a reload writes the reloaded data.
+// Changes not yet saved when the reload starts, such as recent click counts, are lost.
+// =======================================================================================
+
+// Reload replaces the store's contents with the data file. On error the current contents
+// are kept. Lock order is saveMu before mu, the same as in save.
+func (s *URLStore) Reload() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	urls, err := s.readFile()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replaceLocked(urls)
+	s.markLoadedLocked(urls)
+	return nil
+}
+
+// reloadOnHangup calls Reload for every SIGHUP the process receives.
+func reloadOnHangup(store *URLStore) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			if err := store.Reload(); err != nil {
+				slog.Error("Reload failed, keeping current data", "file", store.filename, "error", err)
+				continue
+			}
+			slog.Info("Reloaded data file", "file", store.filename, "links", store.Len())
+		}
+	}()
+}
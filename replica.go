@@ -0,0 +1,13 @@
+package main
+
+import "errors"
+
+// =======================================================================================
+// Read-Only Replicas - With SHORTY_READ_ONLY the store loads its data as usual but never
+// changes or writes it, so several instances can serve redirects and lookups from a copy
+// of the primary's data. Every mutating operation fails with ErrReadOnly (503). Clicks
+// are still counted in memory for stats, but are not saved. Send SIGHUP to pick up a
+// fresh copy of the data.
+// =======================================================================================
+
+var ErrReadOnly = errors.New("this instance is read-only")
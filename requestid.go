@@ -0,0 +1,31 @@
+package main
+
+import "net/http"
+
+// =======================================================================================
+// Request IDs - A request carrying an X-Request-ID header, as set by most load balancers
+// and proxies, has it passed on to what it triggers: click events in the click log and
+// the click webhook include it as requestID, webhook deliveries send it back in the same
+// header, and the debug request log records it. Operators can then follow a visit from
+// their proxy logs through to the webhook it caused. IDs that are overlong or contain
+// anything but visible ASCII are ignored rather than forwarded.
+// =======================================================================================
+
+const (
+	RequestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+)
+
+// requestID returns r's X-Request-ID, or "" when it has none fit to pass on.
+func requestID(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if len(id) > maxRequestIDLength {
+		return ""
+	}
+	for i := range len(id) {
+		if id[i] <= ' ' || id[i] > '~' {
+			return ""
+		}
+	}
+	return id
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log/slog"
+	"reflect"
+)
+
+// =======================================================================================
+// Save Failure Policy - With SHORTY_SYNC_WRITES a create that fails to save is reported to
+// the client, and SHORTY_SAVE_FAILURE decides what happens to the link in memory. "retain"
+// (the default) keeps it, so it keeps resolving and the next successful save writes it.
+// "rollback" undoes every change the create made, such as an eviction or a relocated
+// generated key, so memory matches the file the client was told doesn't have the link.
+// =======================================================================================
+
+const (
+	SaveFailureRetain   = "retain"
+	SaveFailureRollback = "rollback"
+)
+
+// journalEntry is a key's record before a journaled change, and after it once the change
+// is complete. A nil record means the key was absent.
+type journalEntry struct {
+	before, after *Record
+}
+
+// startJournalLocked begins recording the keys putLocked and deleteLocked change. Must be
+// called with s.mu held for writing, and stopJournalLocked before it is released.
+func (s *URLStore) startJournalLocked() {
+	s.journal = make(map[string]*journalEntry)
+}
+
+// journalLocked notes shortKey's record the first time it changes while journaling. Must
+// be called with s.mu held for writing, before the change.
+func (s *URLStore) journalLocked(shortKey string) {
+	if s.journal == nil {
+		return
+	}
+	if _, seen := s.journal[shortKey]; !seen {
+		s.journal[shortKey] = &journalEntry{before: recordPtr(s.urls, shortKey)}
+	}
+}
+
+// stopJournalLocked ends recording and returns what changed. Must be called with s.mu held
+// for writing.
+func (s *URLStore) stopJournalLocked() map[string]*journalEntry {
+	journal := s.journal
+	s.journal = nil
+	for key, entry := range journal {
+		entry.after = recordPtr(s.urls, key)
+	}
+	return journal
+}
+
+// rollback restores the records journal changed. Keys changed again since, say by a
+// later create, are left as they are rather than undoing someone else's write.
+func (s *URLStore) rollback(journal map[string]*journalEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	skipped := 0
+	for key, entry := range journal {
+		if !sameRecord(recordPtr(s.urls, key), entry.after) {
+			skipped++
+			continue
+		}
+		switch {
+		case entry.before == nil && entry.after != nil:
+			s.emit(EventDeleted, key, *entry.after)
+			s.deleteLocked(key)
+		case entry.before != nil:
+			s.putLocked(key, *entry.before)
+		}
+	}
+	slog.Warn("Rolled back a create after its save failed", "keys", len(journal)-skipped, "skipped", skipped)
+}
+
+func recordPtr(urls map[string]Record, shortKey string) *Record {
+	if rec, found := urls[shortKey]; found {
+		return &rec
+	}
+	return nil
+}
+
+func sameRecord(a, b *Record) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return reflect.DeepEqual(*a, *b)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// breakSaves makes every later save of s fail, by putting a file where the directory of
+// its data file was.
+func breakSaves(t *testing.T, s *URLStore) {
+	t.Helper()
+	dir := filepath.Dir(s.filename)
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSaveFailurePolicies(t *testing.T) {
+	tests := []struct {
+		policy   string
+		wantKept bool // Whether the failed creates are still in memory
+	}{
+		{SaveFailureRetain, true},
+		{SaveFailureRollback, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			t.Setenv("SHORTY_SYNC_WRITES", "true")
+			t.Setenv("SHORTY_SAVE_FAILURE", tt.policy)
+			s := newTestStore(t, testConfig(t))
+			ctx := context.Background()
+			promo := "promo"
+			if _, _, err := s.Add(ctx, AddRequest{URL: "https://example.com/old", CustomKey: &promo}); err != nil {
+				t.Fatal(err)
+			}
+
+			breakSaves(t, s)
+			if _, _, err := s.Add(ctx, AddRequest{URL: "https://example.com/new", CustomKey: &promo}); err == nil {
+				t.Fatal("replacing a link succeeded although its save failed")
+			}
+			if _, _, err := s.Add(ctx, AddRequest{URL: "https://example.com/other"}); err == nil {
+				t.Fatal("creating a link succeeded although its save failed")
+			}
+
+			rec, _ := s.Lookup(promo)
+			wantURL := "https://example.com/old"
+			if tt.wantKept {
+				wantURL = "https://example.com/new"
+			}
+			if rec.URL != wantURL {
+				t.Errorf("%s points to %q, want %q", promo, rec.URL, wantURL)
+			}
+			wantLinks := 1
+			if tt.wantKept {
+				wantLinks = 2
+			}
+			if n := len(s.urls); n != wantLinks {
+				t.Errorf("got %d links in memory, want %d", n, wantLinks)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// =======================================================================================
+// Key Rotation - Moves a link to a fresh key when the old one has leaked, keeping its
+// click count, tags and creation time. The old key can stay behind as a temporary alias
+// so links already shared keep working for a grace period. The same move can free a
+// generated key that a custom key request asks for; see Config.GeneratedKeyConflict.
+// =======================================================================================
+
+var (
+	ErrIsAlias           = errors.New("key is an alias; rotate the key it points to")
+	ErrGeneratedKeyTaken = errors.New("custom key conflicts with an auto-generated key")
+)
+
+// What a custom key request does when the key holds a link with a generated key.
+const (
+	GeneratedKeyReject   = "reject"   // Fail with ErrGeneratedKeyTaken
+	GeneratedKeyRelocate = "relocate" // Move the existing link to a new generated key
+	GeneratedKeyReplace  = "replace"  // Overwrite it, like any other custom key
+)
+
+// Rotate moves the link under shortKey to a newly generated key and returns it. With a
+// positive grace, shortKey keeps redirecting to the link until the grace period ends,
+// unless the store is at Config.MaxLinks; otherwise it stops resolving immediately.
+func (s *URLStore) Rotate(shortKey string, grace time.Duration) (string, error) {
+	if err := s.checkWritable(); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, found := s.urls[shortKey]
+	if !found || rec.expired(time.Now()) {
+		return "", ErrLinkNotFound
+	}
+	if rec.AliasOf != "" {
+		return "", ErrIsAlias
+	}
+
+	newKey, err := s.moveToNewKeyLocked(shortKey, rec)
+	if err != nil {
+		return "", err
+	}
+
+	if grace > 0 {
+		// A grace alias is a courtesy, not worth evicting another link for.
+		if s.cfg.MaxLinks > 0 && len(s.urls) >= s.cfg.MaxLinks {
+			slog.Warn("No room to keep rotated key as an alias", "key", shortKey, "error", ErrStoreFull)
+		} else {
+			now := time.Now()
+			s.putLocked(shortKey, Record{URL: rec.URL, CreatedAt: now, Owner: rec.Owner, AliasOf: newKey, ExpiresAt: now.Add(grace)})
+		}
+	}
+
+	s.saveAsync()
+	return newKey, nil
+}
+
+// moveToNewKeyLocked moves rec, stored under shortKey, to a newly generated key together
+// with its aliases, and returns the new key. Must be called with s.mu held for writing.
+func (s *URLStore) moveToNewKeyLocked(shortKey string, rec Record) (string, error) {
+	newKey, err := s.unusedKeyLocked(rec.URL)
+	if err != nil {
+		return "", err
+	}
+	// Aliases of the old key follow the link to its new key.
+	for key := range s.aliases[shortKey] {
+		alias := s.urls[key]
+		alias.AliasOf = newKey
+		s.putLocked(key, alias)
+	}
+	s.deleteLocked(shortKey)
+	rec.Generated = true
+	s.putLocked(newKey, rec)
+	return newKey, nil
+}
+
+// claimGeneratedKeyLocked applies Config.GeneratedKeyConflict before owner stores a link
+// under the custom key shortKey, which currently holds rec with a generated key. Must be
+// called with s.mu held for writing.
+func (s *URLStore) claimGeneratedKeyLocked(owner, shortKey string, rec Record) error {
+	switch s.cfg.GeneratedKeyConflict {
+	case GeneratedKeyReplace:
+		return nil
+	case GeneratedKeyRelocate:
+		// The checks the new link faces once shortKey is free, made up front so a
+		// failing one doesn't leave the existing link moved for nothing.
+		if err := s.checkOwnerLocked(owner, shortKey); err != nil {
+			return err
+		}
+		if s.cfg.MaxLinks > 0 && len(s.urls) >= s.cfg.MaxLinks && s.cfg.EvictionPolicy != EvictLRU {
+			return ErrStoreFull
+		}
+		newKey, err := s.moveToNewKeyLocked(shortKey, rec)
+		if err != nil {
+			return err
+		}
+		slog.Info("Moved link with a generated key to free it for a custom key", "key", shortKey, "newKey", newKey)
+		return nil
+	}
+	return ErrGeneratedKeyTaken
+}
+
+// unusedKeyLocked generates a key that is not stored at all. Unlike newKeyLocked it never
+// reuses a key already holding longURL, which under the hash strategy would be the very
+// key being rotated away from. Must be called with s.mu held.
+func (s *URLStore) unusedKeyLocked(longURL string) (string, error) {
+	for attempt := range keyGenAttempts {
+		shortKey, err := s.keys.Generate(longURL, attempt)
+		if err != nil {
+			return "", err
+		}
+		if _, taken := s.urls[shortKey]; !taken && !reservedKeys[shortKey] && !keyBlocked(shortKey, s.cfg) {
+			return shortKey, nil
+		}
+	}
+	return "", ErrKeySpaceFull
+}
+
+// handleRotate serves POST /{shortKey}/rotate. The optional grace query parameter is a
+// Go duration (e.g. "72h") for which the old key keeps working.
+func (h *urlHandler) handleRotate(w http.ResponseWriter, r *http.Request, shortKey string) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var grace time.Duration
+	if value := r.URL.Query().Get("grace"); value != "" {
+		var err error
+		if grace, err = time.ParseDuration(value); err != nil || grace < 0 {
+			writeError(w, r, "Grace must be a non-negative duration such as 72h", http.StatusBadRequest)
+			return
+		}
+	}
+
+	newKey, err := h.store.Rotate(shortKey, grace)
+	if err != nil {
+		storeError(w, r, err, "Failed to rotate key")
+		return
+	}
+
+	responseData := struct {
+		ShortKey    string `json:"shortKey"`
+		PreviousKey string `json:"previousKey"`
+	}{
+		ShortKey:    newKey,
+		PreviousKey: shortKey,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(responseData)
+}
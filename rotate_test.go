@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRotateGraceAliasNeverEvicts(t *testing.T) {
+	tests := []struct {
+		policy   string
+		maxLinks string
+		wantKept bool // Whether the old key stays as a grace alias
+	}{
+		{EvictReject, "2", false},
+		{EvictLRU, "2", false},
+		{EvictLRU, "3", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+"/"+tt.maxLinks, func(t *testing.T) {
+			t.Setenv("SHORTY_EVICTION_POLICY", tt.policy)
+			t.Setenv("SHORTY_MAX_LINKS", tt.maxLinks)
+			s := newTestStore(t, testConfig(t))
+			rotated := addTestLink(t, s, "https://example.com/a")
+			other := addTestLink(t, s, "https://example.com/b")
+
+			newKey, err := s.Rotate(rotated, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, found := s.Lookup(newKey); !found {
+				t.Errorf("rotated link is missing under %s", newKey)
+			}
+			if _, found := s.Lookup(other); !found {
+				t.Error("rotating evicted another link")
+			}
+			if _, kept := s.Lookup(rotated); kept != tt.wantKept {
+				t.Errorf("old key resolves: %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// =======================================================================================
+// Scheduled Links - A link created with "activeAt": "2024-06-01T09:00:00Z" exists from
+// the start but doesn't resolve until then, so campaign links can be created, printed and
+// shared ahead of launch. Until it is active, following it answers 425 Too Early with a
+// Retry-After of the time remaining; the info and stats endpoints work as usual.
+// =======================================================================================
+
+// pending reports whether rec has a start time that is still after now.
+func (rec Record) pending(now time.Time) bool {
+	return !rec.ActiveAt.IsZero() && now.Before(rec.ActiveAt)
+}
+
+// linkNotYetActive answers a request for a link that becomes active at activeAt.
+func linkNotYetActive(w http.ResponseWriter, r *http.Request, activeAt time.Time) {
+	w.Header().Set("Cache-Control", "no-store") // The answer changes at activeAt
+	w.Header().Set("Retry-After", strconv.FormatFloat(math.Ceil(time.Until(activeAt).Seconds()), 'f', 0, 64))
+	if !wantsJSON(r) {
+		http.Error(w, "This link is not active yet", http.StatusTooEarly)
+		return
+	}
+	jsonError(w, http.StatusTooEarly, "not active yet")
+}
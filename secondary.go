@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// =======================================================================================
+// Secondary Storage - With SHORTY_SECONDARY_STORAGE set to json or bolt, every save of the
+// store is also written to SHORTY_SECONDARY_FILE (urls.json or urls.db by default), for
+// migrating between backends or keeping a redundant copy. Links are only ever read from
+// the primary. The secondary is written after the primary, rewritten whole each time, so
+// the first save after startup backfills it and a missed save is made up by the next.
+// Its failures are logged and otherwise ignored: they never fail the change that was
+// saved. To migrate, run with the new backend as the secondary until it has been
+// written, then restart with it as the primary.
+// =======================================================================================
+
+// secondaryStore is the target saves are copied to.
+type secondaryStore struct {
+	filename string
+	db       *bolt.DB // Nil unless Config.SecondaryStorage is StorageBolt
+}
+
+// openSecondary opens the secondary target configured in cfg, which must not be the
+// primary's filename.
+func openSecondary(filename string, cfg Config) (*secondaryStore, error) {
+	if filepath.Clean(cfg.SecondaryFile) == filepath.Clean(filename) {
+		return nil, errors.New("SHORTY_SECONDARY_FILE must not be the primary data file")
+	}
+	secondary := &secondaryStore{filename: cfg.SecondaryFile}
+	if cfg.SecondaryStorage == StorageBolt {
+		db, err := openBolt(secondary.filename, false)
+		if err != nil {
+			return nil, err
+		}
+		secondary.db = db
+	}
+	return secondary, nil
+}
+
+// saveSecondary copies the store to the secondary target, if there is one, logging a
+// failure. data is the data file contents the primary just wrote, before compression and
+// encryption, or nil when the primary is bolt. Must be called with saveMu held, after the
+// primary was written.
+func (s *URLStore) saveSecondary(ctx context.Context, data []byte) {
+	if s.secondary == nil {
+		return
+	}
+	var err error
+	if s.secondary.db != nil {
+		err = s.saveSecondaryBolt()
+	} else {
+		err = s.saveSecondaryJSON(ctx, data)
+	}
+	if err != nil {
+		slog.Warn("Writing secondary storage failed", "file", s.secondary.filename, "error", err)
+	}
+}
+
+func (s *URLStore) saveSecondaryJSON(ctx context.Context, data []byte) error {
+	if data == nil {
+		var err error
+		s.mu.RLock()
+		data, err = encodeDataFile(s.persistedLocked(), s.cfg.PrettyData)
+		s.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+	if len(s.cfg.EncryptionKey) > 0 {
+		var err error
+		if data, err = encryptData(s.cfg.EncryptionKey, data); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(ctx, s.secondary.filename, data, 0644)
+}
+
+// saveSecondaryBolt replaces every link in the secondary database, in one transaction.
+func (s *URLStore) saveSecondaryBolt() error {
+	values := make(map[string][]byte)
+	s.mu.RLock()
+	for key, rec := range s.urls {
+		value, err := s.encodeRecord(rec)
+		if err != nil {
+			s.mu.RUnlock()
+			return err
+		}
+		values[key] = value
+	}
+	s.mu.RUnlock()
+
+	return s.secondary.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(linksBucket)
+		if err != nil {
+			return err
+		}
+		if err := s.deleteStoredKeys(bucket); err != nil {
+			return err
+		}
+		for key, value := range values {
+			if err := bucket.Put(s.storedKey(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
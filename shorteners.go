@@ -0,0 +1,30 @@
+package main
+
+import "errors"
+
+// =======================================================================================
+// Other Shorteners - Links to other URL shorteners are refused by default. A short link
+// to a short link hides the real destination twice over, defeats host rules and checks,
+// and is a common way to launder abusive URLs. defaultShortenerHosts lists the well-known
+// services; SHORTY_SHORTENER_HOSTS adds more and SHORTY_BLOCK_SHORTENERS=false turns the
+// check off. Hosts named in SHORTY_ALLOWED_HOSTS are always allowed. This server's own
+// links are governed by SHORTY_SELF_LINKS instead.
+// =======================================================================================
+
+var ErrShortenerHost = errors.New("links to other URL shorteners are not allowed")
+
+// defaultShortenerHosts are matched like BlockedHosts, so each covers its subdomains.
+var defaultShortenerHosts = []string{
+	".bit.ly", ".bitly.com", ".bit.do", ".buff.ly", ".clck.ru", ".cutt.ly", ".goo.gl",
+	".is.gd", ".lnkd.in", ".ow.ly", ".rb.gy", ".rebrand.ly", ".s.id", ".short.io",
+	".shorturl.at", ".t.co", ".t.ly", ".tiny.cc", ".tinyurl.com", ".v.gd",
+}
+
+// shortenerHosts returns the hosts treated as other shorteners: the defaults and extra,
+// or none when blocking is off.
+func shortenerHosts(block bool, extra []string) []string {
+	if !block {
+		return nil
+	}
+	return append(append([]string(nil), defaultShortenerHosts...), extra...)
+}
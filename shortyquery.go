@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// =======================================================================================
+// /shorty Query Parameters - The /shorty route serves three operations, and each reads
+// its own query parameters: creates with a body take the options below, creates from the
+// query string (GET /shorty?url=...) also take the link's fields, and listings take
+// paging and filters. Anything else in the query is ignored, unless SHORTY_STRICT_QUERY
+// is set, in which case an unknown parameter or a malformed query string gets 400, so a
+// misspelt option such as ?dryrun=true can't silently create a real link.
+// =======================================================================================
+
+var (
+	// createQueryParams are read by creates, whether from a body or the query.
+	createQueryParams = []string{"mode", "dryRun", "verbose", "expiresIn"}
+	// queryCreateParams are the link's fields in GET /shorty?url=...
+	queryCreateParams = []string{"url", "customKey", "tags", "collection"}
+	// listQueryParams are read by GET /shorty listings.
+	listQueryParams = []string{"limit", "offset", "tag", "since", "until", "format"}
+)
+
+// checkShortyQuery reports whether r's query only holds parameters from the known sets.
+// Outside Config.StrictQuery every query passes; otherwise it has answered 400.
+func (h *urlHandler) checkShortyQuery(w http.ResponseWriter, r *http.Request, known ...[]string) bool {
+	if !h.cfg.StrictQuery {
+		return true
+	}
+	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		writeError(w, r, "Malformed query string", http.StatusBadRequest)
+		return false
+	}
+	for name := range query {
+		if !slices.ContainsFunc(known, func(params []string) bool { return slices.Contains(params, name) }) {
+			writeError(w, r, "Unknown query parameter: "+name, http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
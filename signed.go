@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// =======================================================================================
+// Signed Keys - A stateless alternative to stored links. The key itself carries the
+// destination and expiry, authenticated with an HMAC under SHORTY_SIGNING_KEY, so the
+// server keeps nothing for it. Signed keys are much longer than stored ones and have no
+// click counts. They contain a '.', which custom keys can't, so the two never collide.
+// =======================================================================================
+
+const (
+	signedKeySeparator = "."
+	signatureLength    = 16 // Bytes of the HMAC-SHA256 kept in the key
+)
+
+// signKey returns a key for longURL that expires at expiresAt, or never when it is zero.
+// The payload is the expiry in Unix seconds followed by the URL.
+func signKey(secret []byte, longURL string, expiresAt time.Time) string {
+	payload := make([]byte, 8, 8+len(longURL))
+	if !expiresAt.IsZero() {
+		binary.BigEndian.PutUint64(payload, uint64(expiresAt.Unix()))
+	}
+	payload = append(payload, longURL...)
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + signedKeySeparator + base64.RawURLEncoding.EncodeToString(signPayload(secret, encoded))
+}
+
+func signPayload(secret []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)[:signatureLength]
+}
+
+// verifySignedKey decodes a key made by signKey. It reports false for keys that aren't
+// in the signed format or whose signature doesn't match, expired or not.
+func verifySignedKey(secret []byte, shortKey string) (Record, bool) {
+	encoded, sig, ok := strings.Cut(shortKey, signedKeySeparator)
+	if !ok {
+		return Record{}, false
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, signPayload(secret, encoded)) {
+		return Record{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(payload) < 8 {
+		return Record{}, false
+	}
+
+	rec := Record{URL: string(payload[8:])}
+	if expiry := binary.BigEndian.Uint64(payload[:8]); expiry != 0 {
+		rec.ExpiresAt = time.Unix(int64(expiry), 0)
+	}
+	return rec, true
+}
+
+// lookupSigned decodes shortKey when signed keys are enabled and it is a valid one. The
+// record may have expired.
+func (s *URLStore) lookupSigned(shortKey string) (Record, bool) {
+	if len(s.cfg.SigningKey) == 0 || !strings.Contains(shortKey, signedKeySeparator) {
+		return Record{}, false
+	}
+	return verifySignedKey(s.cfg.SigningKey, shortKey)
+}
+
+// mayExist reports whether shortKey could name a link at all: stored keys are at most
+// maxKeyLength long, and only signed keys are longer.
+func (h *urlHandler) mayExist(shortKey string) bool {
+	return len(shortKey) <= maxKeyLength || (len(h.cfg.SigningKey) > 0 && strings.Contains(shortKey, signedKeySeparator))
+}
+
+// handleSignedPost serves POST /shorty?mode=signed&expiresIn=72h, minting a signed key
+// for the body's url without storing anything.
+func (h *urlHandler) handleSignedPost(w http.ResponseWriter, r *http.Request, req AddRequest) {
+	if len(h.cfg.SigningKey) == 0 {
+		writeError(w, r, "Signed keys are not enabled", http.StatusNotFound)
+		return
+	}
+	if req.CustomKey != nil || len(req.Tags) > 0 || req.Collection != "" || req.Description != "" || req.needsOwnKey() || req.Permanent {
+		writeError(w, r, "Signed keys don't support customKey, tags, collection, description, devices, countries, variants, fallbacks, prefix, params, activeAt, noTracking, maxClicks or permanent, and take expiresIn as a query parameter", http.StatusBadRequest)
+		return
+	}
+	if err := validateDestination(req.URL, h.cfg); err != nil {
+		storeError(w, r, err, "Failed to create signed key")
+		return
+	}
+
+	var expiresAt time.Time
+	if value := r.URL.Query().Get("expiresIn"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			writeError(w, r, "ExpiresIn must be a positive duration such as 72h", http.StatusBadRequest)
+			return
+		}
+		expiresAt = time.Now().Add(ttl).Truncate(time.Second) // The key stores whole seconds
+	}
+
+	shortKey := signKey(h.cfg.SigningKey, req.URL, expiresAt)
+	w.Header().Set("Location", h.linkLocation(shortKey))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		ShortKey  string    `json:"shortKey"`
+		ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	}{
+		ShortKey:  shortKey,
+		ExpiresAt: expiresAt,
+	})
+}
@@ -0,0 +1,30 @@
+package main
+
+import "strings"
+
+// =======================================================================================
+// Destination Slashes - With SHORTY_COLLAPSE_URL_SLASHES, runs of slashes in the path of a
+// destination, such as "https://example.com//a//b", are stored as one, so a URL pasted
+// together from parts still reaches its target. Only the path changes: the "://" after
+// the scheme, the query and the fragment are kept as given. It is opt-in, since some
+// servers treat "//" in a path as meaningful.
+// =======================================================================================
+
+// applySlashPolicy returns the URL to store for longURL under Config.CollapseURLSlashes.
+// It runs after validateDestination, so longURL has a scheme and a host.
+func (s *URLStore) applySlashPolicy(longURL string) string {
+	if !s.cfg.CollapseURLSlashes {
+		return longURL
+	}
+	authority := strings.Index(longURL, "://") + len("://")
+	i := strings.IndexAny(longURL[authority:], "/?#")
+	if i < 0 || longURL[authority+i] != '/' {
+		return longURL // No path
+	}
+	pathStart := authority + i
+	pathEnd := len(longURL)
+	if i := strings.IndexAny(longURL[pathStart:], "?#"); i >= 0 {
+		pathEnd = pathStart + i
+	}
+	return longURL[:pathStart] + collapseSlashes(longURL[pathStart:pathEnd]) + longURL[pathEnd:]
+}
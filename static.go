@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// =======================================================================================
+// Static Assets - With SHORTY_STATIC_DIR set, files in that directory are served under
+// SHORTY_STATIC_PREFIX (/ui/ by default), for operators shipping their own landing page
+// or admin UI. The prefix is matched before short keys and its first segment can't be
+// chosen as a key, so asset paths never resolve as links. Requests can't leave the
+// directory: paths are cleaned before they are opened, and dotfiles such as .env are
+// never served. A directory without an index.html answers 404 rather than listing its
+// files.
+// =======================================================================================
+
+const defaultStaticPrefix = "/ui/"
+
+// staticFS is the served directory, minus dotfiles and directory listings.
+type staticFS struct {
+	root http.FileSystem
+}
+
+func (fs staticFS) Open(name string) (http.File, error) {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return nil, os.ErrNotExist // Hidden files, and ".." should one ever get here
+		}
+	}
+	f, err := fs.root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		index, err := fs.root.Open(strings.TrimSuffix(name, "/") + "/index.html")
+		if err != nil {
+			f.Close()
+			return nil, os.ErrNotExist
+		}
+		index.Close()
+	}
+	return f, nil
+}
+
+// newStaticHandler serves the files under dir, or fails when dir isn't a directory.
+func newStaticHandler(dir string) (http.Handler, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: os.ErrInvalid}
+	}
+	return http.FileServer(staticFS{http.Dir(dir)}), nil
+}
+
+// staticKey is the key the static prefix would shadow, such as "ui" for "/ui/".
+func staticKey(cfg Config) string {
+	if cfg.StaticDir == "" {
+		return ""
+	}
+	key, _, _ := strings.Cut(strings.Trim(cfg.StaticPrefix, "/"), "/")
+	return key
+}
+
+// serveStatic serves the asset at path, which starts with the static prefix.
+func (h *urlHandler) serveStatic(w http.ResponseWriter, r *http.Request, path string) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	name := strings.TrimPrefix(path, h.cfg.StaticPrefix)
+	if h.cfg.RawPaths {
+		var err error
+		if name, err = url.PathUnescape(name); err != nil {
+			notFound(w, r)
+			return
+		}
+	}
+	asset := r.Clone(r.Context())
+	asset.URL.Path = "/" + name
+	asset.URL.RawPath = ""
+	h.static.ServeHTTP(w, asset)
+}
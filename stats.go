@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// =======================================================================================
+// Click Statistics - Per-link click counts bucketed by hour and by day. Each record keeps
+// a fixed number of buckets so the history stays bounded however long a link lives;
+// older clicks only remain in the running total. /stats/{shortKey}.json and .csv return
+// a one-line summary of a link, the CSV with the columns of the CSV export. These
+// and the hourly and daily counts carry ETags; see etag.go. Every count saturates at
+// the largest uint64 instead of wrapping back to zero.
+// =======================================================================================
+
+const (
+	hourlyBuckets = 24
+	dailyBuckets  = 30
+)
+
+// clickBuckets counts clicks in consecutive buckets of one width. Counts[0] is the bucket
+// starting at Start, Counts[1] the one before it, and so on.
+type clickBuckets struct {
+	Start  time.Time `json:"start"`
+	Counts []uint64  `json:"counts"`
+}
+
+func (b clickBuckets) IsZero() bool { return len(b.Counts) == 0 }
+
+// addClicks returns a+b, or math.MaxUint64 when the sum doesn't fit.
+func addClicks(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+// add returns b with one click at t counted. It never modifies b's Counts in place, since
+// copies of a Record handed out by the store share the slice.
+func (b clickBuckets) add(t time.Time, width time.Duration, size int) clickBuckets {
+	start := t.UTC().Truncate(width)
+	if b.IsZero() {
+		return clickBuckets{Start: start, Counts: []uint64{1}}
+	}
+
+	shift := 0
+	if start.After(b.Start) {
+		shift = int(start.Sub(b.Start) / width)
+		b.Start = start
+	}
+	counts := make([]uint64, min(shift+len(b.Counts), size))
+	copy(counts[min(shift, size):], b.Counts)
+
+	// A click older than the newest bucket, e.g. after the clock stepped back.
+	index := int(b.Start.Sub(start) / width)
+	if index < len(counts) {
+		counts[index] = addClicks(counts[index], 1)
+	}
+	b.Counts = counts
+	return b
+}
+
+// merge returns the bucket-wise sum of b and other, aligned on the newer of their starts.
+func (b clickBuckets) merge(other clickBuckets, width time.Duration, size int) clickBuckets {
+	if other.IsZero() {
+		return b
+	}
+	if b.IsZero() {
+		return other
+	}
+	start := b.Start
+	if other.Start.After(start) {
+		start = other.Start
+	}
+	counts := make([]uint64, size)
+	used := 0
+	for _, src := range []clickBuckets{b, other} {
+		shift := int(start.Sub(src.Start) / width)
+		for i, count := range src.Counts {
+			if shift+i < size {
+				counts[shift+i] = addClicks(counts[shift+i], count)
+				used = max(used, shift+i+1)
+			}
+		}
+	}
+	return clickBuckets{Start: start, Counts: counts[:used]}
+}
+
+// series returns the size buckets up to and including the one holding now, oldest first.
+func (b clickBuckets) series(now time.Time, width time.Duration, size int) []bucketView {
+	newest := now.UTC().Truncate(width)
+	views := make([]bucketView, size)
+	for i := range views {
+		start := newest.Add(-time.Duration(size-1-i) * width)
+		views[i].Start = start
+		if back := int(b.Start.Sub(start) / width); !b.IsZero() && !start.After(b.Start) && back < len(b.Counts) {
+			views[i].Clicks = b.Counts[back]
+		}
+	}
+	return views
+}
+
+type bucketView struct {
+	Start  time.Time `json:"start"`
+	Clicks uint64    `json:"clicks"`
+}
+
+// countClick adds one click at t to rec's total and bucketed history.
+func (rec *Record) countClick(t time.Time) {
+	rec.Clicks = addClicks(rec.Clicks, 1)
+	rec.Hourly = rec.Hourly.add(t, time.Hour, hourlyBuckets)
+	rec.Daily = rec.Daily.add(t, 24*time.Hour, dailyBuckets)
+}
+
+// handleClickStats serves GET /stats/{shortKey}/clicks?interval=hour|day.
+func (h *urlHandler) handleClickStats(w http.ResponseWriter, r *http.Request, shortKey string) {
+	rec, found := h.store.Lookup(shortKey)
+	if !found {
+		notFound(w, r)
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	var buckets []bucketView
+	switch interval {
+	case "", "hour":
+		interval = "hour"
+		buckets = rec.Hourly.series(time.Now(), time.Hour, hourlyBuckets)
+	case "day":
+		buckets = rec.Daily.series(time.Now(), 24*time.Hour, dailyBuckets)
+	default:
+		writeError(w, r, "Interval must be hour or day", http.StatusBadRequest)
+		return
+	}
+	// The buckets shift as time passes, so the tag changes with each new bucket too.
+	if notModified(w, r, statsETag(rec, h.cfg.StatsETagClicks, "clicks", interval, buckets[0].Start.Format(time.RFC3339))) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ShortKey    string       `json:"shortKey"`
+		DisplayURL  string       `json:"displayURL,omitempty"`
+		Description string       `json:"description,omitempty"`
+		Interval    string       `json:"interval"`
+		Total       uint64       `json:"total"`
+		Remaining   *uint64      `json:"remainingClicks,omitempty"`
+		Variants    []Variant    `json:"variants,omitempty"`
+		Buckets     []bucketView `json:"buckets"`
+	}{
+		ShortKey:    shortKey,
+		DisplayURL:  rec.DisplayURL,
+		Description: rec.Description,
+		Interval:    interval,
+		Total:       rec.Clicks,
+		Remaining:   rec.remainingClicks(),
+		Variants:    rec.Variants,
+		Buckets:     buckets,
+	})
+}
+
+// handleStatsFile serves GET /stats/{shortKey}.json and /stats/{shortKey}.csv, picking
+// the format from the extension so clients need no headers or parameters.
+func (h *urlHandler) handleStatsFile(w http.ResponseWriter, r *http.Request, shortKey, format string) {
+	rec, found := h.store.Lookup(shortKey)
+	if !found {
+		notFound(w, r)
+		return
+	}
+	if notModified(w, r, statsETag(rec, h.cfg.StatsETagClicks, format)) {
+		return
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		out := csv.NewWriter(w)
+		out.Write([]string{"shortKey", "longURL", "clicks", "createdAt", "expiresAt"})
+		out.Write([]string{shortKey, rec.URL, strconv.FormatUint(rec.Clicks, 10), csvTime(rec.CreatedAt), csvTime(rec.ExpiresAt)})
+		out.Flush()
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ShortKey  string    `json:"shortKey"`
+		URL       string    `json:"url"`
+		Clicks    uint64    `json:"clicks"`
+		Remaining *uint64   `json:"remainingClicks,omitempty"`
+		CreatedAt time.Time `json:"createdAt"`
+		ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	}{shortKey, rec.URL, rec.Clicks, rec.remainingClicks(), rec.CreatedAt, rec.ExpiresAt})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// =======================================================================================
+// Streaming Load - Data files in the current format are decoded straight from the file,
+// one link at a time, rather than read into memory whole and then parsed, so loading a
+// large store needs little more memory than the links themselves. Compressed files are
+// inflated on the way. Encrypted files, which must be read whole to be authenticated, and
+// files in older formats, which are migrated as a whole, take the buffered path through
+// decodeFile instead. The link map is sized up front from the file's size, or the
+// inflated size a gzip file records, divided by SHORTY_LOAD_BYTES_PER_LINK, sparing a
+// large store the rehashing of a map grown one link at a time.
+// =======================================================================================
+
+// defaultLoadBytesPerLink is a typical size of one link in the data file.
+const defaultLoadBytesPerLink = 256
+
+// maxLoadSizeHint bounds the map size guessed from a file, in case the guess is wild.
+const maxLoadSizeHint = 1 << 24
+
+// errNotStreamable reports a data file the streaming decoder leaves to decodeFile.
+var errNotStreamable = errors.New("data file can't be streamed")
+
+// streamDataFile loads the data file at path by streaming. It fails with errNotStreamable
+// before decoding any link when the file isn't in the current format. A positive
+// bytesPerLink sizes the link map from the file's size; see loadSizeHint.
+func streamDataFile(path string, bytesPerLink int) (map[string]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var size int64
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	var r io.Reader = bufio.NewReader(f)
+	if magic, _ := r.(*bufio.Reader).Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		size = gzipInflatedSize(f, size)
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	return decodeDataStream(json.NewDecoder(r), loadSizeHint(size, bytesPerLink))
+}
+
+// loadSizeHint guesses how many links a data file of size bytes holds, or returns 0 when
+// there's nothing to go on.
+func loadSizeHint(size int64, bytesPerLink int) int {
+	if size <= 0 || bytesPerLink <= 0 {
+		return 0
+	}
+	return int(min(size/int64(bytesPerLink), maxLoadSizeHint))
+}
+
+// gzipInflatedSize returns the uncompressed size a single-member gzip file of size bytes
+// records in its trailer, modulo 4 GiB, or 0 when it can't be read.
+func gzipInflatedSize(f *os.File, size int64) int64 {
+	var trailer [4]byte
+	if size < 4 {
+		return 0
+	}
+	if _, err := f.ReadAt(trailer[:], size-4); err != nil {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint32(trailer[:]))
+}
+
+// decodeDataStream decodes {"version": N, "links": {...}} as encodeDataFile writes it,
+// with the version first. sizeHint presizes the map; 0 leaves it to grow.
+func decodeDataStream(dec *json.Decoder, sizeHint int) (map[string]Record, error) {
+	var version int
+	if !nextDelim(dec, '{') || !nextKey(dec, "version") || dec.Decode(&version) != nil ||
+		version != currentFormatVersion || !nextKey(dec, "links") || !nextDelim(dec, '{') {
+		return nil, errNotStreamable
+	}
+
+	urls := make(map[string]Record, sizeHint)
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := token.(string) // Object keys always decode as strings
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			return nil, fmt.Errorf("key %q: %w", key, err)
+		}
+		urls[key] = rec
+	}
+	if !nextDelim(dec, '}') || !nextDelim(dec, '}') {
+		return nil, errors.New("data file has unexpected fields after its links")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("data file has trailing data")
+	}
+	return urls, nil
+}
+
+func nextDelim(dec *json.Decoder, delim json.Delim) bool {
+	token, err := dec.Token()
+	return err == nil && token == delim
+}
+
+func nextKey(dec *json.Decoder, key string) bool {
+	token, err := dec.Token()
+	return err == nil && token == key
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// =======================================================================================
+// Tags - Free-form labels attached to links at creation and indexed for filtering.
+// =======================================================================================
+
+const (
+	maxTags      = 10
+	maxTagLength = 32
+)
+
+var ErrInvalidTags = errors.New("invalid tags")
+
+// validateTags checks the tag count, each tag's length and characters, and duplicates.
+func validateTags(tags []string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidTags, maxTags)
+	}
+
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if tag == "" || len(tag) > maxTagLength {
+			return fmt.Errorf("%w: tags must be 1 to %d characters", ErrInvalidTags, maxTagLength)
+		}
+		for _, c := range tag {
+			if !isKeyChar(c) {
+				return fmt.Errorf("%w: %q may only contain letters, digits, '-' and '_'", ErrInvalidTags, tag)
+			}
+		}
+		if seen[tag] {
+			return fmt.Errorf("%w: duplicate tag %q", ErrInvalidTags, tag)
+		}
+		seen[tag] = true
+	}
+	return nil
+}
+
+// indexTags and unindexTags maintain s.byTag. Must be called with s.mu held for writing.
+func (s *URLStore) indexTags(shortKey string, tags []string) {
+	for _, tag := range tags {
+		keys := s.byTag[tag]
+		if keys == nil {
+			keys = make(map[string]struct{})
+			s.byTag[tag] = keys
+		}
+		keys[shortKey] = struct{}{}
+	}
+}
+
+func (s *URLStore) unindexTags(shortKey string, tags []string) {
+	for _, tag := range tags {
+		delete(s.byTag[tag], shortKey)
+		if len(s.byTag[tag]) == 0 {
+			delete(s.byTag, tag)
+		}
+	}
+}
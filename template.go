@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// =======================================================================================
+// Template Links - A link created with "params": {"id": "[0-9]+"} treats its url as a
+// template: https://example.com/user/{id} is sent visitors of /{key}/42 as
+// https://example.com/user/42. Each placeholder takes one path segment after the key, in
+// the order the placeholders first appear in the url, and must fully match its param's
+// regular expression; an empty expression accepts any segment. Values are escaped for
+// the part of the url they land in, and placeholders can't be in the host, so a value
+// never changes where a link points. A request with missing, extra or invalid values
+// answers 400. The request's query string is carried over, as for prefix links.
+// =======================================================================================
+
+const (
+	maxTemplateParams = 8
+	maxParamPattern   = 256
+)
+
+var (
+	ErrInvalidParams = errors.New("invalid params")
+
+	placeholderPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	paramPatterns      sync.Map // Param expression -> its compiled, anchored *regexp.Regexp
+)
+
+// templateParams returns the names of the placeholders in template, in the order they
+// first appear.
+func templateParams(template string) []string {
+	var names []string
+	for _, match := range placeholderPattern.FindAllStringSubmatch(template, -1) {
+		if !slices.Contains(names, match[1]) {
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// sampleTemplate returns template with every placeholder replaced by value, for checking
+// the url a template link produces.
+func sampleTemplate(template, value string) string {
+	return placeholderPattern.ReplaceAllLiteralString(template, value)
+}
+
+// sampleURL returns the url to check for req: a sample of its template when it has
+// params, its url otherwise.
+func (req AddRequest) sampleURL() string {
+	if len(req.Params) == 0 {
+		return req.URL
+	}
+	return sampleTemplate(req.URL, "x")
+}
+
+// compileParamPattern returns the anchored form of a param's expression, or nil for an
+// empty one, which accepts anything.
+func compileParamPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if re, found := paramPatterns.Load(pattern); found {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	paramPatterns.Store(pattern, re)
+	return re, nil
+}
+
+// validateParams checks a template link's params against the placeholders in its url.
+// combined reports that the link also has other destinations or answers paths below its
+// key, which templates can't be mixed with.
+func validateParams(template string, params map[string]string, combined bool) error {
+	switch {
+	case len(params) == 0:
+		return nil
+	case len(params) > maxTemplateParams:
+		return fmt.Errorf("%w: a link has at most %d params", ErrInvalidParams, maxTemplateParams)
+	case combined:
+		return fmt.Errorf("%w: params can't be combined with devices, countries, variants, fallbacks or prefix", ErrInvalidParams)
+	}
+
+	names := templateParams(template)
+	for _, name := range names {
+		if _, found := params[name]; !found {
+			return fmt.Errorf("%w: placeholder {%s} has no param", ErrInvalidParams, name)
+		}
+	}
+	for name, pattern := range params {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("%w: param %q is not a placeholder in the url", ErrInvalidParams, name)
+		}
+		if len(pattern) > maxParamPattern {
+			return fmt.Errorf("%w: param %q: expression is longer than %d bytes", ErrInvalidParams, name, maxParamPattern)
+		}
+		if _, err := compileParamPattern(pattern); err != nil {
+			return fmt.Errorf("%w: param %q: %v", ErrInvalidParams, name, err)
+		}
+	}
+
+	a, errA := url.Parse(sampleTemplate(template, "a"))
+	b, errB := url.Parse(sampleTemplate(template, "b"))
+	if errA != nil || errB != nil || a.Scheme != b.Scheme || a.Host != b.Host || a.User.String() != b.User.String() {
+		return fmt.Errorf("%w: placeholders can only be in the url's path, query or fragment", ErrInvalidParams)
+	}
+	return nil
+}
+
+// fillTemplate returns the destination of a template link for a request whose path
+// after the key is remainder, with query appended to the destination's query string.
+// rawPaths reports that remainder is still escaped, as under Config.RawPaths.
+func fillTemplate(template string, params map[string]string, remainder, query string, rawPaths bool) (string, error) {
+	names := templateParams(template)
+	var values []string
+	if remainder != "" {
+		values = strings.Split(strings.TrimPrefix(remainder, "/"), "/")
+	}
+	if len(values) != len(names) {
+		return "", fmt.Errorf("this link takes %d path parameters (%s), got %d", len(names), strings.Join(names, ", "), len(values))
+	}
+
+	byName := make(map[string]string, len(names))
+	for i, name := range names {
+		value := values[i]
+		if rawPaths {
+			var err error
+			if value, err = url.PathUnescape(value); err != nil {
+				return "", fmt.Errorf("invalid value for %s", name)
+			}
+		}
+		if value == "" || value == "." || value == ".." {
+			return "", fmt.Errorf("invalid value for %s", name)
+		}
+		re, _ := compileParamPattern(params[name]) // Checked when the link was created
+		if re != nil && !re.MatchString(value) {
+			return "", fmt.Errorf("invalid value for %s", name)
+		}
+		byName[name] = value
+	}
+
+	// Placeholders before the query are path segments; the rest are query values.
+	queryStart := strings.IndexAny(template, "?#")
+	if queryStart < 0 {
+		queryStart = len(template)
+	}
+	var filled strings.Builder
+	last := 0
+	for _, match := range placeholderPattern.FindAllStringSubmatchIndex(template, -1) {
+		start, end, name := match[0], match[1], template[match[2]:match[3]]
+		filled.WriteString(template[last:start])
+		if start < queryStart {
+			filled.WriteString(url.PathEscape(byName[name]))
+		} else {
+			filled.WriteString(url.QueryEscape(byName[name]))
+		}
+		last = end
+	}
+	filled.WriteString(template[last:])
+
+	if query == "" {
+		return filled.String(), nil
+	}
+	u, err := url.Parse(filled.String())
+	if err != nil {
+		return "", errors.New("invalid destination")
+	}
+	if u.RawQuery != "" {
+		u.RawQuery += "&"
+	}
+	u.RawQuery += query
+	return u.String(), nil
+}
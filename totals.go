@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+)
+
+// =======================================================================================
+// Totals - Running counts of stored links and clicks, kept in atomics alongside the
+// indexes so GET /stats/count can answer frequent dashboard polls without taking the
+// store lock or scanning the map.
+// =======================================================================================
+
+// indexTotals counts rec into the totals. Aliases are not counted as links, and their
+// clicks are recorded on the link they point at.
+func (s *URLStore) indexTotals(rec Record) {
+	if rec.AliasOf == "" {
+		s.linkTotal.Add(1)
+	}
+	s.clickTotal.Add(totalClicks(rec.Clicks))
+}
+
+func (s *URLStore) unindexTotals(rec Record) {
+	if rec.AliasOf == "" {
+		s.linkTotal.Add(-1)
+	}
+	s.clickTotal.Add(-totalClicks(rec.Clicks))
+}
+
+// totalClicks returns what a link's clicks add to the total, capped so a saturated count
+// can't turn negative as an int64.
+func totalClicks(clicks uint64) int64 {
+	return int64(min(clicks, math.MaxInt64))
+}
+
+// Totals returns the number of stored links and the clicks recorded on them. Links that
+// have expired are included until compaction or a restart removes them.
+func (s *URLStore) Totals() (links, clicks int64) {
+	return s.linkTotal.Load(), s.clickTotal.Load()
+}
+
+// handleCount serves GET /stats/count.
+func (h *urlHandler) handleCount(w http.ResponseWriter, r *http.Request) {
+	links, clicks := h.store.Totals()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Links  int64 `json:"links"`
+		Clicks int64 `json:"clicks"`
+	}{links, clicks})
+}
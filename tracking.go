@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// =======================================================================================
+// Tracking Parameters - With SHORTY_DEDUPE_IGNORE_TRACKING, duplicate URLs are found by
+// their destination without tracking parameters such as utm_source or fbclid. The same
+// page shared with different tracking then maps to one key under SHORTY_DUPLICATE_URLS.
+// The link keeps the URL it was created with, parameters included, and redirects
+// there. SHORTY_TRACKING_PARAMS replaces the default list; a name ending in * matches
+// every parameter starting with it.
+// =======================================================================================
+
+var defaultTrackingParams = []string{"utm_*", "fbclid", "gclid", "dclid", "msclkid", "mc_eid", "igshid"}
+
+// trackingParams returns the parameters ignored when looking for duplicates: nil unless
+// ignore is set, else params or, when it is empty, the defaults.
+func trackingParams(ignore bool, params []string) []string {
+	if !ignore {
+		return nil
+	}
+	if len(params) == 0 {
+		return defaultTrackingParams
+	}
+	return params
+}
+
+// stripTrackingParams returns longURL without the query parameters params match, leaving
+// the others in their order and encoding.
+func stripTrackingParams(longURL string, params []string) string {
+	u, err := url.Parse(longURL)
+	if err != nil || u.RawQuery == "" {
+		return longURL
+	}
+	var kept []string
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		name, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !isTrackingParam(name, params) {
+			kept = append(kept, pair)
+		}
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	u.ForceQuery = false
+	return u.String()
+}
+
+func isTrackingParam(name string, params []string) bool {
+	name = strings.ToLower(name)
+	for _, param := range params {
+		if prefix, ok := strings.CutSuffix(param, "*"); ok {
+			if strings.HasPrefix(name, strings.ToLower(prefix)) {
+				return true
+			}
+		} else if name == strings.ToLower(param) {
+			return true
+		}
+	}
+	return false
+}
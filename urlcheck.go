@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// =======================================================================================
+// URL Checks - POST /validate runs the destination checks a create would, for client-side
+// form validation, and reports each failure by name. Nothing is stored and no key is
+// involved, so it works the same whether or not the store is writable.
+// =======================================================================================
+
+// The checks a URL can fail, as named in URLCheckFailure.Check.
+const (
+	FailureURL       = "url"       // Absolute http(s) URL with a valid host
+	FailureHost      = "host"      // SHORTY_ALLOWED_HOSTS, SHORTY_BLOCKED_HOSTS and other shorteners
+	FailureSelfLink  = "selfLink"  // SHORTY_SELF_LINKS and SHORTY_MAX_CHAIN_DEPTH
+	FailureReachable = "reachable" // SHORTY_CHECK_DESTINATION
+)
+
+type URLCheckFailure struct {
+	Check  string `json:"check"`
+	Reason string `json:"reason"`
+}
+
+type URLCheck struct {
+	Valid bool `json:"valid"`
+	// URL is the destination as a create would store it, set when it is valid.
+	URL      string            `json:"url,omitempty"`
+	Failures []URLCheckFailure `json:"failures,omitempty"`
+}
+
+// CheckURL runs the destination checks of Add against longURL. The reachability probe only
+// runs once every other check has passed, so blocked or malformed URLs are never fetched.
+func (s *URLStore) CheckURL(ctx context.Context, longURL string) URLCheck {
+	var result URLCheck
+	fail := func(check string, err error) {
+		result.Failures = append(result.Failures, URLCheckFailure{Check: check, Reason: err.Error()})
+	}
+
+	switch err := validateDestination(longURL, s.cfg); {
+	case errors.Is(err, ErrHostNotAllowed), errors.Is(err, ErrShortenerHost):
+		fail(FailureHost, err)
+	case err != nil:
+		fail(FailureURL, err)
+		return result
+	}
+
+	longURL, err := s.applyASCIIHosts(s.applySlashPolicy(s.applyHTTPSPolicy(longURL)))
+	if err != nil {
+		fail(FailureURL, err)
+		return result
+	}
+	s.mu.RLock()
+	longURL, err = s.applySelfLinkPolicyLocked(longURL)
+	s.mu.RUnlock()
+	if err != nil {
+		fail(FailureSelfLink, err)
+	}
+
+	if len(result.Failures) > 0 {
+		return result
+	}
+	if err := s.checkDestination(ctx, longURL); err != nil {
+		fail(FailureReachable, err)
+		return result
+	}
+	return URLCheck{Valid: true, URL: longURL}
+}
+
+// handleValidate serves POST /validate with a body of {"url": "..."}, answering 200 OK
+// with the URLCheck whether or not the URL passes.
+func (h *urlHandler) handleValidate(w http.ResponseWriter, r *http.Request) {
+	if !h.requireJSONBody(w, r) {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, "Error reading request body", http.StatusInternalServerError)
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		writeError(w, r, "Request body is required", http.StatusBadRequest)
+		return
+	}
+
+	var requestData struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		writeError(w, r, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.store.CheckURL(r.Context(), requestData.URL))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// =======================================================================================
+// Validation - Checks applied to destinations and custom keys before they are stored.
+// =======================================================================================
+
+var (
+	ErrInvalidURL     = errors.New("url must be an absolute http or https URL")
+	ErrHostNotAllowed = errors.New("destination host is not allowed")
+	ErrKeyReserved    = errors.New("custom key is reserved")
+	ErrInvalidKey     = errors.New("custom key may only contain letters, digits, '-' and '_'")
+	ErrKeyTooShort    = errors.New("custom key is too short")
+	ErrKeyTooLong     = errors.New("custom key is too long")
+	ErrKeyNeedsAuth   = errors.New("custom keys require an API key")
+	ErrKeyGenerated   = errors.New("custom key has the format of generated keys")
+)
+
+// maxKeyLength bounds custom keys; generated keys are always well below it.
+const maxKeyLength = 64
+
+// What a custom key request does when the key already holds a live link with a custom
+// key. Creates are applied one at a time under the store's lock, so with CustomKeyReject
+// concurrent creates of one key always leave exactly one winner.
+const (
+	CustomKeyReplace = "replace" // Overwrite it, unless the request sent If-None-Match: *
+	CustomKeyReject  = "reject"  // Fail with ErrKeyExists
+)
+
+// reservedKeys are paths routed to the API itself, so a link stored under one of them
+// could never be reached.
+var reservedKeys = map[string]bool{
+	"activity":    true,
+	"admin":       true,
+	"collections": true,
+	"debug":       true,
+	"shorty":      true,
+	"export":      true,
+	"healthz":     true,
+	"import":      true,
+	"stats":       true,
+	"validate":    true,
+	"version":     true,
+}
+
+// validateCustomKey checks a user-chosen short key before it is stored. Admin requests
+// are exempt from the minimum length, so short vanity keys stay available to operators.
+func validateCustomKey(key string, admin bool, cfg Config) error {
+	if err := validateKey(key, cfg); err != nil {
+		return err
+	}
+	if keyBlocked(key, cfg) {
+		return ErrKeyBlocked
+	}
+	if cfg.ReserveGeneratedKeys && looksGenerated(key, cfg.KeyStrategy) {
+		return ErrKeyGenerated
+	}
+	if admin {
+		return nil
+	}
+	if len(key) == 1 && cfg.ReserveSingleCharKeys {
+		return ErrKeyReserved
+	}
+	if len(key) < max(cfg.MinCustomKeyLength, 1) {
+		return ErrKeyTooShort
+	}
+	return nil
+}
+
+// validateKey checks that key is one a link can be stored and reached under, however it
+// was chosen: imported and replaced records are held to it as well as custom keys.
+func validateKey(key string, cfg Config) error {
+	if len(key) > maxKeyLength {
+		return ErrKeyTooLong
+	}
+	if key == "" {
+		return ErrInvalidKey
+	}
+	for _, c := range key {
+		if !isKeyChar(c) {
+			return ErrInvalidKey
+		}
+	}
+	if reservedKeys[key] || key == staticKey(cfg) {
+		return ErrKeyReserved
+	}
+	return nil
+}
+
+// looksGenerated reports whether strategy could produce key: 8 lowercase hex characters
+// for random keys, 7 base62 characters for hash keys and any base62 string for counter
+// keys.
+func looksGenerated(key, strategy string) bool {
+	var length int
+	alphabet := base62Alphabet
+	switch strategy {
+	case KeyStrategyRandom:
+		length, alphabet = 8, "0123456789abcdef"
+	case KeyStrategyHash:
+		length = 7
+	}
+	if length > 0 && len(key) != length {
+		return false
+	}
+	for _, c := range key {
+		if !strings.ContainsRune(alphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isKeyChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+// validateDestination parses longURL and applies the configured host policy.
+func validateDestination(longURL string, cfg Config) error {
+	u, err := url.Parse(longURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	if u.Scheme == "http" && cfg.HTTPSDestinations == HTTPSReject {
+		return ErrInsecureURL
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if cfg.ASCIIHosts {
+		if host, err = asciiHost(host); err != nil {
+			return err
+		}
+	}
+	if len(cfg.AllowedHosts) > 0 && !hostMatches(host, cfg.AllowedHosts) {
+		return ErrHostNotAllowed
+	}
+	if hostMatches(host, cfg.BlockedHosts) {
+		return ErrHostNotAllowed
+	}
+	if hostMatches(host, cfg.ShortenerHosts) && !hostMatches(host, cfg.AllowedHosts) {
+		return ErrShortenerHost
+	}
+	return nil
+}
+
+// hostMatches reports whether host equals one of the patterns. A pattern with a leading
+// dot matches the bare domain as well as any of its subdomains.
+func hostMatches(host string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, ".") {
+			if host == pattern[1:] || strings.HasSuffix(host, pattern) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
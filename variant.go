@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// =======================================================================================
+// A/B Variants - A link may split its visitors between destinations by weight, set with
+// "variants": [{"url": "...", "weight": 50}, ...] at create, counting clicks per variant
+// for the stats endpoint. With SHORTY_STICKY_VARIANTS (on by default) the variant picked
+// is kept in a cookie scoped to the link, so a returning visitor lands where they did
+// before. Variants replace the link's url as its destination and can't be combined with
+// device or country targets, or with permanent redirects that caches would pin to one
+// variant.
+// =======================================================================================
+
+const (
+	maxVariants       = 10
+	variantCookie     = "shorty_variant"
+	variantCookieLife = 30 * 24 * time.Hour
+	noVariant         = -1 // Passed to IncrementClicks for links without variants
+)
+
+var ErrInvalidVariants = errors.New("invalid variants")
+
+// Variant is one destination of a split link. It receives Weight out of the total weight
+// of the link's variants.
+type Variant struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+	Clicks uint64 `json:"clicks"`
+}
+
+// validateVariants checks the variant count, weights and destinations.
+func validateVariants(variants []Variant, hasTargets, permanent bool, status int, cfg Config) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	permanent = permanent || status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+	switch {
+	case len(variants) < 2 || len(variants) > maxVariants:
+		return fmt.Errorf("%w: a link has between 2 and %d variants", ErrInvalidVariants, maxVariants)
+	case hasTargets:
+		return fmt.Errorf("%w: variants can't be combined with devices or countries", ErrInvalidVariants)
+	case permanent:
+		return fmt.Errorf("%w: variants can't be permanent, since caches would keep one", ErrInvalidVariants)
+	}
+	for i, variant := range variants {
+		if variant.Weight < 1 || variant.Weight > 1000 {
+			return fmt.Errorf("%w: variant %d weight must be between 1 and 1000", ErrInvalidVariants, i)
+		}
+		if err := validateDestination(variant.URL, cfg); err != nil {
+			return fmt.Errorf("%w: variant %d: %w", ErrInvalidVariants, i, err)
+		}
+	}
+	return nil
+}
+
+// applyVariantPoliciesLocked rewrites each variant's url the way a link's url is
+// rewritten before it is stored, and starts its clicks at zero. Must be called with s.mu
+// held.
+func (s *URLStore) applyVariantPoliciesLocked(variants []Variant) ([]Variant, error) {
+	if len(variants) == 0 {
+		return nil, nil
+	}
+	applied := make([]Variant, len(variants))
+	for i, variant := range variants {
+		targets, err := s.applyTargetPoliciesLocked(map[string]string{"": variant.URL})
+		if err != nil {
+			return nil, err
+		}
+		applied[i] = Variant{URL: targets[""], Weight: variant.Weight}
+	}
+	return applied, nil
+}
+
+// variantsWithoutClicks returns a copy of variants with their click counts cleared, for
+// saving under ClickPersistNone.
+func variantsWithoutClicks(variants []Variant) []Variant {
+	if len(variants) == 0 {
+		return variants
+	}
+	variants = slices.Clone(variants)
+	for i := range variants {
+		variants[i].Clicks = 0
+	}
+	return variants
+}
+
+// pickVariant returns the index of the variant to send the visitor to: the one in their
+// cookie when sticky variants are on, otherwise one drawn by weight.
+func pickVariant(r *http.Request, variants []Variant, sticky bool) (int, bool) {
+	if sticky {
+		if cookie, err := r.Cookie(variantCookie); err == nil {
+			if i, err := strconv.Atoi(cookie.Value); err == nil && i >= 0 && i < len(variants) {
+				return i, true
+			}
+		}
+	}
+
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+	n := rand.N(total)
+	for i, variant := range variants {
+		if n < variant.Weight {
+			return i, false
+		}
+		n -= variant.Weight
+	}
+	return len(variants) - 1, false // Unreachable, as every weight is positive
+}
+
+// variantTarget returns rec with URL set to the variant picked for the visitor and that
+// variant's index, remembering it in a cookie when sticky variants are on.
+func (h *urlHandler) variantTarget(w http.ResponseWriter, r *http.Request, shortKey string, rec Record) (Record, int) {
+	i, remembered := pickVariant(r, rec.Variants, h.cfg.StickyVariants)
+	if h.cfg.StickyVariants && !remembered {
+		http.SetCookie(w, &http.Cookie{
+			Name:     variantCookie,
+			Value:    strconv.Itoa(i),
+			Path:     h.cfg.PathPrefix + "/" + shortKey, // Each link keeps its own variant
+			MaxAge:   int(variantCookieLife.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	rec.URL = rec.Variants[i].URL
+	return rec, i
+}
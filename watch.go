@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// =======================================================================================
+// File Watching - With SHORTY_WATCH_FILE the store reloads the data file whenever another
+// process changes it, e.g. a primary writing the file a replica serves. Bursts of events
+// are debounced into one reload, and a file whose contents match what this process last
+// saved is skipped, so the store's own saves don't trigger reloads. A reload replaces the
+// store's contents under the write lock, like SIGHUP: reads wait for it rather than fail,
+// and changes not yet saved are lost.
+// =======================================================================================
+
+// watchDebounce is how long the file must stay quiet before it is reloaded.
+const watchDebounce = 250 * time.Millisecond
+
+// watchFile starts reloading the store on external changes to its data file. The
+// directory is watched rather than the file, since saves replace the file by renaming a
+// new one over it.
+func (s *URLStore) watchFile() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(s.filename)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	target := filepath.Clean(s.filename)
+	go func() {
+		var debounce *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != target || !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+				if debounce == nil {
+					debounce = time.AfterFunc(watchDebounce, s.reloadChanged)
+				} else {
+					debounce.Reset(watchDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Error("Watching data file failed", "file", s.filename, "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// reloadChanged reloads the data file unless it holds what the store last saved or loaded.
+func (s *URLStore) reloadChanged() {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	data, err := os.ReadFile(s.filename)
+	if err != nil {
+		slog.Error("Reading changed data file failed", "file", s.filename, "error", err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	if sum == s.lastWritten {
+		return
+	}
+	urls, err := s.decodeFile(data)
+	if err != nil {
+		// Likely a write still in progress by a process that doesn't write atomically;
+		// its next event triggers another attempt.
+		slog.Warn("Changed data file is not readable, keeping current data", "file", s.filename, "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.replaceLocked(urls)
+	s.markLoadedLocked(urls)
+	s.mu.Unlock()
+	s.lastWritten = sum
+	slog.Info("Reloaded data file after an external change", "file", s.filename, "links", len(urls))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// =======================================================================================
+// Webhooks - Delivers event payloads to an operator-configured URL out of band. A single
+// worker drains a queue bounded by SHORTY_CLICK_WEBHOOK_QUEUE_SIZE, so a slow receiver
+// causes events to be dropped and counted rather than piling up or delaying the requests
+// that produced them, unless SHORTY_CLICK_QUEUE_FULL=block has requests wait instead.
+// =======================================================================================
+
+const (
+	defaultWebhookQueueSize = 256
+
+	webhookAttempts = 3
+	webhookTimeout  = 5 * time.Second
+	webhookBackoff  = 500 * time.Millisecond // Doubled after each failed attempt
+)
+
+type webhookDispatcher struct {
+	url     string
+	secret  []byte // Signs deliveries when set; see webhooksign.go
+	client  *http.Client
+	queue   chan webhookDelivery
+	block   bool // Wait for room in a full queue instead of dropping
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// webhookDelivery is a queued payload and the ID of the request that caused it.
+type webhookDelivery struct {
+	body      []byte
+	requestID string
+}
+
+// newWebhookDispatcher delivers to url through a queue of queueSize, blocking or
+// dropping when it is full as block says.
+func newWebhookDispatcher(url string, secret []byte, queueSize int, block bool) *webhookDispatcher {
+	d := &webhookDispatcher{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan webhookDelivery, queueSize),
+		block:  block,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(d.done)
+		for delivery := range d.queue {
+			if err := d.deliver(delivery); err != nil {
+				slog.Warn("Webhook delivery failed", "url", d.url, "error", err)
+			}
+		}
+	}()
+	return d
+}
+
+// Send queues payload for delivery. When the queue is full it waits or drops payload,
+// according to the dispatcher's policy. A non-empty requestID is sent along in the
+// X-Request-ID header.
+func (d *webhookDispatcher) Send(payload any, requestID string) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Error encoding webhook payload", "error", err)
+		return
+	}
+
+	delivery := webhookDelivery{body, requestID}
+	if d.block {
+		d.queue <- delivery
+		return
+	}
+	select {
+	case d.queue <- delivery:
+	default:
+		if n := d.dropped.Add(1); n%dropLogEvery == 1 {
+			slog.Warn("Webhook queue full, dropping event", "url", d.url, "dropped", n)
+		}
+	}
+}
+
+// Dropped returns how many payloads were dropped because the queue was full.
+func (d *webhookDispatcher) Dropped() uint64 {
+	if d == nil {
+		return 0
+	}
+	return d.dropped.Load()
+}
+
+// Close stops accepting events and waits for the queued ones to be delivered.
+func (d *webhookDispatcher) Close() {
+	close(d.queue)
+	<-d.done
+}
+
+// deliver POSTs a payload, retrying failures with exponential backoff up to
+// webhookAttempts.
+func (d *webhookDispatcher) deliver(delivery webhookDelivery) error {
+	var err error
+	backoff := webhookBackoff
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		if err = d.post(delivery); err == nil {
+			return nil
+		}
+		if attempt < webhookAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+func (d *webhookDispatcher) post(delivery webhookDelivery) error {
+	body := delivery.body
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if delivery.requestID != "" {
+		req.Header.Set(RequestIDHeader, delivery.requestID)
+	}
+	if len(d.secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(d.secret, timestamp, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =======================================================================================
+// Webhook Signatures - With SHORTY_CLICK_WEBHOOK_SECRET, every webhook delivery carries
+// X-Shorty-Timestamp, the Unix time it was sent, and X-Shorty-Signature, "sha256=" and
+// the hex HMAC-SHA256 of the timestamp, a dot and the body under the secret. Receivers
+// check both with VerifyWebhookSignature: a valid signature proves the event came from
+// this server unchanged, and the timestamp bounds how long a captured delivery could be
+// replayed for. Each retry is signed afresh.
+// =======================================================================================
+
+const (
+	WebhookTimestampHeader = "X-Shorty-Timestamp"
+	WebhookSignatureHeader = "X-Shorty-Signature"
+
+	// DefaultWebhookTolerance is how far a delivery's timestamp may be from the
+	// receiver's clock, either way, for VerifyWebhookSignature to accept it.
+	DefaultWebhookTolerance = 5 * time.Minute
+)
+
+var (
+	ErrWebhookSignature = errors.New("webhook signature is missing or invalid")
+	ErrWebhookStale     = errors.New("webhook timestamp is outside the tolerance")
+)
+
+// SignWebhook returns the X-Shorty-Signature value for body sent with timestamp.
+func SignWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks a delivery's X-Shorty-Timestamp and X-Shorty-Signature
+// header values against its raw body. It returns ErrWebhookSignature when the signature
+// doesn't match and ErrWebhookStale when the timestamp is more than tolerance away from
+// now. Receivers that keep the signatures they have accepted within the tolerance can
+// also refuse a delivery replayed inside it.
+func VerifyWebhookSignature(secret []byte, timestamp, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return ErrWebhookSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(SignWebhook(secret, timestamp, body))) {
+		return ErrWebhookSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return ErrWebhookStale
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// =======================================================================================
+// Welcome Page - What the root path shows. Operators can brand it with an html/template
+// file or send visitors to their main website; otherwise a plain-text hint about the API
+// is returned. Pure-API deployments can answer 404 or 204 instead.
+// =======================================================================================
+
+const (
+	RootWelcome    = "welcome"
+	RootNotFound   = "notfound"
+	RootNoContent  = "empty"
+	RootRedirectTo = "redirect"
+)
+
+// welcomeData is what a custom welcome template can render.
+type welcomeData struct {
+	TotalLinks int
+	PathPrefix string
+}
+
+func (h *urlHandler) handleRoot(w http.ResponseWriter, r *http.Request) {
+	switch h.cfg.RootResponse {
+	case RootRedirectTo:
+		http.Redirect(w, r, h.cfg.RootRedirect, http.StatusFound)
+		return
+	case RootNotFound:
+		notFound(w, r)
+		return
+	case RootNoContent:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if h.welcome == nil {
+		h.writeWelcome(w, "text/plain; charset=utf-8", "Welcome to Go-Shorty! Use POST to "+h.cfg.PathPrefix+"/shorty to create a short URL.\n")
+		return
+	}
+
+	// Render into a buffer first so a template error can still produce a clean 500.
+	var buf bytes.Buffer
+	data := welcomeData{TotalLinks: h.store.Len(), PathPrefix: h.cfg.PathPrefix}
+	if err := h.welcome.Execute(&buf, data); err != nil {
+		slog.Error("Error rendering welcome template", "error", err)
+		writeError(w, r, "Failed to render welcome page", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeWelcome(w, "text/html; charset=utf-8", buf.String())
+}
+
+// writeWelcome sends the welcome page with the configured status, and the configured
+// content type or contentType when none is set.
+func (h *urlHandler) writeWelcome(w http.ResponseWriter, contentType, body string) {
+	if h.cfg.WelcomeContentType != "" {
+		contentType = h.cfg.WelcomeContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(h.cfg.WelcomeStatus)
+	io.WriteString(w, body)
+}